@@ -0,0 +1,379 @@
+package autoscaler
+
+import (
+	"context"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/yaml"
+)
+
+// NodeGroupLabel is the label of the nodes in a node group, whose value is the name of the node group.
+// The nodes created by Autoscaler have it, and the existing nodes with it are counted in the size of the node group.
+const NodeGroupLabel = "simulator/node-group"
+
+// defaultScanInterval is the same as the default of cluster-autoscaler.
+const defaultScanInterval = 10 * time.Second
+
+// Config is the configuration of Autoscaler.
+type Config struct {
+	// ScanInterval is the interval to look for the unschedulable pods. Defaults to 10s.
+	ScanInterval metav1.Duration `json:"scanInterval,omitempty"`
+	// ProvisionDelay is the time from a scale-up to the creation of the nodes, as the cloud provider takes to boot them.
+	ProvisionDelay metav1.Duration `json:"provisionDelay,omitempty"`
+	// NodeGroups are the node groups to scale up. They are tried in order for each unschedulable pod,
+	// so the first node group which can run the pod is scaled up.
+	NodeGroups []NodeGroup `json:"nodeGroups"`
+}
+
+// NodeGroup is a group of the nodes made from the same template, like an auto scaling group of a cloud provider.
+type NodeGroup struct {
+	Name string `json:"name"`
+	// MaxSize is the maximum number of the nodes in the node group.
+	MaxSize int `json:"maxSize"`
+	// ProvisionDelay overrides Config.ProvisionDelay for the node group.
+	ProvisionDelay *metav1.Duration `json:"provisionDelay,omitempty"`
+	// Template is the node created for a scale-up. The name is generated from the name of the node group.
+	Template v1.Node `json:"template"`
+}
+
+// LoadConfig reads a Config from a YAML or JSON file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read autoscaler config file: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, xerrors.Errorf("decode autoscaler config file %s: %w", path, err)
+	}
+
+	names := map[string]bool{}
+	for _, g := range cfg.NodeGroups {
+		if g.Name == "" {
+			return nil, xerrors.New("node group has no name")
+		}
+		if names[g.Name] {
+			return nil, xerrors.Errorf("node group %s is duplicated", g.Name)
+		}
+		names[g.Name] = true
+		if g.MaxSize < 0 {
+			return nil, xerrors.Errorf("maxSize of node group %s is negative", g.Name)
+		}
+	}
+	return cfg, nil
+}
+
+// Scheduler runs the filter plugins of the scheduler for the what-if checks of the scale-ups.
+// It's implemented by scheduler.Service.
+type Scheduler interface {
+	// FitsExistingNode returns nil if some node in the cluster passes the filter plugins for the pod.
+	FitsExistingNode(ctx context.Context, pod *v1.Pod) *framework.Status
+	// FitsNewNode returns nil if the node, which isn't in the cluster, passes the filter plugins for the pod
+	// with the pods on it.
+	FitsNewNode(ctx context.Context, pod *v1.Pod, node *v1.Node, pods []*v1.Pod) *framework.Status
+}
+
+// Autoscaler is a stand-in of cluster-autoscaler for the simulator. It only scales up:
+// at every scan interval, it takes the pending pods which the scheduler marked unschedulable
+// (the PodScheduled condition is False with the Unschedulable reason), and bin-packs them onto
+// new nodes made from the templates of the node groups, checking each pod with the filter plugins of the scheduler.
+// The pods which fit the nodes in the cluster or the nodes being provisioned are skipped.
+// The new nodes are created after the provision delay, and the scheduler retries the pods on the NodeAdd event.
+type Autoscaler struct {
+	client clientset.Interface
+	cfg    *Config
+	sched  Scheduler
+	clock  clock.WithDelayedExecution
+
+	podLister  corelisters.PodLister
+	nodeLister corelisters.NodeLister
+
+	// mu protects upcoming.
+	mu sync.Mutex
+	// upcoming is the number of the nodes being provisioned in each node group.
+	upcoming map[string]int
+}
+
+// StartAutoscaler starts Autoscaler with its own informers, and returns the function to stop it.
+// clk is the clock for the provision delay, e.g. the virtual clock of the scheduler.
+func StartAutoscaler(client clientset.Interface, sched Scheduler, cfg *Config, clk clock.WithDelayedExecution) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	a := New(client, informerFactory, sched, cfg, clk)
+
+	informerFactory.Start(ctx.Done())
+	for typ, synced := range informerFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			cancel()
+			return nil, xerrors.Errorf("wait for cache sync of %v", typ)
+		}
+	}
+
+	go a.Run(ctx)
+
+	return cancel, nil
+}
+
+// New creates Autoscaler with the listers of the informers.
+func New(client clientset.Interface, informerFactory informers.SharedInformerFactory, sched Scheduler, cfg *Config, clk clock.WithDelayedExecution) *Autoscaler {
+	return &Autoscaler{
+		client:     client,
+		cfg:        cfg,
+		sched:      sched,
+		clock:      clk,
+		podLister:  informerFactory.Core().V1().Pods().Lister(),
+		nodeLister: informerFactory.Core().V1().Nodes().Lister(),
+		upcoming:   map[string]int{},
+	}
+}
+
+// Run scans the unschedulable pods at every scan interval until ctx is done.
+func (a *Autoscaler) Run(ctx context.Context) {
+	interval := a.cfg.ScanInterval.Duration
+	if interval == 0 {
+		interval = defaultScanInterval
+	}
+
+	klog.Info("autoscaler: starting")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := a.RunOnce(ctx); err != nil {
+			klog.Errorf("autoscaler: failed to scale up: %v", err)
+		}
+	}, interval)
+	klog.Info("autoscaler: shutting down")
+}
+
+// plannedNode is a node of a node group in the bin-packing of a scale-up.
+type plannedNode struct {
+	group *NodeGroup
+	node  *v1.Node
+	pods  []*v1.Pod
+	// upcoming is true if the node is already being provisioned.
+	upcoming bool
+}
+
+// RunOnce bin-packs the unschedulable pods onto new nodes, and scales up the node groups by the new nodes.
+func (a *Autoscaler) RunOnce(ctx context.Context) error {
+	pods, err := a.unschedulablePods()
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+	sizes, upcoming, err := a.nodeGroupSizes()
+	if err != nil {
+		return err
+	}
+
+	// The nodes being provisioned are planned first, so that the pods waiting for them don't scale up again.
+	var planned []*plannedNode
+	for i := range a.cfg.NodeGroups {
+		g := &a.cfg.NodeGroups[i]
+		for j := 0; j < upcoming[g.Name]; j++ {
+			planned = append(planned, &plannedNode{group: g, node: templateNode(g), upcoming: true})
+		}
+	}
+
+	for _, pod := range pods {
+		if status := a.sched.FitsExistingNode(ctx, pod); status.IsSuccess() {
+			continue
+		} else if !status.IsUnschedulable() {
+			return xerrors.Errorf("check pod %s/%s on the existing nodes: %w", pod.Namespace, pod.Name, status.AsError())
+		}
+
+		if a.fitPlannedNode(ctx, pod, planned) {
+			continue
+		}
+
+		p, err := a.planNewNode(ctx, pod, sizes)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			klog.Infof("autoscaler: no node group can run pod %s/%s", pod.Namespace, pod.Name)
+			continue
+		}
+		planned = append(planned, p)
+		sizes[p.group.Name]++
+	}
+
+	for _, p := range planned {
+		if !p.upcoming {
+			a.scaleUp(ctx, p.group, len(p.pods))
+		}
+	}
+	return nil
+}
+
+// unschedulablePods returns the pending pods which the scheduler marked unschedulable, in the order of creation.
+func (a *Autoscaler) unschedulablePods() ([]*v1.Pod, error) {
+	all, err := a.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, xerrors.Errorf("list pods: %w", err)
+	}
+	var pods []*v1.Pod
+	for _, pod := range all {
+		if pod.Spec.NodeName != "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, c := range pod.Status.Conditions {
+			if c.Type == v1.PodScheduled && c.Status == v1.ConditionFalse && c.Reason == v1.PodReasonUnschedulable {
+				pods = append(pods, pod)
+				break
+			}
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+	return pods, nil
+}
+
+// nodeGroupSizes returns the number of the nodes in each node group including the nodes being provisioned,
+// and the number of the nodes being provisioned.
+func (a *Autoscaler) nodeGroupSizes() (map[string]int, map[string]int, error) {
+	nodes, err := a.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("list nodes: %w", err)
+	}
+	sizes := map[string]int{}
+	for _, n := range nodes {
+		if g, ok := n.Labels[NodeGroupLabel]; ok {
+			sizes[g]++
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	upcoming := make(map[string]int, len(a.upcoming))
+	for g, n := range a.upcoming {
+		sizes[g] += n
+		upcoming[g] = n
+	}
+	return sizes, upcoming, nil
+}
+
+// fitPlannedNode adds the pod to the first planned node which the pod fits, and returns true if there is such a node.
+func (a *Autoscaler) fitPlannedNode(ctx context.Context, pod *v1.Pod, planned []*plannedNode) bool {
+	for _, p := range planned {
+		if status := a.sched.FitsNewNode(ctx, pod, p.node, p.pods); status.IsSuccess() {
+			p.pods = append(p.pods, pod)
+			return true
+		}
+	}
+	return false
+}
+
+// planNewNode returns a new node of the first node group which has room and whose template the pod fits,
+// or nil if there is no such node group.
+func (a *Autoscaler) planNewNode(ctx context.Context, pod *v1.Pod, sizes map[string]int) (*plannedNode, error) {
+	for i := range a.cfg.NodeGroups {
+		g := &a.cfg.NodeGroups[i]
+		if sizes[g.Name] >= g.MaxSize {
+			klog.V(2).Infof("autoscaler: node group %s has reached the max size %d", g.Name, g.MaxSize)
+			continue
+		}
+		node := templateNode(g)
+		status := a.sched.FitsNewNode(ctx, pod, node, nil)
+		if status.IsSuccess() {
+			return &plannedNode{group: g, node: node, pods: []*v1.Pod{pod}}, nil
+		}
+		if !status.IsUnschedulable() {
+			return nil, xerrors.Errorf("check pod %s/%s on node group %s: %w", pod.Namespace, pod.Name, g.Name, status.AsError())
+		}
+		klog.V(2).Infof("autoscaler: pod %s/%s doesn't fit node group %s: %s", pod.Namespace, pod.Name, g.Name, status.Message())
+	}
+	return nil, nil
+}
+
+// scaleUp creates a node of the node group after the provision delay.
+func (a *Autoscaler) scaleUp(ctx context.Context, g *NodeGroup, numPods int) {
+	delay := a.cfg.ProvisionDelay.Duration
+	if g.ProvisionDelay != nil {
+		delay = g.ProvisionDelay.Duration
+	}
+	klog.Infof("autoscaler: scaling up node group %s for %d pods, the node is created in %v", g.Name, numPods, delay)
+
+	a.mu.Lock()
+	a.upcoming[g.Name]++
+	a.mu.Unlock()
+
+	go func() {
+		defer func() {
+			a.mu.Lock()
+			a.upcoming[g.Name]--
+			a.mu.Unlock()
+		}()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.clock.After(delay):
+		}
+
+		node, err := a.createNode(ctx, g)
+		if err != nil {
+			klog.Errorf("autoscaler: failed to create node of node group %s: %v", g.Name, err)
+			return
+		}
+		klog.Infof("autoscaler: created node %s of node group %s", node.Name, g.Name)
+	}()
+}
+
+// createNode creates a node from the template of the node group with a random name.
+func (a *Autoscaler) createNode(ctx context.Context, g *NodeGroup) (*v1.Node, error) {
+	for {
+		node := templateNode(g)
+		node.Name = g.Name + "-" + utilrand.String(5)
+		node.Labels[v1.LabelHostname] = node.Name
+
+		created, err := a.client.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			continue
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("create node %s: %w", node.Name, err)
+		}
+		return created, nil
+	}
+}
+
+// templateNode returns the node made from the template of the node group, which is ready and has the node group label.
+// Its name is a placeholder for the what-if checks.
+func templateNode(g *NodeGroup) *v1.Node {
+	node := g.Template.DeepCopy()
+	node.Name = g.Name + "-template"
+	node.ResourceVersion = ""
+	node.UID = ""
+	if node.Labels == nil {
+		node.Labels = map[string]string{}
+	}
+	node.Labels[NodeGroupLabel] = g.Name
+	node.Labels[v1.LabelHostname] = node.Name
+	if node.Status.Capacity == nil {
+		node.Status.Capacity = node.Status.Allocatable.DeepCopy()
+	}
+	if len(node.Status.Conditions) == 0 {
+		node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue, Reason: "KubeletReady"}}
+	}
+	return node
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	goflag "flag"
+
+	"github.com/spf13/cobra"
+	klogv1 "k8s.io/klog"
+	"k8s.io/klog/v2"
+)
+
+// NewSchedCommand creates the root command of sched.
+func NewSchedCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "sched",
+		Short:        "sched runs kube-apiserver and mini-kube-scheduler to simulate scheduling",
+		SilenceUsage: true,
+	}
+
+	addKlogFlags(cmd)
+
+	cmd.AddCommand(
+		newServeCommand(),
+		newRunScenarioCommand(),
+		newExportCommand(),
+		newImportCommand(),
+		newImportClusterCommand(),
+		newReplayCommand(),
+	)
+
+	return cmd
+}
+
+// addKlogFlags adds the log verbosity flag (-v) to the command.
+// Both klog and klog/v2 are used in this repository, so the verbosity is set to both.
+func addKlogFlags(cmd *cobra.Command) {
+	fs := goflag.NewFlagSet("klog", goflag.ExitOnError)
+	klog.InitFlags(fs)
+	cmd.PersistentFlags().AddGoFlag(fs.Lookup("v"))
+
+	fsv1 := goflag.NewFlagSet("klogv1", goflag.ExitOnError)
+	klogv1.InitFlags(fsv1)
+
+	cmd.PersistentPreRunE = func(_ *cobra.Command, _ []string) error {
+		return fsv1.Set("v", fs.Lookup("v").Value.String())
+	}
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"sigs.k8s.io/yaml"
+
+	"github.com/nakamasato/mini-kube-scheduler/snapshot"
+)
+
+// snapshotTarget is the simulator to export from or import to.
+// The HTTP server of serve is used if server is set. Otherwise, API server is accessed with kubeconfig,
+// in which case the scheduler configuration isn't exported or imported.
+type snapshotTarget struct {
+	server     string
+	kubeconfig string
+}
+
+func (t *snapshotTarget) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&t.server, "server", "", "URL of the HTTP server started by serve --http-address (e.g. http://127.0.0.1:1212).")
+	cmd.Flags().StringVar(&t.kubeconfig, "kubeconfig", "", "Path to kubeconfig of API server. Used if --server is not set.")
+}
+
+func (t *snapshotTarget) validate() error {
+	if (t.server == "") == (t.kubeconfig == "") {
+		return xerrors.New("exactly one of --server or --kubeconfig must be set")
+	}
+	return nil
+}
+
+func (t *snapshotTarget) snapshotURL() string {
+	return t.server + "/api/v1/snapshot"
+}
+
+func newExportCommand() *cobra.Command {
+	t := &snapshotTarget{}
+	var output string
+	cmd := &cobra.Command{
+		Use:   "export [file]",
+		Short: "Export the cluster state to the file (or stdout)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if err := t.validate(); err != nil {
+				return err
+			}
+			out := os.Stdout
+			if len(args) == 1 {
+				f, err := os.Create(args[0])
+				if err != nil {
+					return xerrors.Errorf("create %s: %w", args[0], err)
+				}
+				defer f.Close()
+				out = f
+			}
+			return export(t, output, out)
+		},
+	}
+	t.addFlags(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "yaml", "Output format. One of: yaml, json.")
+
+	return cmd
+}
+
+func export(t *snapshotTarget, output string, out io.Writer) error {
+	s, err := exportSnapshot(context.Background(), t)
+	if err != nil {
+		return xerrors.Errorf("export snapshot: %w", err)
+	}
+
+	var data []byte
+	switch output {
+	case "yaml":
+		data, err = yaml.Marshal(s)
+	case "json":
+		data, err = json.MarshalIndent(s, "", "  ")
+	default:
+		return xerrors.Errorf("unknown output format %q", output)
+	}
+	if err != nil {
+		return xerrors.Errorf("encode snapshot: %w", err)
+	}
+
+	if _, err := out.Write(data); err != nil {
+		return xerrors.Errorf("write snapshot: %w", err)
+	}
+	return nil
+}
+
+func exportSnapshot(ctx context.Context, t *snapshotTarget) (*snapshot.Snapshot, error) {
+	if t.server == "" {
+		client, err := newClientFromKubeconfig(t.kubeconfig)
+		if err != nil {
+			return nil, xerrors.Errorf("create client: %w", err)
+		}
+		return snapshot.Export(ctx, client)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.snapshotURL(), nil)
+	if err != nil {
+		return nil, xerrors.Errorf("create request: %w", err)
+	}
+	data, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshot.Snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, xerrors.Errorf("decode snapshot: %w", err)
+	}
+	return s, nil
+}
+
+// doRequest sends the request and returns the response body. It returns error if the status isn't 200.
+func doRequest(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("request %s %s: %w", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, xerrors.Errorf("request %s %s: %s: %s", req.Method, req.URL, resp.Status, data)
+	}
+	return data, nil
+}
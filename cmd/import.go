@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"sigs.k8s.io/yaml"
+
+	"github.com/nakamasato/mini-kube-scheduler/snapshot"
+)
+
+func newImportCommand() *cobra.Command {
+	t := &snapshotTarget{}
+	var clear bool
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import the cluster state in the file (yaml or json) created by export",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if err := t.validate(); err != nil {
+				return err
+			}
+			return importSnapshot(t, args[0], snapshot.ImportOptions{Clear: clear})
+		},
+	}
+	t.addFlags(cmd)
+	cmd.Flags().BoolVar(&clear, "clear", false, "Delete all the resources in the cluster before importing.")
+
+	return cmd
+}
+
+func importSnapshot(t *snapshotTarget, path string, opts snapshot.ImportOptions) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return xerrors.Errorf("read %s: %w", path, err)
+	}
+	s := &snapshot.Snapshot{}
+	// yaml.Unmarshal can decode json as well.
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return xerrors.Errorf("decode snapshot: %w", err)
+	}
+
+	return importToTarget(context.Background(), t, s, opts)
+}
+
+// importToTarget imports the snapshot to the simulator via the HTTP server or API server.
+func importToTarget(ctx context.Context, t *snapshotTarget, s *snapshot.Snapshot, opts snapshot.ImportOptions) error {
+	if t.server != "" {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return xerrors.Errorf("encode snapshot: %w", err)
+		}
+		u := t.snapshotURL() + "?" + url.Values{"clear": {strconv.FormatBool(opts.Clear)}}.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+		if err != nil {
+			return xerrors.Errorf("create request: %w", err)
+		}
+		if _, err := doRequest(req); err != nil {
+			return xerrors.Errorf("import snapshot: %w", err)
+		}
+		return nil
+	}
+
+	client, err := newClientFromKubeconfig(t.kubeconfig)
+	if err != nil {
+		return xerrors.Errorf("create client: %w", err)
+	}
+	if err := snapshot.Import(ctx, client, s, opts); err != nil {
+		return xerrors.Errorf("import snapshot: %w", err)
+	}
+	return nil
+}
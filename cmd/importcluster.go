@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/nakamasato/mini-kube-scheduler/snapshot"
+)
+
+func newImportClusterCommand() *cobra.Command {
+	t := &snapshotTarget{}
+	var sourceKubeconfig, unbindSelector string
+	var clear bool
+	cmd := &cobra.Command{
+		Use:   "import-cluster",
+		Short: "Import the cluster state from a live cluster",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := t.validate(); err != nil {
+				return err
+			}
+			opts := snapshot.ClusterOptions{}
+			if cmd.Flags().Changed("unbind-selector") {
+				selector, err := labels.Parse(unbindSelector)
+				if err != nil {
+					return xerrors.Errorf("parse --unbind-selector: %w", err)
+				}
+				opts.UnbindSelector = selector
+			}
+			return importCluster(t, sourceKubeconfig, opts, snapshot.ImportOptions{Clear: clear})
+		},
+	}
+	t.addFlags(cmd)
+	cmd.Flags().StringVar(&sourceKubeconfig, "source-kubeconfig", "", "Path to kubeconfig of the live cluster to import from.")
+	cmd.Flags().StringVar(&unbindSelector, "unbind-selector", "", "Label selector of the pods to be unbound so that the scheduler places them again. An empty selector unbinds all pods.")
+	cmd.Flags().BoolVar(&clear, "clear", false, "Delete all the resources in the simulator before importing.")
+	_ = cmd.MarkFlagRequired("source-kubeconfig")
+
+	return cmd
+}
+
+func importCluster(t *snapshotTarget, sourceKubeconfig string, clusterOpts snapshot.ClusterOptions, importOpts snapshot.ImportOptions) error {
+	ctx := context.Background()
+
+	source, err := newClientFromKubeconfig(sourceKubeconfig)
+	if err != nil {
+		return xerrors.Errorf("create client for the source cluster: %w", err)
+	}
+	s, err := snapshot.FromCluster(ctx, source, clusterOpts)
+	if err != nil {
+		return xerrors.Errorf("read the source cluster: %w", err)
+	}
+
+	return importToTarget(ctx, t, s, importOpts)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"sigs.k8s.io/yaml"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched/replay"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/trace"
+	"github.com/nakamasato/mini-kube-scheduler/scheduler"
+)
+
+func newReplayCommand() *cobra.Command {
+	opts := replay.Options{}
+	o := &minischedOptions{}
+	var configPath string
+	cmd := &cobra.Command{
+		Use:   "replay <trace-file>",
+		Short: "Replay the trace recorded with --trace-out and report the scheduling decisions which differ",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			opts.SchedulerOptions = o.options()
+			if configPath != "" {
+				cfg, err := scheduler.LoadSchedulerConfig(configPath)
+				if err != nil {
+					return xerrors.Errorf("load scheduler config: %w", err)
+				}
+				opts.SchedulerOptions = append(opts.SchedulerOptions, scheduler.ProfileOptions(cfg)...)
+			}
+			return runReplay(args[0], opts)
+		},
+	}
+	cmd.Flags().DurationVar(&opts.DecisionTimeout, "decision-timeout", 15*time.Second, "Virtual time to wait for a pod to be schedulable at each recorded decision.")
+	o.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to KubeSchedulerConfiguration (v1beta2) file to replay with (e.g. to compare the node selection strategies).")
+
+	return cmd
+}
+
+func runReplay(path string, opts replay.Options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return xerrors.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	events, err := trace.Read(f)
+	if err != nil {
+		return xerrors.Errorf("read trace: %w", err)
+	}
+
+	result, err := replay.Replay(context.Background(), events, opts)
+	if err != nil {
+		return xerrors.Errorf("replay: %w", err)
+	}
+
+	data, err := yaml.Marshal(result)
+	if err != nil {
+		return xerrors.Errorf("marshal result: %w", err)
+	}
+	fmt.Print(string(data))
+
+	if len(result.Diffs) != 0 {
+		return xerrors.Errorf("%d of %d decisions differ from the trace", len(result.Diffs), result.Decisions)
+	}
+	return nil
+}
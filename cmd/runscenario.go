@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+
+	"github.com/nakamasato/mini-kube-scheduler/scenario"
+)
+
+func newRunScenarioCommand() *cobra.Command {
+	o := &simulatorOptions{}
+	cmd := &cobra.Command{
+		Use:   "run-scenario <file>",
+		Short: "Run API server and scheduler, and then run the scenario in the file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return runScenario(o, args[0])
+		},
+	}
+	o.addFlags(cmd.Flags())
+
+	return cmd
+}
+
+func runScenario(o *simulatorOptions, path string) error {
+	s, err := scenario.Load(path)
+	if err != nil {
+		return xerrors.Errorf("load scenario: %w", err)
+	}
+
+	ctx := genericapiserver.SetupSignalContext()
+
+	sim, err := startSimulator(o)
+	if err != nil {
+		return xerrors.Errorf("start simulator: %w", err)
+	}
+	defer sim.shutdown()
+
+	if err := scenario.Run(ctx, sim.client, s, sim.clock); err != nil {
+		return xerrors.Errorf("run scenario: %w", err)
+	}
+
+	return nil
+}
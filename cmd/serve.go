@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/klog"
+
+	"github.com/nakamasato/mini-kube-scheduler/server"
+)
+
+func newServeCommand() *cobra.Command {
+	o := &simulatorOptions{}
+	var httpAddress string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run API server and scheduler until signalled",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return serve(o, httpAddress)
+		},
+	}
+	o.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&httpAddress, "http-address", "", "Address for the HTTP server (e.g. 127.0.0.1:1212) to export/import snapshots and simulate scheduling. The HTTP server is disabled if empty.")
+
+	return cmd
+}
+
+func serve(o *simulatorOptions, httpAddress string) error {
+	ctx := genericapiserver.SetupSignalContext()
+
+	sim, err := startSimulator(o)
+	if err != nil {
+		return xerrors.Errorf("start simulator: %w", err)
+	}
+	defer sim.shutdown()
+
+	if httpAddress != "" {
+		shutdownServer, err := server.NewServer(sim.sched).Start(httpAddress)
+		if err != nil {
+			return xerrors.Errorf("start http server: %w", err)
+		}
+		defer shutdownServer()
+	}
+
+	klog.Info("serving until signalled")
+	<-ctx.Done()
+
+	return nil
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/xerrors"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog"
+	v1beta2config "k8s.io/kube-scheduler/config/v1beta2"
+	"k8s.io/utils/clock"
+
+	"github.com/nakamasato/mini-kube-scheduler/autoscaler"
+	"github.com/nakamasato/mini-kube-scheduler/controllers"
+	"github.com/nakamasato/mini-kube-scheduler/k8sapiserver"
+	"github.com/nakamasato/mini-kube-scheduler/kubelet"
+	"github.com/nakamasato/mini-kube-scheduler/minisched"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/simclock"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/trace"
+	"github.com/nakamasato/mini-kube-scheduler/nodelifecycle"
+	"github.com/nakamasato/mini-kube-scheduler/provisioner"
+	"github.com/nakamasato/mini-kube-scheduler/pvcontroller"
+	"github.com/nakamasato/mini-kube-scheduler/rebalancer"
+	"github.com/nakamasato/mini-kube-scheduler/scheduler"
+	"github.com/nakamasato/mini-kube-scheduler/scheduler/defaultconfig"
+)
+
+var ErrEmptyEtcdURL = errors.New("etcd URL is needed, but empty")
+
+// simulatorOptions has the options to start the API server and the scheduler.
+type simulatorOptions struct {
+	etcdURL           string
+	embeddedEtcd      bool
+	listenAddress     string
+	schedulerConfig   string
+	kubeconfigOut     string
+	traceOut          string
+	virtualClock      bool
+	minisched         minischedOptions
+	provisioner       provisioner.Options
+	controllers       []string
+	nodeLifecycle     bool
+	nodeLifecycleOpts nodelifecycle.Options
+	autoscalerConfig  string
+	rebalancer        bool
+	rebalancerOpts    rebalancer.Options
+	fakeKubelet       bool
+	kubelet           kubelet.Options
+}
+
+func (o *simulatorOptions) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.etcdURL, "etcd-url", os.Getenv("KUBE_SCHEDULER_SIMULATOR_ETCD_URL"), "URL of etcd used by API server. Defaults to KUBE_SCHEDULER_SIMULATOR_ETCD_URL.")
+	fs.BoolVar(&o.embeddedEtcd, "embedded-etcd", false, "Run etcd in-process instead of using --etcd-url. The data is removed on shutdown.")
+	fs.StringVar(&o.listenAddress, "listen-address", "", "Address for API server to listen on (e.g. 127.0.0.1:8080). A random port is used if empty.")
+	fs.StringVar(&o.schedulerConfig, "config", "", "Path to KubeSchedulerConfiguration (v1beta2) file. The default configuration is used if empty.")
+	fs.StringVar(&o.kubeconfigOut, "kubeconfig-out", "", "Path to write kubeconfig to access API server with the privileged token (e.g. for kubectl). Nothing is written if empty.")
+	fs.StringVar(&o.traceOut, "trace-out", "", "Path to write the trace of the informer events and the scheduling decisions to, which can be replayed by the replay command. Nothing is recorded if empty.")
+	o.minisched.addFlags(fs)
+	defaultProvisioner := provisioner.DefaultOptions()
+	fs.StringSliceVar(&o.provisioner.Provisioners, "provisioners", defaultProvisioner.Provisioners, "Provisioners of StorageClasses whose PVCs are provisioned by the fake provisioner. \"*\" for all the StorageClasses supporting dynamic provisioning. Empty disables the fake provisioner.")
+	fs.StringSliceVar(&o.provisioner.TopologyKeys, "provisioner-topology-keys", defaultProvisioner.TopologyKeys, "Node labels to restrict the provisioned PVs to the topology of the selected node, used if the node has no CSINode with the topology keys of the provisioner.")
+	fs.StringSliceVar(&o.controllers, "controllers", nil, "Workload controllers of kube-controller-manager to run, which create the pods of the workloads. One or more of: "+strings.Join(controllers.KnownControllers(), ", ")+". \""+controllers.AllControllers+"\" for all of them. Empty runs none of them.")
+	defaultNodeLifecycle := nodelifecycle.DefaultOptions()
+	fs.BoolVar(&o.nodeLifecycle, "node-lifecycle", false, "Run the node lifecycle controller, which taints the nodes by their Ready condition (e.g. set by the nodeReadiness of scenarios) and evicts the pods which don't tolerate the NoExecute taints.")
+	fs.Int64Var(&o.nodeLifecycleOpts.DefaultNotReadyTolerationSeconds, "default-not-ready-toleration-seconds", defaultNodeLifecycle.DefaultNotReadyTolerationSeconds, "tolerationSeconds of the not-ready:NoExecute taint for the pods which don't tolerate it, like the flag of kube-apiserver.")
+	fs.Int64Var(&o.nodeLifecycleOpts.DefaultUnreachableTolerationSeconds, "default-unreachable-toleration-seconds", defaultNodeLifecycle.DefaultUnreachableTolerationSeconds, "tolerationSeconds of the unreachable:NoExecute taint for the pods which don't tolerate it, like the flag of kube-apiserver.")
+	fs.StringVar(&o.autoscalerConfig, "autoscaler-config", "", "Path to the config file of the node groups of the autoscaler, which creates nodes for the unschedulable pods. The autoscaler doesn't run if empty.")
+	defaultRebalancer := rebalancer.DefaultOptions()
+	fs.BoolVar(&o.rebalancer, "rebalancer", false, "Run the rebalancer, which evicts the pods on a node if another node scores higher by the score plugins of the scheduler, respecting PodDisruptionBudgets.")
+	fs.DurationVar(&o.rebalancerOpts.Interval, "rebalance-interval", defaultRebalancer.Interval, "Interval of the rebalancing runs.")
+	fs.Int64Var(&o.rebalancerOpts.Threshold, "rebalance-threshold", defaultRebalancer.Threshold, "How much the best other node must score higher than the current node of a pod for the rebalancer to evict the pod.")
+	fs.IntVar(&o.rebalancerOpts.MaxEvictionsPerRun, "rebalance-max-evictions", defaultRebalancer.MaxEvictionsPerRun, "Maximum number of the pods evicted in a rebalancing run. 0 means no limit.")
+	defaultKubelet := kubelet.DefaultOptions()
+	fs.BoolVar(&o.fakeKubelet, "fake-kubelet", false, "Run the fake kubelet, which makes the bound pods Running (and Succeeded after --kubelet-run-duration) without running containers.")
+	fs.DurationVar(&o.kubelet.StartupLatency, "kubelet-startup-latency", defaultKubelet.StartupLatency, "Time for the fake kubelet to make a bound pod Running.")
+	fs.Float64Var(&o.kubelet.FailureRate, "kubelet-failure-rate", defaultKubelet.FailureRate, "Probability (0-1) that a pod fails on startup with the fake kubelet.")
+	fs.DurationVar(&o.kubelet.RunDuration, "kubelet-run-duration", defaultKubelet.RunDuration, "Time for the fake kubelet to complete a running pod whose restartPolicy is not Always. 0 runs the pods forever. Overridden by the "+kubelet.RunDurationAnnotation+" annotation of each pod.")
+	fs.BoolVar(&o.virtualClock, "virtual-clock", false, "Run the scheduler, the fake kubelet, the node lifecycle controller, the provision delays of the autoscaler and the waits of scenarios on a virtual clock, which jumps to the next timer when the scheduler is idle, so that backoffs, unschedulable timeouts, permit delays and the others finish without waiting in real time.")
+}
+
+// minischedOptions has the options of minisched which are also used to replay traces.
+type minischedOptions struct {
+	tieBreak string
+	seed     int64
+}
+
+func (o *minischedOptions) addFlags(fs *pflag.FlagSet) {
+	strategies := make([]string, 0, len(minisched.TieBreakStrategies))
+	for _, s := range minisched.TieBreakStrategies {
+		strategies = append(strategies, string(s))
+	}
+	fs.StringVar(&o.tieBreak, "tie-break", string(minisched.TieBreakRandom), "How to choose a node among the nodes with the highest score. One of: "+strings.Join(strategies, ", ")+".")
+	fs.Int64Var(&o.seed, "seed", 0, "Seed of the random number generator of the scheduler. Seeded from the current time if 0.")
+}
+
+func (o *minischedOptions) options() []minisched.Option {
+	opts := []minisched.Option{minisched.WithTieBreak(minisched.TieBreakStrategy(o.tieBreak))}
+	if o.seed != 0 {
+		opts = append(opts, minisched.WithRandomSeed(o.seed))
+	}
+	return opts
+}
+
+// simulator is the running API server, controllers and scheduler.
+type simulator struct {
+	client clientset.Interface
+	sched  *scheduler.Service
+	// clock is shared by the scheduler and the other components, which is virtual with --virtual-clock.
+	clock    clock.WithDelayedExecution
+	shutdown func()
+}
+
+// startSimulator starts API server, the PV controller, the fake provisioner, the workload controllers, the node lifecycle controller, the fake kubelet (if enabled), scheduler, the autoscaler and the rebalancer (if enabled).
+// If one of them fails to start, the ones started are shut down in the reverse order.
+func startSimulator(o *simulatorOptions) (_ *simulator, err error) {
+	if o.etcdURL == "" && !o.embeddedEtcd {
+		return nil, xerrors.Errorf("get etcd URL from --etcd-url or KUBE_SCHEDULER_SIMULATOR_ETCD_URL, or use --embedded-etcd: %w", ErrEmptyEtcdURL)
+	}
+
+	sc, err := schedulerConfig(o.schedulerConfig)
+	if err != nil {
+		return nil, xerrors.Errorf("create scheduler config: %w", err)
+	}
+	var autoscalerCfg *autoscaler.Config
+	if o.autoscalerConfig != "" {
+		autoscalerCfg, err = autoscaler.LoadConfig(o.autoscalerConfig)
+		if err != nil {
+			return nil, xerrors.Errorf("load autoscaler config: %w", err)
+		}
+	}
+
+	// shutdowns are the shutdown functions of the started components in the order of starting.
+	var shutdowns []func()
+	shutdown := func() {
+		for i := len(shutdowns) - 1; i >= 0; i-- {
+			shutdowns[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			shutdown()
+		}
+	}()
+
+	restclientCfg, apiShutdown, err := k8sapiserver.StartAPIServer(k8sapiserver.Options{
+		EtcdURL:        o.etcdURL,
+		EmbeddedEtcd:   o.embeddedEtcd,
+		ListenAddress:  o.listenAddress,
+		KubeconfigPath: o.kubeconfigOut,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("start API server: %w", err)
+	}
+	shutdowns = append(shutdowns, apiShutdown)
+	klog.Infof("API server is running on %s", restclientCfg.Host)
+
+	client := clientset.NewForConfigOrDie(restclientCfg)
+
+	// The PV controller binds the claims to the volumes, including those chosen by the VolumeBinding plugin
+	// and those created by the fake provisioner.
+	pvShutdown, err := pvcontroller.StartPersistentVolumeController(client)
+	if err != nil {
+		return nil, xerrors.Errorf("start pv controller: %w", err)
+	}
+	shutdowns = append(shutdowns, pvShutdown)
+	if len(o.provisioner.Provisioners) > 0 {
+		provisionerShutdown, err := provisioner.StartProvisioner(client, o.provisioner)
+		if err != nil {
+			return nil, xerrors.Errorf("start provisioner: %w", err)
+		}
+		shutdowns = append(shutdowns, provisionerShutdown)
+	}
+	if len(o.controllers) > 0 {
+		controllersShutdown, err := controllers.StartControllers(client, o.controllers)
+		if err != nil {
+			return nil, xerrors.Errorf("start controllers: %w", err)
+		}
+		shutdowns = append(shutdowns, controllersShutdown)
+	}
+	var clk clock.WithDelayedExecution = clock.RealClock{}
+	if o.virtualClock {
+		clk = simclock.New(time.Now())
+	}
+
+	if o.nodeLifecycle {
+		nodeLifecycleShutdown, err := nodelifecycle.StartNodeLifecycleController(client, o.nodeLifecycleOpts, clk)
+		if err != nil {
+			return nil, xerrors.Errorf("start node lifecycle controller: %w", err)
+		}
+		shutdowns = append(shutdowns, nodeLifecycleShutdown)
+	}
+
+	schedOpts := append(o.minisched.options(), minisched.WithClock(clk))
+	if o.fakeKubelet {
+		kubeletShutdown, err := kubelet.StartKubelet(client, o.kubelet, clk)
+		if err != nil {
+			return nil, xerrors.Errorf("start kubelet: %w", err)
+		}
+		shutdowns = append(shutdowns, kubeletShutdown)
+	}
+
+	if o.traceOut != "" {
+		f, err := os.Create(o.traceOut)
+		if err != nil {
+			return nil, xerrors.Errorf("create trace file: %w", err)
+		}
+		w := trace.NewWriter(f)
+		schedOpts = append(schedOpts, minisched.WithTraceRecorder(w))
+		shutdowns = append(shutdowns, func() {
+			if err := w.Err(); err != nil {
+				klog.Errorf("failed to write trace: %v", err)
+			}
+			if err := f.Close(); err != nil {
+				klog.Errorf("failed to close trace file: %v", err)
+			}
+		})
+	}
+
+	sched := scheduler.NewSchedulerService(client, restclientCfg, schedOpts...)
+	if err := sched.StartScheduler(sc); err != nil {
+		return nil, xerrors.Errorf("start scheduler: %w", err)
+	}
+	shutdowns = append(shutdowns, sched.ShutdownScheduler)
+	// The autoscaler runs the what-if checks of the scale-ups with the filter plugins of the scheduler.
+	if autoscalerCfg != nil {
+		autoscalerShutdown, err := autoscaler.StartAutoscaler(client, sched, autoscalerCfg, clk)
+		if err != nil {
+			return nil, xerrors.Errorf("start autoscaler: %w", err)
+		}
+		shutdowns = append(shutdowns, autoscalerShutdown)
+	}
+	// The rebalancer scores the nodes for the pods on them with the score plugins of the scheduler.
+	if o.rebalancer {
+		rebalancerShutdown, err := rebalancer.StartRebalancer(client, sched, o.rebalancerOpts)
+		if err != nil {
+			return nil, xerrors.Errorf("start rebalancer: %w", err)
+		}
+		shutdowns = append(shutdowns, rebalancerShutdown)
+	}
+
+	return &simulator{
+		client:   client,
+		sched:    sched,
+		clock:    clk,
+		shutdown: shutdown,
+	}, nil
+}
+
+func schedulerConfig(path string) (*v1beta2config.KubeSchedulerConfiguration, error) {
+	if path == "" {
+		return defaultconfig.DefaultSchedulerConfig()
+	}
+	return scheduler.LoadSchedulerConfig(path)
+}
+
+// newClientFromKubeconfig creates a client to access API server described in the kubeconfig.
+func newClientFromKubeconfig(path string) (clientset.Interface, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", path)
+	if err != nil {
+		return nil, xerrors.Errorf("load kubeconfig %s: %w", path, err)
+	}
+	client, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		return nil, xerrors.Errorf("create clientset: %w", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"golang.org/x/xerrors"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog"
+	"k8s.io/kubernetes/pkg/controller/daemon"
+	"k8s.io/kubernetes/pkg/controller/deployment"
+	"k8s.io/kubernetes/pkg/controller/job"
+	"k8s.io/kubernetes/pkg/controller/replicaset"
+)
+
+// AllControllers is the name to start all the known controllers.
+const AllControllers = "*"
+
+// initFunc creates a controller with the informers and returns the function to run it.
+type initFunc func(client clientset.Interface, informerFactory informers.SharedInformerFactory) (func(ctx context.Context), error)
+
+// knownControllers are the workload controllers of kube-controller-manager which can run in the simulator,
+// keyed by the same names as the --controllers flag of kube-controller-manager.
+// The number of workers is the default of kube-controller-manager.
+var knownControllers = map[string]initFunc{
+	"replicaset": func(client clientset.Interface, informerFactory informers.SharedInformerFactory) (func(ctx context.Context), error) {
+		c := replicaset.NewReplicaSetController(
+			informerFactory.Apps().V1().ReplicaSets(),
+			informerFactory.Core().V1().Pods(),
+			client,
+			replicaset.BurstReplicas,
+		)
+		return func(ctx context.Context) { c.Run(ctx, 5) }, nil
+	},
+	"deployment": func(client clientset.Interface, informerFactory informers.SharedInformerFactory) (func(ctx context.Context), error) {
+		c, err := deployment.NewDeploymentController(
+			informerFactory.Apps().V1().Deployments(),
+			informerFactory.Apps().V1().ReplicaSets(),
+			informerFactory.Core().V1().Pods(),
+			client,
+		)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) { c.Run(ctx, 5) }, nil
+	},
+	"job": func(client clientset.Interface, informerFactory informers.SharedInformerFactory) (func(ctx context.Context), error) {
+		c := job.NewController(
+			informerFactory.Core().V1().Pods(),
+			informerFactory.Batch().V1().Jobs(),
+			client,
+		)
+		return func(ctx context.Context) { c.Run(ctx, 5) }, nil
+	},
+	"daemonset": func(client clientset.Interface, informerFactory informers.SharedInformerFactory) (func(ctx context.Context), error) {
+		c, err := daemon.NewDaemonSetsController(
+			informerFactory.Apps().V1().DaemonSets(),
+			informerFactory.Apps().V1().ControllerRevisions(),
+			informerFactory.Core().V1().Pods(),
+			informerFactory.Core().V1().Nodes(),
+			client,
+			flowcontrol.NewBackOff(1*time.Second, 15*time.Minute),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) { c.Run(ctx, 2) }, nil
+	},
+}
+
+// KnownControllers returns the sorted names of the controllers which can be passed to StartControllers.
+func KnownControllers() []string {
+	names := make([]string, 0, len(knownControllers))
+	for name := range knownControllers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartControllers starts the upstream workload controllers of the names (or all of them by AllControllers)
+// with their own informers, and returns the function to stop them.
+// The controllers create and delete the pods of the workloads as kube-controller-manager does,
+// so that the pods are scheduled by the scheduler of the simulator.
+// Note that the garbage collector doesn't run, so the pods are not deleted with their owners.
+func StartControllers(client clientset.Interface, names []string) (func(), error) {
+	names, err := resolveNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	runs := make([]func(ctx context.Context), 0, len(names))
+	for _, name := range names {
+		run, err := knownControllers[name](client, informerFactory)
+		if err != nil {
+			cancel()
+			return nil, xerrors.Errorf("create %s controller: %w", name, err)
+		}
+		runs = append(runs, run)
+	}
+
+	informerFactory.Start(ctx.Done())
+	for typ, synced := range informerFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			cancel()
+			return nil, xerrors.Errorf("wait for cache sync of %v", typ)
+		}
+	}
+
+	for _, run := range runs {
+		go run(ctx)
+	}
+	klog.Infof("controllers: started %v", names)
+
+	return cancel, nil
+}
+
+// resolveNames expands AllControllers and checks that all the names are known.
+func resolveNames(names []string) ([]string, error) {
+	var resolved []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		if name == AllControllers {
+			return KnownControllers(), nil
+		}
+		if _, ok := knownControllers[name]; !ok {
+			return nil, xerrors.Errorf("unknown controller %q, must be one of %v or %q", name, KnownControllers(), AllControllers)
+		}
+		if !seen[name] {
+			seen[name] = true
+			resolved = append(resolved, name)
+		}
+	}
+	return resolved, nil
+}
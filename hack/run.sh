@@ -33,4 +33,4 @@ trap cleanup_etcd EXIT
 
 start_etcd
 
-./bin/sched
+./bin/sched run-scenario "${SCENARIO:-scenarios/nodenumber.yaml}" "$@"
@@ -0,0 +1,87 @@
+package k8sapiserver
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+	"golang.org/x/xerrors"
+	"k8s.io/klog"
+)
+
+const embeddedEtcdStartTimeout = 60 * time.Second
+
+// StartEmbeddedEtcd starts etcd in-process with a temporary data directory and free local ports.
+// It returns the client URL and the function to stop etcd and remove the data directory.
+// Each API server uses its own storage prefix, so API servers started with the URL (e.g. in tests) don't share
+// the resources.
+func StartEmbeddedEtcd() (string, func(), error) {
+	dir, err := os.MkdirTemp("", "mini-kube-scheduler-etcd")
+	if err != nil {
+		return "", nil, xerrors.Errorf("create etcd data dir: %w", err)
+	}
+
+	ports, err := getAvailablePorts(2)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, xerrors.Errorf("get available ports: %w", err)
+	}
+	clientURL := url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(ports[0]))}
+	peerURL := url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(ports[1]))}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LPUrls = []url.URL{peerURL}
+	cfg.APUrls = []url.URL{peerURL}
+	cfg.LCUrls = []url.URL{clientURL}
+	cfg.ACUrls = []url.URL{clientURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	// The data is thrown away on shutdown, so we don't need fsync.
+	cfg.UnsafeNoFsync = true
+	cfg.LogLevel = "error"
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, xerrors.Errorf("start etcd: %w", err)
+	}
+
+	shutdownFunc := func() {
+		klog.Infof("destroying embedded etcd")
+		e.Close()
+		os.RemoveAll(dir)
+		klog.Infof("destroyed embedded etcd")
+	}
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(embeddedEtcdStartTimeout):
+		shutdownFunc()
+		return "", nil, xerrors.Errorf("etcd took too long to start")
+	}
+	go func() {
+		if err := <-e.Err(); err != nil {
+			klog.Errorf("embedded etcd: %v", err)
+		}
+	}()
+
+	return clientURL.String(), shutdownFunc, nil
+}
+
+// getAvailablePorts returns TCP ports that are available for binding.
+func getAvailablePorts(count int) ([]int, error) {
+	ports := make([]int, 0, count)
+	for i := 0; i < count; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, xerrors.Errorf("bind to a port: %w", err)
+		}
+		// It is possible but unlikely that someone else will bind this port before etcd uses it.
+		defer l.Close()
+		ports = append(ports, l.Addr().(*net.TCPAddr).Port)
+	}
+	return ports, nil
+}
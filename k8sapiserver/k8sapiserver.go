@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,6 +28,8 @@ import (
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/component-base/version"
 	"k8s.io/klog"
 	openapicommon "k8s.io/kube-openapi/pkg/common"
@@ -39,23 +42,64 @@ import (
 	generated "github.com/nakamasato/mini-kube-scheduler/k8sapiserver/openapi"
 )
 
+// Options is the options to start API server.
+type Options struct {
+	// EtcdURL is the URL of etcd used as the storage of API server.
+	EtcdURL string
+	// EmbeddedEtcd starts etcd in-process instead of using EtcdURL.
+	// The etcd and its data are removed when API server is shut down.
+	EmbeddedEtcd bool
+	// ListenAddress is the address for API server to listen on (e.g. "127.0.0.1:8080").
+	// A random local port is used if empty.
+	ListenAddress string
+	// KubeconfigPath is the path to write kubeconfig to access API server with the privileged loopback token.
+	// Nothing is written if empty.
+	KubeconfigPath string
+}
+
 // StartAPIServer starts API server, and it make panic when a error happen.
-func StartAPIServer(etcdURL string) (*restclient.Config, func(), error) {
+// The returned config has the privileged loopback token.
+func StartAPIServer(opts Options) (*restclient.Config, func(), error) {
+	etcdURL := opts.EtcdURL
+	etcdShutdown := func() {}
+	if opts.EmbeddedEtcd {
+		url, shutdown, err := StartEmbeddedEtcd()
+		if err != nil {
+			return nil, nil, xerrors.Errorf("start embedded etcd: %w", err)
+		}
+		klog.Infof("embedded etcd is running on %s", url)
+		etcdURL, etcdShutdown = url, shutdown
+	}
+
 	h := &APIServerHolder{Initialized: make(chan struct{})}
-	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		<-h.Initialized
 		h.M.GenericAPIServer.Handler.ServeHTTP(w, req)
 	}))
+	if opts.ListenAddress != "" {
+		l, err := net.Listen("tcp", opts.ListenAddress)
+		if err != nil {
+			s.Close()
+			etcdShutdown()
+			return nil, nil, xerrors.Errorf("listen on %s: %w", opts.ListenAddress, err)
+		}
+		s.Listener.Close()
+		s.Listener = l
+	}
+	s.Start()
+	serverURL := clientURL(s.Listener.Addr())
 
-	c := NewControlPlaneConfigWithOptions(s.URL, etcdURL)
+	c := NewControlPlaneConfigWithOptions(serverURL, etcdURL)
 
 	_, _, closeFn, err := startAPIServer(c, s, h)
 	if err != nil {
+		etcdShutdown()
 		return nil, nil, xerrors.Errorf("start API server: %w", err)
 	}
 
 	cfg := &restclient.Config{
-		Host:          s.URL,
+		Host:          serverURL,
+		BearerToken:   c.GenericConfig.LoopbackClientConfig.BearerToken,
 		ContentConfig: restclient.ContentConfig{GroupVersion: &schema.GroupVersion{Group: "", Version: "v1"}},
 		QPS:           5000.0,
 		Burst:         5000,
@@ -66,10 +110,42 @@ func StartAPIServer(etcdURL string) (*restclient.Config, func(), error) {
 		closeFn()
 		s.Close()
 		klog.Infof("destroyed API server")
+		etcdShutdown()
 	}
+
+	if opts.KubeconfigPath != "" {
+		if err := WriteKubeconfig(opts.KubeconfigPath, cfg); err != nil {
+			shutdownFunc()
+			return nil, nil, xerrors.Errorf("write kubeconfig: %w", err)
+		}
+		klog.Infof("kubeconfig is written to %s", opts.KubeconfigPath)
+	}
+
 	return cfg, shutdownFunc, nil
 }
 
+// clientURL returns the URL for clients to access the listener.
+// The loopback address is used if the listener listens on all interfaces (e.g. ":8080").
+func clientURL(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || !tcpAddr.IP.IsUnspecified() {
+		return "http://" + addr.String()
+	}
+	return "http://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(tcpAddr.Port))
+}
+
+// WriteKubeconfig writes kubeconfig which has a context named "mini-kube-scheduler" to access API server with cfg.
+func WriteKubeconfig(path string, cfg *restclient.Config) error {
+	const name = "mini-kube-scheduler"
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters[name] = &clientcmdapi.Cluster{Server: cfg.Host}
+	kubeconfig.AuthInfos[name] = &clientcmdapi.AuthInfo{Token: cfg.BearerToken}
+	kubeconfig.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name}
+	kubeconfig.CurrentContext = name
+
+	return clientcmd.WriteToFile(*kubeconfig, path)
+}
+
 func defaultOpenAPIConfig() *openapicommon.Config {
 	openAPIConfig := genericapiserver.DefaultOpenAPIConfig(generated.GetOpenAPIDefinitions, openapi.NewDefinitionNamer(legacyscheme.Scheme))
 	openAPIConfig.Info = &spec.Info{
@@ -178,6 +254,7 @@ func (fakeLocalhost443Listener) Addr() net.Addr {
 }
 
 // startAPIServer starts a kubernetes API server and an httpserver to handle api requests.
+//
 //nolint:funlen
 func startAPIServer(controlPlaneConfig *controlplane.Config, s *httptest.Server, apiServerReceiver *APIServerHolder) (*controlplane.Instance, *httptest.Server, func(), error) {
 	var m *controlplane.Instance
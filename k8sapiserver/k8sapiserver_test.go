@@ -0,0 +1,55 @@
+package k8sapiserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+func TestStartAPIServer_EmbeddedEtcd(t *testing.T) {
+	// the data directory of etcd is created under TMPDIR, so that we can check it's removed on shutdown.
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	cfg, shutdown, err := StartAPIServer(Options{EmbeddedEtcd: true})
+	if err != nil {
+		t.Fatalf("StartAPIServer: %v", err)
+	}
+
+	dataDirs, err := filepath.Glob(filepath.Join(tmpDir, "mini-kube-scheduler-etcd*"))
+	if err != nil {
+		shutdown()
+		t.Fatalf("glob etcd data dirs: %v", err)
+	}
+	if len(dataDirs) != 1 {
+		shutdown()
+		t.Fatalf("etcd data dirs = %v, want exactly one", dataDirs)
+	}
+
+	client := clientset.NewForConfigOrDie(cfg)
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	if _, err := client.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{}); err != nil {
+		shutdown()
+		t.Fatalf("create node: %v", err)
+	}
+	got, err := client.CoreV1().Nodes().Get(context.Background(), "node1", metav1.GetOptions{})
+	if err != nil {
+		shutdown()
+		t.Fatalf("get node: %v", err)
+	}
+	if got.UID == "" {
+		shutdown()
+		t.Fatalf("node has no UID: %+v", got)
+	}
+
+	shutdown()
+
+	if _, err := os.Stat(dataDirs[0]); !os.IsNotExist(err) {
+		t.Errorf("etcd data dir %s still exists after shutdown: %v", dataDirs[0], err)
+	}
+}
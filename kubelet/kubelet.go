@@ -0,0 +1,487 @@
+package kubelet
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+	"k8s.io/utils/clock"
+)
+
+// RunDurationAnnotation is the annotation of a pod to override Options.RunDuration (e.g. "30s").
+const RunDurationAnnotation = "simulator/run-duration"
+
+// Options is the options of Kubelet.
+type Options struct {
+	// StartupLatency is the time from the pod being bound to running.
+	StartupLatency time.Duration
+	// FailureRate is the probability (0-1) that a pod fails on startup instead of running.
+	FailureRate float64
+	// RunDuration is the time from running to completion of the pods whose restartPolicy is not Always.
+	// The pods run forever if 0. It's overridden by RunDurationAnnotation of each pod.
+	RunDuration time.Duration
+	// Seed is the seed of the random number generator to decide the failures. Seeded from the current time if 0.
+	Seed int64
+}
+
+// DefaultOptions returns the options with which the pods start in a second and run forever.
+func DefaultOptions() Options {
+	return Options{
+		StartupLatency: time.Second,
+	}
+}
+
+// Kubelet is a fake node agent of all the nodes in the simulator. It doesn't run containers, but updates the status of
+// the pods bound to the nodes like kubelet:
+//   - a bound pod gets the start time, and after Options.StartupLatency, the Running phase with the Ready conditions,
+//     the pod IP and the running container statuses, or the Failed phase by Options.FailureRate.
+//   - a running pod whose restartPolicy is not Always completes (the Succeeded phase) after its run duration.
+//   - a pod being deleted gracefully is deleted at once, as if its containers are stopped.
+type Kubelet struct {
+	client clientset.Interface
+	opts   Options
+	clock  clock.WithDelayedExecution
+
+	podLister  corelisters.PodLister
+	nodeLister corelisters.NodeLister
+
+	queue workqueue.RateLimitingInterface
+
+	// mu protects the fields below.
+	mu sync.Mutex
+	// startAt is the time to start each pod bound but not started yet.
+	startAt map[types.UID]time.Time
+	// podIPs allocates the pod IPs of each node.
+	podIPs map[string]*ipAllocator
+	rand   *rand.Rand
+}
+
+// StartKubelet starts Kubelet with its own informers, and returns the function to stop it.
+// clk is the clock for the startup latency and the run duration, e.g. the virtual clock of the scheduler.
+func StartKubelet(client clientset.Interface, opts Options, clk clock.WithDelayedExecution) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	k := New(client, informerFactory, opts, clk)
+
+	informerFactory.Start(ctx.Done())
+	for typ, synced := range informerFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			cancel()
+			return nil, xerrors.Errorf("wait for cache sync of %v", typ)
+		}
+	}
+
+	go k.Run(ctx)
+
+	return cancel, nil
+}
+
+// New creates Kubelet and registers its event handlers to the informers.
+func New(client clientset.Interface, informerFactory informers.SharedInformerFactory, opts Options, clk clock.WithDelayedExecution) *Kubelet {
+	seed := time.Now().UnixNano()
+	if opts.Seed != 0 {
+		seed = opts.Seed
+	}
+	k := &Kubelet{
+		client:     client,
+		opts:       opts,
+		clock:      clk,
+		podLister:  informerFactory.Core().V1().Pods().Lister(),
+		nodeLister: informerFactory.Core().V1().Nodes().Lister(),
+		queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "kubelet"),
+		startAt:    map[types.UID]time.Time{},
+		podIPs:     map[string]*ipAllocator{},
+		rand:       rand.New(rand.NewSource(seed)),
+	}
+
+	informerFactory.Core().V1().Pods().Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = d.Obj
+			}
+			pod, ok := obj.(*v1.Pod)
+			return ok && pod.Spec.NodeName != ""
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    k.enqueuePod,
+			UpdateFunc: func(_, newObj interface{}) { k.enqueuePod(newObj) },
+			DeleteFunc: k.deletePodFromCache,
+		},
+	})
+
+	return k
+}
+
+// Run runs the worker until ctx is done.
+func (k *Kubelet) Run(ctx context.Context) {
+	defer k.queue.ShutDown()
+
+	klog.Info("kubelet: starting")
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for k.processNextItem(ctx) {
+		}
+	}, time.Second)
+
+	<-ctx.Done()
+	klog.Info("kubelet: shutting down")
+}
+
+// processNextItem syncs the next pod in the queue. The pod is retried with backoff if the sync fails.
+// It returns false if the queue is shut down.
+func (k *Kubelet) processNextItem(ctx context.Context) bool {
+	key, quit := k.queue.Get()
+	if quit {
+		return false
+	}
+	defer k.queue.Done(key)
+
+	if err := k.syncPod(ctx, key.(string)); err != nil {
+		klog.Warningf("kubelet: failed to sync pod %v, retrying: %v", key, err)
+		k.queue.AddRateLimited(key)
+		return true
+	}
+	k.queue.Forget(key)
+	return true
+}
+
+func (k *Kubelet) enqueuePod(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("kubelet: failed to get key of pod: %v", err)
+		return
+	}
+	k.queue.Add(key)
+}
+
+func (k *Kubelet) deletePodFromCache(obj interface{}) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	if pod, ok := obj.(*v1.Pod); ok {
+		k.forget(pod)
+	}
+}
+
+// syncPod moves the pod to the next phase if it's time, or requeues it to the time.
+func (k *Kubelet) syncPod(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return xerrors.Errorf("split key %s: %w", key, err)
+	}
+	pod, err := k.podLister.Pods(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("get pod %s: %w", key, err)
+	}
+
+	if pod.DeletionTimestamp != nil {
+		return k.deletePod(ctx, pod)
+	}
+
+	switch pod.Status.Phase {
+	case v1.PodSucceeded, v1.PodFailed:
+		k.forget(pod)
+		return nil
+	case v1.PodRunning:
+		return k.syncRunningPod(ctx, key, pod)
+	default:
+		return k.syncPendingPod(ctx, key, pod)
+	}
+}
+
+// syncPendingPod sets the start time of the pod, and then runs it after the startup latency.
+func (k *Kubelet) syncPendingPod(ctx context.Context, key string, pod *v1.Pod) error {
+	now := k.clock.Now()
+
+	k.mu.Lock()
+	startAt, ok := k.startAt[pod.UID]
+	if !ok {
+		startAt = now.Add(k.opts.StartupLatency)
+		k.startAt[pod.UID] = startAt
+	}
+	k.mu.Unlock()
+
+	if pod.Status.StartTime == nil {
+		pod = pod.DeepCopy()
+		startTime := metav1.NewTime(now)
+		pod.Status.StartTime = &startTime
+		if _, err := k.client.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+			return xerrors.Errorf("update status of pod %s: %w", key, err)
+		}
+		// the update event syncs the pod again.
+		return nil
+	}
+
+	if wait := startAt.Sub(now); wait > 0 {
+		k.enqueueAfter(key, wait)
+		return nil
+	}
+
+	if k.fails() {
+		if err := k.updateStatus(ctx, pod, failedStatus(pod, now)); err != nil {
+			return err
+		}
+		klog.Infof("kubelet: pod %s failed on node %s", key, pod.Spec.NodeName)
+		k.forget(pod)
+		return nil
+	}
+
+	podIP, hostIP, err := k.podIP(pod)
+	if err != nil {
+		return err
+	}
+	if err := k.updateStatus(ctx, pod, runningStatus(pod, now, podIP, hostIP)); err != nil {
+		return err
+	}
+	klog.Infof("kubelet: pod %s is running on node %s", key, pod.Spec.NodeName)
+	k.forget(pod)
+	return nil
+}
+
+// syncRunningPod completes the pod after its run duration.
+func (k *Kubelet) syncRunningPod(ctx context.Context, key string, pod *v1.Pod) error {
+	if pod.Spec.RestartPolicy == v1.RestartPolicyAlways {
+		return nil
+	}
+	duration, err := k.runDuration(pod)
+	if err != nil {
+		klog.Warningf("kubelet: ignore invalid annotation %s of pod %s: %v", RunDurationAnnotation, key, err)
+		duration = k.opts.RunDuration
+	}
+	if duration <= 0 {
+		return nil
+	}
+
+	runningSince := pod.CreationTimestamp.Time
+	if c := podCondition(pod, v1.PodReady); c != nil {
+		runningSince = c.LastTransitionTime.Time
+	}
+	now := k.clock.Now()
+	if wait := runningSince.Add(duration).Sub(now); wait > 0 {
+		k.enqueueAfter(key, wait)
+		return nil
+	}
+
+	if err := k.updateStatus(ctx, pod, succeededStatus(pod, now)); err != nil {
+		return err
+	}
+	klog.Infof("kubelet: pod %s completed on node %s", key, pod.Spec.NodeName)
+	return nil
+}
+
+// deletePod deletes the pod being deleted gracefully at once, as kubelet does after stopping the containers.
+func (k *Kubelet) deletePod(ctx context.Context, pod *v1.Pod) error {
+	k.forget(pod)
+	err := k.client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+		GracePeriodSeconds: new(int64),
+		Preconditions:      metav1.NewUIDPreconditions(string(pod.UID)),
+	})
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		return xerrors.Errorf("delete pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
+
+// enqueueAfter adds the key to the queue after d on the clock. workqueue's AddAfter isn't used because it waits
+// in real time.
+func (k *Kubelet) enqueueAfter(key string, d time.Duration) {
+	k.clock.AfterFunc(d, func() {
+		k.queue.Add(key)
+	})
+}
+
+func (k *Kubelet) updateStatus(ctx context.Context, pod *v1.Pod, status v1.PodStatus) error {
+	pod = pod.DeepCopy()
+	pod.Status = status
+	if _, err := k.client.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+		return xerrors.Errorf("update status of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
+
+func (k *Kubelet) forget(pod *v1.Pod) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.startAt, pod.UID)
+}
+
+func (k *Kubelet) fails() bool {
+	if k.opts.FailureRate <= 0 {
+		return false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.rand.Float64() < k.opts.FailureRate
+}
+
+func (k *Kubelet) runDuration(pod *v1.Pod) (time.Duration, error) {
+	v, ok := pod.Annotations[RunDurationAnnotation]
+	if !ok {
+		return k.opts.RunDuration, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// podIP returns the IP of the pod and the node. The pod IP is the node IP if the pod uses the host network.
+func (k *Kubelet) podIP(pod *v1.Pod) (string, string, error) {
+	node, err := k.nodeLister.Get(pod.Spec.NodeName)
+	if err != nil {
+		return "", "", xerrors.Errorf("get node %s: %w", pod.Spec.NodeName, err)
+	}
+	hostIP := nodeIP(node)
+	if pod.Spec.HostNetwork {
+		return hostIP, hostIP, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	a, ok := k.podIPs[node.Name]
+	if !ok {
+		a = newIPAllocator(node, len(k.podIPs))
+		k.podIPs[node.Name] = a
+	}
+	return a.next(), hostIP, nil
+}
+
+// nodeIP returns the internal IP of the node, or the first address if it has no internal IP.
+func nodeIP(node *v1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	if len(node.Status.Addresses) > 0 {
+		return node.Status.Addresses[0].Address
+	}
+	return ""
+}
+
+// ipAllocator allocates the IPs in a /24 subnet in turn. The IPs are not released, but reused after wrapping around.
+type ipAllocator struct {
+	base net.IP
+	last int
+}
+
+// newIPAllocator returns the allocator of the IPv4 podCIDR of the node, or 10.244.<index>.0/24 if the node has none.
+func newIPAllocator(node *v1.Node, index int) *ipAllocator {
+	if _, cidr, err := net.ParseCIDR(node.Spec.PodCIDR); err == nil && cidr.IP.To4() != nil {
+		return &ipAllocator{base: cidr.IP.To4()}
+	}
+	return &ipAllocator{base: net.IPv4(10, 244, byte(index%256), 0).To4()}
+}
+
+func (a *ipAllocator) next() string {
+	a.last = a.last%254 + 1
+	ip := make(net.IP, len(a.base))
+	copy(ip, a.base)
+	ip[3] += byte(a.last)
+	return ip.String()
+}
+
+func runningStatus(pod *v1.Pod, now time.Time, podIP, hostIP string) v1.PodStatus {
+	status := *pod.Status.DeepCopy()
+	status.Phase = v1.PodRunning
+	status.HostIP = hostIP
+	status.PodIP = podIP
+	status.PodIPs = []v1.PodIP{{IP: podIP}}
+	for _, t := range []v1.PodConditionType{v1.PodInitialized, v1.ContainersReady, v1.PodReady} {
+		setPodCondition(&status, v1.PodCondition{Type: t, Status: v1.ConditionTrue}, now)
+	}
+	status.InitContainerStatuses = containerStatuses(pod, pod.Spec.InitContainers, v1.ContainerState{
+		Terminated: &v1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed", StartedAt: metav1.NewTime(now), FinishedAt: metav1.NewTime(now)},
+	}, false)
+	status.ContainerStatuses = containerStatuses(pod, pod.Spec.Containers, v1.ContainerState{
+		Running: &v1.ContainerStateRunning{StartedAt: metav1.NewTime(now)},
+	}, true)
+	return status
+}
+
+func failedStatus(pod *v1.Pod, now time.Time) v1.PodStatus {
+	status := *pod.Status.DeepCopy()
+	status.Phase = v1.PodFailed
+	status.Reason = "SimulatedFailure"
+	status.Message = "The pod failed on startup by the failure rate of the fake kubelet"
+	status.ContainerStatuses = containerStatuses(pod, pod.Spec.Containers, v1.ContainerState{
+		Terminated: &v1.ContainerStateTerminated{ExitCode: 1, Reason: "Error", StartedAt: metav1.NewTime(now), FinishedAt: metav1.NewTime(now)},
+	}, false)
+	return status
+}
+
+func succeededStatus(pod *v1.Pod, now time.Time) v1.PodStatus {
+	status := *pod.Status.DeepCopy()
+	status.Phase = v1.PodSucceeded
+	for _, t := range []v1.PodConditionType{v1.ContainersReady, v1.PodReady} {
+		setPodCondition(&status, v1.PodCondition{Type: t, Status: v1.ConditionFalse, Reason: "PodCompleted"}, now)
+	}
+	startedAt := metav1.NewTime(now)
+	if c := podCondition(pod, v1.PodReady); c != nil {
+		startedAt = c.LastTransitionTime
+	}
+	status.ContainerStatuses = containerStatuses(pod, pod.Spec.Containers, v1.ContainerState{
+		Terminated: &v1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed", StartedAt: startedAt, FinishedAt: metav1.NewTime(now)},
+	}, false)
+	return status
+}
+
+func containerStatuses(pod *v1.Pod, containers []v1.Container, state v1.ContainerState, ready bool) []v1.ContainerStatus {
+	if len(containers) == 0 {
+		return nil
+	}
+	statuses := make([]v1.ContainerStatus, 0, len(containers))
+	for _, c := range containers {
+		started := state.Running != nil
+		statuses = append(statuses, v1.ContainerStatus{
+			Name:        c.Name,
+			Image:       c.Image,
+			ImageID:     c.Image,
+			ContainerID: fmt.Sprintf("fake://%s/%s", pod.UID, c.Name),
+			State:       state,
+			Ready:       ready,
+			Started:     &started,
+		})
+	}
+	return statuses
+}
+
+func podCondition(pod *v1.Pod, t v1.PodConditionType) *v1.PodCondition {
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == t {
+			return &pod.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setPodCondition sets the condition in the status. The transition time is updated only if the status changes.
+func setPodCondition(status *v1.PodStatus, condition v1.PodCondition, now time.Time) {
+	condition.LastTransitionTime = metav1.NewTime(now)
+	for i := range status.Conditions {
+		if status.Conditions[i].Type != condition.Type {
+			continue
+		}
+		if status.Conditions[i].Status == condition.Status {
+			condition.LastTransitionTime = status.Conditions[i].LastTransitionTime
+		}
+		status.Conditions[i] = condition
+		return
+	}
+	status.Conditions = append(status.Conditions, condition)
+}
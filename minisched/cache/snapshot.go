@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// Snapshot is a snapshot of the nodes and the pods on them, taken at the beginning of a scheduling cycle.
+// It implements framework.SharedLister so that the plugins can see the pods on each node, like the snapshot
+// of the scheduler cache in kube-scheduler.
+type Snapshot struct {
+	// nodeInfoMap a map of node name to a snapshot of its NodeInfo.
+	nodeInfoMap map[string]*framework.NodeInfo
+	// nodeInfoList is the list of nodes in the order given to NewSnapshot.
+	nodeInfoList []*framework.NodeInfo
+	// havePodsWithAffinityNodeInfoList is the list of nodes with at least one pod declaring affinity terms.
+	havePodsWithAffinityNodeInfoList []*framework.NodeInfo
+	// havePodsWithRequiredAntiAffinityNodeInfoList is the list of nodes with at least one pod declaring
+	// required anti-affinity terms.
+	havePodsWithRequiredAntiAffinityNodeInfoList []*framework.NodeInfo
+}
+
+var _ framework.SharedLister = &Snapshot{}
+
+// NewEmptySnapshot initializes a Snapshot struct and returns it.
+func NewEmptySnapshot() *Snapshot {
+	return &Snapshot{
+		nodeInfoMap: make(map[string]*framework.NodeInfo),
+	}
+}
+
+// NewSnapshot initializes a Snapshot struct and returns it.
+// The pods whose Spec.NodeName is not one of the nodes are ignored.
+func NewSnapshot(pods []*v1.Pod, nodes []*v1.Node) *Snapshot {
+	imageExistenceMap := createImageExistenceMap(nodes)
+
+	s := NewEmptySnapshot()
+	s.nodeInfoList = make([]*framework.NodeInfo, 0, len(nodes))
+	for _, node := range nodes {
+		nodeInfo := framework.NewNodeInfo()
+		nodeInfo.SetNode(node)
+		nodeInfo.ImageStates = getNodeImageStates(node, imageExistenceMap)
+		s.nodeInfoMap[node.Name] = nodeInfo
+		s.nodeInfoList = append(s.nodeInfoList, nodeInfo)
+	}
+	for _, pod := range pods {
+		if nodeInfo, ok := s.nodeInfoMap[pod.Spec.NodeName]; ok {
+			nodeInfo.AddPod(pod)
+		}
+	}
+	for _, nodeInfo := range s.nodeInfoList {
+		if len(nodeInfo.PodsWithAffinity) > 0 {
+			s.havePodsWithAffinityNodeInfoList = append(s.havePodsWithAffinityNodeInfoList, nodeInfo)
+		}
+		if len(nodeInfo.PodsWithRequiredAntiAffinity) > 0 {
+			s.havePodsWithRequiredAntiAffinityNodeInfoList = append(s.havePodsWithRequiredAntiAffinityNodeInfoList, nodeInfo)
+		}
+	}
+
+	return s
+}
+
+// AddPod adds the pod to the NodeInfo of the node in its Spec.NodeName, e.g. to place pods one by one in a what-if
+// without taking the snapshot again.
+func (s *Snapshot) AddPod(pod *v1.Pod) error {
+	nodeInfo, ok := s.nodeInfoMap[pod.Spec.NodeName]
+	if !ok {
+		return fmt.Errorf("nodeinfo not found for node name %q", pod.Spec.NodeName)
+	}
+	hadAffinity := len(nodeInfo.PodsWithAffinity) > 0
+	hadRequiredAntiAffinity := len(nodeInfo.PodsWithRequiredAntiAffinity) > 0
+	nodeInfo.AddPod(pod)
+	if !hadAffinity && len(nodeInfo.PodsWithAffinity) > 0 {
+		s.havePodsWithAffinityNodeInfoList = append(s.havePodsWithAffinityNodeInfoList, nodeInfo)
+	}
+	if !hadRequiredAntiAffinity && len(nodeInfo.PodsWithRequiredAntiAffinity) > 0 {
+		s.havePodsWithRequiredAntiAffinityNodeInfoList = append(s.havePodsWithRequiredAntiAffinityNodeInfoList, nodeInfo)
+	}
+	return nil
+}
+
+// Update replaces the content of the snapshot with the given pods and nodes.
+// The snapshot is updated in place because the plugins keep the SharedLister given at their creation.
+func (s *Snapshot) Update(pods []*v1.Pod, nodes []*v1.Node) {
+	*s = *NewSnapshot(pods, nodes)
+}
+
+// getNodeImageStates returns the given node's image states based on the given imageExistence map.
+func getNodeImageStates(node *v1.Node, imageExistenceMap map[string]sets.String) map[string]*framework.ImageStateSummary {
+	imageStates := make(map[string]*framework.ImageStateSummary)
+
+	for _, image := range node.Status.Images {
+		for _, name := range image.Names {
+			imageStates[name] = &framework.ImageStateSummary{
+				Size:     image.SizeBytes,
+				NumNodes: len(imageExistenceMap[name]),
+			}
+		}
+	}
+	return imageStates
+}
+
+// createImageExistenceMap returns a map recording on which nodes the images exist, keyed by the images' names.
+func createImageExistenceMap(nodes []*v1.Node) map[string]sets.String {
+	imageExistenceMap := make(map[string]sets.String)
+	for _, node := range nodes {
+		for _, image := range node.Status.Images {
+			for _, name := range image.Names {
+				if _, ok := imageExistenceMap[name]; !ok {
+					imageExistenceMap[name] = sets.NewString(node.Name)
+				} else {
+					imageExistenceMap[name].Insert(node.Name)
+				}
+			}
+		}
+	}
+	return imageExistenceMap
+}
+
+// NodeInfos returns a NodeInfoLister.
+func (s *Snapshot) NodeInfos() framework.NodeInfoLister {
+	return s
+}
+
+// NumNodes returns the number of nodes in the snapshot.
+func (s *Snapshot) NumNodes() int {
+	return len(s.nodeInfoList)
+}
+
+// List returns the list of nodes in the snapshot.
+func (s *Snapshot) List() ([]*framework.NodeInfo, error) {
+	return s.nodeInfoList, nil
+}
+
+// HavePodsWithAffinityList returns the list of nodes with at least one pod with inter-pod affinity
+func (s *Snapshot) HavePodsWithAffinityList() ([]*framework.NodeInfo, error) {
+	return s.havePodsWithAffinityNodeInfoList, nil
+}
+
+// HavePodsWithRequiredAntiAffinityList returns the list of nodes with at least one pod with
+// required inter-pod anti-affinity
+func (s *Snapshot) HavePodsWithRequiredAntiAffinityList() ([]*framework.NodeInfo, error) {
+	return s.havePodsWithRequiredAntiAffinityNodeInfoList, nil
+}
+
+// Get returns the NodeInfo of the given node name.
+func (s *Snapshot) Get(nodeName string) (*framework.NodeInfo, error) {
+	if v, ok := s.nodeInfoMap[nodeName]; ok && v.Node() != nil {
+		return v, nil
+	}
+	return nil, fmt.Errorf("nodeinfo not found for node name %q", nodeName)
+}
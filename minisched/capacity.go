@@ -0,0 +1,151 @@
+package minisched
+
+import (
+	"context"
+	"sort"
+
+	internalcache "github.com/nakamasato/mini-kube-scheduler/minisched/cache"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// CapacityEstimate is the result of EstimateCapacity: how many copies of the pod fit the cluster.
+type CapacityEstimate struct {
+	// Count is the number of the copies placed.
+	Count int `json:"count"`
+	// MaxReached is true if the estimation stopped at the maximum, i.e. more copies may fit.
+	MaxReached bool `json:"maxReached,omitempty"`
+	// Reason is why no more copies fit, e.g. "0/3 nodes are available: 3 Insufficient cpu.".
+	Reason string `json:"reason,omitempty"`
+	// LimitingPlugins are the plugins which rejected the next copy on some node, sorted by name.
+	LimitingPlugins []string `json:"limitingPlugins,omitempty"`
+	// Nodes are the copies placed on each node and what rejected the next copy there, sorted by name.
+	Nodes []NodeCapacity `json:"nodes,omitempty"`
+}
+
+// NodeCapacity is the number of the copies of the pod placed on a node.
+type NodeCapacity struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	// LimitingPlugin is the plugin which rejected the next copy on the node, if any.
+	LimitingPlugin string   `json:"limitingPlugin,omitempty"`
+	Reasons        []string `json:"reasons,omitempty"`
+}
+
+// MaxCapacityEstimate is the maximum number of the copies EstimateCapacity places, so that an estimate ends even if
+// no plugin limits the copies (e.g. NodeResourcesFit is disabled).
+const MaxCapacityEstimate = 1000
+
+// EstimateCapacity schedules copies of the pod one by one against a snapshot of its own, assuming each of them on
+// the node with the highest score (the ties are broken by name), until no node fits the next copy or max copies
+// are placed (0 or more than MaxCapacityEstimate means MaxCapacityEstimate). Like Simulate, it's a dry run:
+// the copies are only added to the snapshot of the estimate, and the scheduler takes its own snapshot again.
+// Like FitsNewNode, it waits for the current scheduling cycle to finish before placing each copy, but the scheduling
+// cycles can run between the copies.
+func (sched *Scheduler) EstimateCapacity(ctx context.Context, pod *v1.Pod, max int) (*CapacityEstimate, error) {
+	if max <= 0 || max > MaxCapacityEstimate {
+		max = MaxCapacityEstimate
+	}
+
+	pods, nodes, err := sched.listPodsAndNodes()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := internalcache.NewSnapshot(pods, nodes)
+
+	estimate := &CapacityEstimate{}
+	placed := map[string]int{}
+	for estimate.Count < max {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// the copies keep the name of the template, since plugins such as NodeNumber score by the name.
+		copied := pod.DeepCopy()
+		copied.UID = uuid.NewUUID()
+
+		nodeName, err := sched.dryRunScheduleOneOn(ctx, snapshot, copied)
+		if err != nil {
+			fitErr, ok := err.(*framework.FitError)
+			if !ok {
+				return nil, err
+			}
+			estimate.Reason = fitErr.Error()
+			estimate.LimitingPlugins = fitErr.Diagnosis.UnschedulablePlugins.List()
+			estimate.Nodes = nodeCapacities(nodes, placed, fitErr.Diagnosis.NodeToStatusMap)
+			return estimate, nil
+		}
+
+		placed[nodeName]++
+		estimate.Count++
+	}
+
+	estimate.MaxReached = true
+	estimate.Nodes = nodeCapacities(nodes, placed, nil)
+	return estimate, nil
+}
+
+// dryRunScheduleOneOn runs dryRunScheduleOne for the pod against the snapshot instead of the snapshot of the scheduler,
+// and adds the pod to the selected node in the snapshot.
+// The plugins keep the snapshot of the scheduler given at their creation, so its content is replaced with
+// the snapshot during the dry run. The next scheduling cycle takes the snapshot of the scheduler again.
+func (sched *Scheduler) dryRunScheduleOneOn(ctx context.Context, snapshot *internalcache.Snapshot, pod *v1.Pod) (string, error) {
+	sched.cycleLock.Lock()
+	defer sched.cycleLock.Unlock()
+
+	*sched.snapshot = *snapshot
+	nodeName, err := sched.dryRunScheduleOne(ctx, pod)
+	if err != nil {
+		return "", err
+	}
+	pod.Spec.NodeName = nodeName
+	if err := snapshot.AddPod(pod); err != nil {
+		return "", err
+	}
+	return nodeName, nil
+}
+
+// dryRunScheduleOne runs the plugins from pre filter to score for the pod against the snapshot, and returns the node
+// with the highest score. It returns the FitError if no node fits the pod.
+func (sched *Scheduler) dryRunScheduleOne(ctx context.Context, pod *v1.Pod) (string, error) {
+	state := framework.NewCycleState()
+	if status := sched.RunPreFilterPlugins(ctx, state, pod); !status.IsSuccess() {
+		if status.IsUnschedulable() {
+			return "", sched.preFilterFitError(pod, status)
+		}
+		return "", status.AsError()
+	}
+	nodeInfos, err := sched.snapshot.NodeInfos().List()
+	if err != nil {
+		return "", err
+	}
+	feasibleNodes, err := sched.RunFilterPlugins(ctx, state, pod, nodeInfos)
+	if err != nil {
+		return "", err
+	}
+	if status := sched.RunPreScorePlugins(ctx, state, pod, feasibleNodes); !status.IsSuccess() {
+		return "", status.AsError()
+	}
+	scores, status := sched.RunScorePlugins(ctx, state, pod, feasibleNodes)
+	if !status.IsSuccess() {
+		return "", status.AsError()
+	}
+	return sortByScore(scores)[0].Name, nil
+}
+
+func nodeCapacities(nodes []*v1.Node, placed map[string]int, statuses framework.NodeToStatusMap) []NodeCapacity {
+	capacities := make([]NodeCapacity, 0, len(nodes))
+	for _, n := range nodes {
+		c := NodeCapacity{Name: n.Name, Count: placed[n.Name]}
+		if status, ok := statuses[n.Name]; ok {
+			c.LimitingPlugin = status.FailedPlugin()
+			c.Reasons = status.Reasons()
+		}
+		capacities = append(capacities, c)
+	}
+	sort.Slice(capacities, func(i, j int) bool {
+		return capacities[i].Name < capacities[j].Name
+	})
+	return capacities
+}
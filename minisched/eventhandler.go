@@ -2,12 +2,18 @@ package minisched
 
 import (
 	"fmt"
+	"reflect"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched/queue"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/trace"
 
 	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/utils/clock"
 )
 
 func addAllEventHandlers(
@@ -16,7 +22,9 @@ func addAllEventHandlers(
 	gvkMap map[framework.GVK]framework.ActionType,
 ) {
 	// unscheduled pod
-	informerFactory.Core().V1().Pods().Informer().AddEventHandler(
+	sched.addEventHandler(
+		informerFactory.Core().V1().Pods().Informer(),
+		framework.Pod,
 		cache.FilteringResourceEventHandler{
 			FilterFunc: func(obj interface{}) bool {
 				switch t := obj.(type) {
@@ -38,21 +46,21 @@ func addAllEventHandlers(
 		if at&framework.Add != 0 {
 			evt := framework.ClusterEvent{Resource: gvk, ActionType: framework.Add, Label: fmt.Sprintf("%vAdd", shortGVK)}
 			funcs.AddFunc = func(_ interface{}) {
-				klog.Info("eventHandler: new node is added")
+				klog.Info("eventHandler: ", evt.Label)
 				sched.SchedulingQueue.MoveAllToActiveOrBackoffQueue(evt)
 			}
 		}
 		if at&framework.Update != 0 {
 			evt := framework.ClusterEvent{Resource: gvk, ActionType: framework.Update, Label: fmt.Sprintf("%vUpdate", shortGVK)}
 			funcs.UpdateFunc = func(_, _ interface{}) {
-				klog.Info("eventHandler: a node is updated")
+				klog.Info("eventHandler: ", evt.Label)
 				sched.SchedulingQueue.MoveAllToActiveOrBackoffQueue(evt)
 			}
 		}
 		if at&framework.Delete != 0 {
 			evt := framework.ClusterEvent{Resource: gvk, ActionType: framework.Delete, Label: fmt.Sprintf("%vDelete", shortGVK)}
-			klog.Info("eventHandler: a node is deleted")
 			funcs.DeleteFunc = func(_ interface{}) {
+				klog.Info("eventHandler: ", evt.Label)
 				sched.SchedulingQueue.MoveAllToActiveOrBackoffQueue(evt)
 			}
 		}
@@ -61,16 +69,82 @@ func addAllEventHandlers(
 
 	for gvk, at := range gvkMap {
 		switch gvk {
+		case framework.Pod:
+			// assigned pod
+			sched.addEventHandler(
+				informerFactory.Core().V1().Pods().Informer(),
+				framework.Pod,
+				cache.FilteringResourceEventHandler{
+					FilterFunc: func(obj interface{}) bool {
+						switch t := obj.(type) {
+						case *v1.Pod:
+							return assignedPod(t)
+						case cache.DeletedFinalStateUnknown:
+							pod, ok := t.Obj.(*v1.Pod)
+							return ok && assignedPod(pod)
+						default:
+							return false
+						}
+					},
+					Handler: buildEvtResHandler(at, framework.Pod, "AssignedPod"),
+				},
+			)
 		case framework.Node:
-			informerFactory.Core().V1().Nodes().Informer().AddEventHandler(
-				buildEvtResHandler(at, framework.Node, "Node"),
+			funcs := buildEvtResHandler(at, framework.Node, "Node")
+			if at&framework.Update != 0 {
+				funcs.UpdateFunc = sched.updateNode
+			}
+			sched.addEventHandler(
+				informerFactory.Core().V1().Nodes().Informer(),
+				framework.Node,
+				funcs,
+			)
+		case framework.CSINode:
+			sched.addEventHandler(
+				informerFactory.Storage().V1().CSINodes().Informer(),
+				framework.CSINode,
+				buildEvtResHandler(at, framework.CSINode, "CSINode"),
+			)
+		case framework.CSIDriver:
+			sched.addEventHandler(
+				informerFactory.Storage().V1().CSIDrivers().Informer(),
+				framework.CSIDriver,
+				buildEvtResHandler(at, framework.CSIDriver, "CSIDriver"),
+			)
+		case framework.CSIStorageCapacity:
+			sched.addEventHandler(
+				informerFactory.Storage().V1beta1().CSIStorageCapacities().Informer(),
+				framework.CSIStorageCapacity,
+				buildEvtResHandler(at, framework.CSIStorageCapacity, "CSIStorageCapacity"),
+			)
+		case framework.PersistentVolume:
+			sched.addEventHandler(
+				informerFactory.Core().V1().PersistentVolumes().Informer(),
+				framework.PersistentVolume,
+				buildEvtResHandler(at, framework.PersistentVolume, "Pv"),
+			)
+		case framework.PersistentVolumeClaim:
+			sched.addEventHandler(
+				informerFactory.Core().V1().PersistentVolumeClaims().Informer(),
+				framework.PersistentVolumeClaim,
+				buildEvtResHandler(at, framework.PersistentVolumeClaim, "Pvc"),
+			)
+		case framework.StorageClass:
+			funcs := cache.ResourceEventHandlerFuncs{}
+			if at&framework.Add != 0 {
+				funcs.AddFunc = sched.onStorageClassAdd
+			}
+			if at&framework.Update != 0 {
+				funcs.UpdateFunc = func(_, _ interface{}) {
+					klog.Info("eventHandler: ", queue.StorageClassUpdate.Label)
+					sched.SchedulingQueue.MoveAllToActiveOrBackoffQueue(queue.StorageClassUpdate)
+				}
+			}
+			sched.addEventHandler(
+				informerFactory.Storage().V1().StorageClasses().Informer(),
+				framework.StorageClass,
+				funcs,
 			)
-			//case framework.CSINode:
-			//case framework.CSIDriver:
-			//case framework.CSIStorageCapacity:
-			//case framework.PersistentVolume:
-			//case framework.PersistentVolumeClaim:
-			//case framework.StorageClass:
 			//case framework.Service:
 			//default:
 		}
@@ -78,6 +152,86 @@ func addAllEventHandlers(
 	}
 }
 
+// onStorageClassAdd moves the pods which may become schedulable by the new StorageClass.
+// Like kube-scheduler, only a StorageClass with WaitForFirstConsumer binding mode can make the pods with unbound
+// claims of the class schedulable, because the claims of the other classes are bound by the PV controller.
+func (sched *Scheduler) onStorageClassAdd(obj interface{}) {
+	sc, ok := obj.(*storagev1.StorageClass)
+	if !ok {
+		return
+	}
+
+	if sc.VolumeBindingMode != nil && *sc.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer {
+		klog.Info("eventHandler: ", queue.StorageClassAdd.Label)
+		sched.SchedulingQueue.MoveAllToActiveOrBackoffQueue(queue.StorageClassAdd)
+	}
+}
+
+// updateNode moves the pods which may become schedulable by the change of the node.
+// Like kube-scheduler, the event tells what is changed so that only the interested plugins are considered.
+func (sched *Scheduler) updateNode(oldObj, newObj interface{}) {
+	oldNode, ok := oldObj.(*v1.Node)
+	if !ok {
+		return
+	}
+	newNode, ok := newObj.(*v1.Node)
+	if !ok {
+		return
+	}
+
+	if event := nodeSchedulingPropertiesChange(newNode, oldNode); event != nil {
+		klog.Info("eventHandler: a node is updated: ", event.Label)
+		sched.SchedulingQueue.MoveAllToActiveOrBackoffQueue(*event)
+	}
+}
+
+func nodeSchedulingPropertiesChange(newNode *v1.Node, oldNode *v1.Node) *framework.ClusterEvent {
+	if nodeSpecUnschedulableChanged(newNode, oldNode) {
+		return &queue.NodeSpecUnschedulableChange
+	}
+	if nodeAllocatableChanged(newNode, oldNode) {
+		return &queue.NodeAllocatableChange
+	}
+	if nodeLabelsChanged(newNode, oldNode) {
+		return &queue.NodeLabelChange
+	}
+	if nodeTaintsChanged(newNode, oldNode) {
+		return &queue.NodeTaintChange
+	}
+	if nodeConditionsChanged(newNode, oldNode) {
+		return &queue.NodeConditionChange
+	}
+
+	return nil
+}
+
+func nodeAllocatableChanged(newNode *v1.Node, oldNode *v1.Node) bool {
+	return !reflect.DeepEqual(oldNode.Status.Allocatable, newNode.Status.Allocatable)
+}
+
+func nodeLabelsChanged(newNode *v1.Node, oldNode *v1.Node) bool {
+	return !reflect.DeepEqual(oldNode.GetLabels(), newNode.GetLabels())
+}
+
+func nodeTaintsChanged(newNode *v1.Node, oldNode *v1.Node) bool {
+	return !reflect.DeepEqual(newNode.Spec.Taints, oldNode.Spec.Taints)
+}
+
+func nodeConditionsChanged(newNode *v1.Node, oldNode *v1.Node) bool {
+	strip := func(conditions []v1.NodeCondition) map[v1.NodeConditionType]v1.ConditionStatus {
+		conditionStatuses := make(map[v1.NodeConditionType]v1.ConditionStatus, len(conditions))
+		for i := range conditions {
+			conditionStatuses[conditions[i].Type] = conditions[i].Status
+		}
+		return conditionStatuses
+	}
+	return !reflect.DeepEqual(strip(oldNode.Status.Conditions), strip(newNode.Status.Conditions))
+}
+
+func nodeSpecUnschedulableChanged(newNode *v1.Node, oldNode *v1.Node) bool {
+	return newNode.Spec.Unschedulable != oldNode.Spec.Unschedulable && !newNode.Spec.Unschedulable
+}
+
 // assignedPod selects pods that are assigned (scheduled and running).
 func assignedPod(pod *v1.Pod) bool {
 	return len(pod.Spec.NodeName) != 0
@@ -90,3 +244,110 @@ func (sched *Scheduler) addPodToSchedulingQueue(obj interface{}) {
 	}
 	sched.SchedulingQueue.Add(pod)
 }
+
+// addEventHandler registers the handler to the informer.
+// The handlers of a resource are called in the order of registration by a resourceEventHandler registered to
+// the informer once, which is wrapped to record the events if the Scheduler has traceRecorder.
+// Only the events of pods and nodes are recorded because the trace has no other objects.
+// The handlers are kept in the Scheduler for ReplayEvent.
+func (sched *Scheduler) addEventHandler(informer cache.SharedIndexInformer, gvk framework.GVK, handler cache.ResourceEventHandler) {
+	_, registered := sched.eventHandlers[gvk]
+	sched.eventHandlers[gvk] = append(sched.eventHandlers[gvk], handler)
+	if registered {
+		return
+	}
+
+	handler = &resourceEventHandler{sched: sched, resource: gvk}
+	if sched.traceRecorder != nil && (gvk == framework.Pod || gvk == framework.Node) {
+		handler = &recordingEventHandler{recorder: sched.traceRecorder, clock: sched.clock, resource: gvk, handler: handler}
+	}
+	informer.AddEventHandler(handler)
+}
+
+// ReplayEvent calls the event handlers registered by addAllEventHandlers with the recorded informer event.
+func (sched *Scheduler) ReplayEvent(e *trace.InformerEvent) error {
+	if _, ok := sched.eventHandlers[framework.GVK(e.Resource)]; !ok {
+		// no plugin is interested in the resource.
+		return nil
+	}
+	handler := &resourceEventHandler{sched: sched, resource: framework.GVK(e.Resource)}
+
+	obj, oldObj := e.Object()
+	switch e.Action {
+	case trace.ActionAdd:
+		handler.OnAdd(obj)
+	case trace.ActionUpdate:
+		handler.OnUpdate(oldObj, obj)
+	case trace.ActionDelete:
+		handler.OnDelete(obj)
+	default:
+		return fmt.Errorf("unknown action %q", e.Action)
+	}
+	return nil
+}
+
+// resourceEventHandler calls the handlers of the resource in the order of registration.
+type resourceEventHandler struct {
+	sched    *Scheduler
+	resource framework.GVK
+}
+
+func (r *resourceEventHandler) OnAdd(obj interface{}) {
+	for _, h := range r.sched.eventHandlers[r.resource] {
+		h.OnAdd(obj)
+	}
+}
+
+func (r *resourceEventHandler) OnUpdate(oldObj, newObj interface{}) {
+	for _, h := range r.sched.eventHandlers[r.resource] {
+		h.OnUpdate(oldObj, newObj)
+	}
+}
+
+func (r *resourceEventHandler) OnDelete(obj interface{}) {
+	for _, h := range r.sched.eventHandlers[r.resource] {
+		h.OnDelete(obj)
+	}
+}
+
+// recordingEventHandler records the events and passes them to handler.
+type recordingEventHandler struct {
+	recorder trace.Recorder
+	clock    clock.PassiveClock
+	resource framework.GVK
+	handler  cache.ResourceEventHandler
+}
+
+func (r *recordingEventHandler) OnAdd(obj interface{}) {
+	r.record(trace.ActionAdd, obj, nil)
+	r.handler.OnAdd(obj)
+}
+
+func (r *recordingEventHandler) OnUpdate(oldObj, newObj interface{}) {
+	r.record(trace.ActionUpdate, newObj, oldObj)
+	r.handler.OnUpdate(oldObj, newObj)
+}
+
+func (r *recordingEventHandler) OnDelete(obj interface{}) {
+	r.record(trace.ActionDelete, obj, nil)
+	r.handler.OnDelete(obj)
+}
+
+func (r *recordingEventHandler) record(action string, obj, oldObj interface{}) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	e := &trace.InformerEvent{Resource: string(r.resource), Action: action}
+	switch t := obj.(type) {
+	case *v1.Pod:
+		e.Pod = t
+		e.OldPod, _ = oldObj.(*v1.Pod)
+	case *v1.Node:
+		e.Node = t
+		e.OldNode, _ = oldObj.(*v1.Node)
+	default:
+		klog.Warningf("eventHandler: unexpected object to record: %T", obj)
+		return
+	}
+	r.recorder.Record(&trace.Event{Time: r.clock.Now(), Type: trace.Informer, Informer: e})
+}
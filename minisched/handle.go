@@ -0,0 +1,74 @@
+package minisched
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/kubernetes/pkg/scheduler/framework/parallelize"
+)
+
+// frameworkHandle is the framework.Handle given to the in-tree plugins.
+// It provides what the plugins supported by minisched use. The other methods are not implemented
+// and panic because the embedded framework.Handle is nil.
+type frameworkHandle struct {
+	framework.Handle
+
+	sched        *Scheduler
+	parallelizer parallelize.Parallelizer
+}
+
+var _ framework.Handle = &frameworkHandle{}
+
+func newFrameworkHandle(sched *Scheduler) *frameworkHandle {
+	return &frameworkHandle{
+		sched:        sched,
+		parallelizer: parallelize.NewParallelizer(parallelize.DefaultParallelism),
+	}
+}
+
+// SnapshotSharedLister returns the snapshot taken at the beginning of the current scheduling cycle.
+func (h *frameworkHandle) SnapshotSharedLister() framework.SharedLister {
+	return h.sched.snapshot
+}
+
+func (h *frameworkHandle) ClientSet() clientset.Interface {
+	return h.sched.client
+}
+
+func (h *frameworkHandle) SharedInformerFactory() informers.SharedInformerFactory {
+	return h.sched.informerFactory
+}
+
+func (h *frameworkHandle) Parallelizer() parallelize.Parallelizer {
+	return h.parallelizer
+}
+
+// NominatedPodsForNode returns the pending pods nominated to run on the node.
+func (h *frameworkHandle) NominatedPodsForNode(nodeName string) []*framework.PodInfo {
+	return h.sched.SchedulingQueue.NominatedPodsForNode(nodeName)
+}
+
+// RunFilterPlugins runs the filter plugins for the pod on the node. The returned map has the status of
+// the plugin which failed first, or is empty if all the plugins pass.
+func (h *frameworkHandle) RunFilterPlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, info *framework.NodeInfo) framework.PluginToStatus {
+	statuses := make(framework.PluginToStatus)
+	if status := h.sched.runFilterPlugins(ctx, state, pod, info); !status.IsSuccess() {
+		statuses[status.FailedPlugin()] = status
+	}
+	return statuses
+}
+
+func (h *frameworkHandle) RunFilterPluginsWithNominatedPods(ctx context.Context, state *framework.CycleState, pod *v1.Pod, info *framework.NodeInfo) *framework.Status {
+	return h.sched.RunFilterPluginsWithNominatedPods(ctx, state, pod, info)
+}
+
+func (h *frameworkHandle) RunPreFilterExtensionAddPod(ctx context.Context, state *framework.CycleState, podToSchedule *v1.Pod, podInfoToAdd *framework.PodInfo, nodeInfo *framework.NodeInfo) *framework.Status {
+	return h.sched.RunPreFilterExtensionAddPod(ctx, state, podToSchedule, podInfoToAdd, nodeInfo)
+}
+
+func (h *frameworkHandle) RunPreFilterExtensionRemovePod(ctx context.Context, state *framework.CycleState, podToSchedule *v1.Pod, podInfoToRemove *framework.PodInfo, nodeInfo *framework.NodeInfo) *framework.Status {
+	return h.sched.RunPreFilterExtensionRemovePod(ctx, state, podToSchedule, podInfoToRemove, nodeInfo)
+}
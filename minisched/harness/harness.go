@@ -0,0 +1,207 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched"
+)
+
+const (
+	pollInterval = 1 * time.Millisecond
+	pollTimeout  = 10 * time.Second
+)
+
+// Harness runs minisched against a fake clientset without API server.
+// The scheduling loop is not started; the caller drives the scheduler with ScheduleOne or SchedulePending
+// so that the scheduling order is deterministic.
+type Harness struct {
+	Client    *fake.Clientset
+	Scheduler *minisched.Scheduler
+
+	informerFactory informers.SharedInformerFactory
+}
+
+// New creates a fake clientset with the binding reactor and minisched using it.
+func New(opts ...minisched.Option) (*Harness, error) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", bindingReactor(client.Tracker()))
+
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	sched, err := minisched.New(client, informerFactory, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create minisched: %w", err)
+	}
+
+	return &Harness{
+		Client:          client,
+		Scheduler:       sched,
+		informerFactory: informerFactory,
+	}, nil
+}
+
+// bindingReactor handles the pods/binding subresource by setting Spec.NodeName of the pod,
+// which is done by API server in a real cluster.
+func bindingReactor(tracker k8stesting.ObjectTracker) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "binding" {
+			return false, nil, nil
+		}
+		binding, ok := action.(k8stesting.CreateAction).GetObject().(*v1.Binding)
+		if !ok {
+			return true, nil, fmt.Errorf("unexpected object for pods/binding: %T", action.(k8stesting.CreateAction).GetObject())
+		}
+
+		gvr := v1.SchemeGroupVersion.WithResource("pods")
+		obj, err := tracker.Get(gvr, binding.Namespace, binding.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		pod := obj.(*v1.Pod).DeepCopy()
+		if pod.Spec.NodeName != "" {
+			// the same error as API server.
+			return true, nil, apierrors.NewConflict(v1.Resource("pods/binding"), pod.Name, fmt.Errorf("pod %v is already assigned to node %q", pod.Name, pod.Spec.NodeName))
+		}
+		pod.Spec.NodeName = binding.Target.Name
+		if err := tracker.Update(gvr, pod, binding.Namespace); err != nil {
+			return true, nil, err
+		}
+		return true, binding, nil
+	}
+}
+
+// Start starts the informers and waits for the caches to be synced.
+func (h *Harness) Start(ctx context.Context) {
+	h.informerFactory.Start(ctx.Done())
+	h.informerFactory.WaitForCacheSync(ctx.Done())
+}
+
+// CreateNode creates the node and waits until the scheduler's informer observes it.
+func (h *Harness) CreateNode(ctx context.Context, node *v1.Node) (*v1.Node, error) {
+	created, err := h.Client.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("create node: %w", err)
+	}
+
+	lister := h.informerFactory.Core().V1().Nodes().Lister()
+	err = wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		_, err := lister.Get(node.Name)
+		return err == nil, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("wait for node %s to be observed: %w", node.Name, err)
+	}
+	return created, nil
+}
+
+// CreatePod creates the pod and waits until it's added to the scheduling queue.
+// Pods with Spec.NodeName are not waited because they are not added to the queue.
+// The namespace and UID are set if empty, as API server does.
+func (h *Harness) CreatePod(ctx context.Context, pod *v1.Pod) (*v1.Pod, error) {
+	pod = pod.DeepCopy()
+	if pod.Namespace == "" {
+		pod.Namespace = metav1.NamespaceDefault
+	}
+	if pod.UID == "" {
+		// minisched distinguishes waiting pods by UID, which the fake clientset doesn't set.
+		pod.UID = types.UID(uuid.New().String())
+	}
+	created, err := h.Client.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("create pod: %w", err)
+	}
+	if created.Spec.NodeName != "" {
+		return created, nil
+	}
+
+	err = wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		for _, p := range h.Scheduler.SchedulingQueue.PendingPods() {
+			if p.Namespace == created.Namespace && p.Name == created.Name {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("wait for pod %s/%s to be queued: %w", created.Namespace, created.Name, err)
+	}
+	return created, nil
+}
+
+// ScheduleOne runs one scheduling cycle if activeQ has a pod, and returns whether it ran.
+// The binding is done asynchronously after the permit phase. Use WaitForPodBound to wait for it.
+func (h *Harness) ScheduleOne(ctx context.Context) bool {
+	if !h.Scheduler.SchedulingQueue.HasActivePods() {
+		return false
+	}
+	h.Scheduler.ScheduleOne(ctx)
+	return true
+}
+
+// SchedulePending runs scheduling cycles until activeQ is empty, and returns the number of cycles.
+func (h *Harness) SchedulePending(ctx context.Context) int {
+	n := 0
+	for h.ScheduleOne(ctx) {
+		n++
+	}
+	return n
+}
+
+// WaitForPodBound waits until the pod is bound to a node and returns the node name.
+func (h *Harness) WaitForPodBound(ctx context.Context, namespace, name string, timeout time.Duration) (string, error) {
+	var nodeName string
+	err := wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		pod, err := h.Client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		nodeName = pod.Spec.NodeName
+		return nodeName != "", nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("wait for pod %s/%s to be bound: %w", namespace, name, err)
+	}
+	return nodeName, nil
+}
+
+// SyncCaches replaces the pods and the nodes in the informer caches with the ones in the fake clientset.
+// It's for the callers which don't Start the informers but feed the events to the scheduler by themselves
+// (e.g. a replay), so that the snapshots of the scheduler see the objects in the fake clientset.
+func (h *Harness) SyncCaches(ctx context.Context) error {
+	pods, err := h.Client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list pods: %w", err)
+	}
+	podObjs := make([]interface{}, 0, len(pods.Items))
+	for i := range pods.Items {
+		podObjs = append(podObjs, &pods.Items[i])
+	}
+	if err := h.informerFactory.Core().V1().Pods().Informer().GetIndexer().Replace(podObjs, pods.ResourceVersion); err != nil {
+		return fmt.Errorf("replace pods in the cache: %w", err)
+	}
+
+	nodes, err := h.Client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("list nodes: %w", err)
+	}
+	nodeObjs := make([]interface{}, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		nodeObjs = append(nodeObjs, &nodes.Items[i])
+	}
+	if err := h.informerFactory.Core().V1().Nodes().Informer().GetIndexer().Replace(nodeObjs, nodes.ResourceVersion); err != nil {
+		return fmt.Errorf("replace nodes in the cache: %w", err)
+	}
+	return nil
+}
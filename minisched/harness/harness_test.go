@@ -0,0 +1,262 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	v1beta2config "k8s.io/kube-scheduler/config/v1beta2"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/plugins/score/nodenumber"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/simclock"
+)
+
+// the node names have no suffix number, so that NodeNumber doesn't delay the binding.
+func newNode(name string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{
+			Capacity: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("4"),
+				v1.ResourceMemory: resource.MustParse("8Gi"),
+				v1.ResourcePods:   resource.MustParse("110"),
+			},
+			Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("4"),
+				v1.ResourceMemory: resource.MustParse("8Gi"),
+				v1.ResourcePods:   resource.MustParse("110"),
+			},
+		},
+	}
+}
+
+func newPod(name string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "c", Image: "k8s.gcr.io/pause:3.5"}},
+		},
+	}
+}
+
+func startHarness(t *testing.T, opts ...minisched.Option) (context.Context, *Harness) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	h, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	h.Start(ctx)
+	return ctx, h
+}
+
+func TestBindingReactor(t *testing.T) {
+	ctx, h := startHarness(t)
+
+	pod, err := h.Client.CoreV1().Pods(metav1.NamespaceDefault).Create(ctx, newPod("pod"), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("create pod: %v", err)
+	}
+
+	binding := &v1.Binding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+		Target:     v1.ObjectReference{Kind: "Node", Name: "node-a"},
+	}
+	if err := h.Client.CoreV1().Pods(pod.Namespace).Bind(ctx, binding, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("bind pod: %v", err)
+	}
+	got, err := h.Client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get pod: %v", err)
+	}
+	if got.Spec.NodeName != "node-a" {
+		t.Errorf("Spec.NodeName = %q, want %q", got.Spec.NodeName, "node-a")
+	}
+
+	// binding the pod again is a conflict even to the same node, as API server does.
+	for _, nodeName := range []string{"node-a", "node-b"} {
+		binding.Target.Name = nodeName
+		err := h.Client.CoreV1().Pods(pod.Namespace).Bind(ctx, binding, metav1.CreateOptions{})
+		if !apierrors.IsConflict(err) {
+			t.Errorf("bind the bound pod to %s: got %v, want a conflict", nodeName, err)
+		}
+	}
+
+	binding.Name = "missing"
+	if err := h.Client.CoreV1().Pods(pod.Namespace).Bind(ctx, binding, metav1.CreateOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("bind a missing pod: got %v, want not found", err)
+	}
+}
+
+func TestSchedulePending(t *testing.T) {
+	ctx, h := startHarness(t)
+
+	if _, err := h.CreateNode(ctx, newNode("node-a")); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"pod-a", "pod-b", "pod-c"}
+	for _, name := range names {
+		pod, err := h.CreatePod(ctx, newPod(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pod.Namespace != metav1.NamespaceDefault || pod.UID == "" {
+			t.Errorf("CreatePod(%s) didn't default the namespace and the UID: %q, %q", name, pod.Namespace, pod.UID)
+		}
+	}
+
+	if n := h.SchedulePending(ctx); n != len(names) {
+		t.Errorf("SchedulePending = %d, want %d", n, len(names))
+	}
+	if h.ScheduleOne(ctx) {
+		t.Errorf("ScheduleOne ran with the empty activeQ")
+	}
+
+	for _, name := range names {
+		nodeName, err := h.WaitForPodBound(ctx, metav1.NamespaceDefault, name, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nodeName != "node-a" {
+			t.Errorf("pod %s is bound to %q, want %q", name, nodeName, "node-a")
+		}
+	}
+}
+
+func TestUnschedulablePodIsRequeuedOnNodeAdd(t *testing.T) {
+	clk := simclock.New(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx, h := startHarness(t, minisched.WithClock(clk))
+
+	if _, err := h.CreatePod(ctx, newPod("pod")); err != nil {
+		t.Fatal(err)
+	}
+	if n := h.SchedulePending(ctx); n != 1 {
+		t.Fatalf("SchedulePending = %d, want 1", n)
+	}
+	// no node fits the pod, so it waits in unschedulableQ for a cluster event.
+	if h.Scheduler.SchedulingQueue.HasActivePods() {
+		t.Fatalf("the unschedulable pod is in activeQ")
+	}
+	if pending := h.Scheduler.SchedulingQueue.PendingPods(); len(pending) != 1 || pending[0].Name != "pod" {
+		t.Fatalf("PendingPods = %v, want only pod", pending)
+	}
+
+	// the pod is moved to activeQ, not to podBackoffQ, after its backoff of the first attempt.
+	clk.Step(2 * time.Second)
+	if _, err := h.CreateNode(ctx, newNode("node-a")); err != nil {
+		t.Fatal(err)
+	}
+	err := wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		return h.Scheduler.SchedulingQueue.HasActivePods(), nil
+	})
+	if err != nil {
+		t.Fatalf("the pod isn't moved to activeQ by NodeAdd: %v", err)
+	}
+
+	if n := h.SchedulePending(ctx); n != 1 {
+		t.Errorf("SchedulePending = %d, want 1", n)
+	}
+	nodeName, err := h.WaitForPodBound(ctx, metav1.NamespaceDefault, "pod", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nodeName != "node-a" {
+		t.Errorf("pod is bound to %q, want %q", nodeName, "node-a")
+	}
+}
+
+func TestSchedulingIsReproducibleWithSeed(t *testing.T) {
+	// the nodes have the same score, so the random tie-breaking chooses among all of them.
+	schedule := func(seed int64) []string {
+		ctx, h := startHarness(t, minisched.WithRandomSeed(seed), minisched.WithTieBreak(minisched.TieBreakRandom))
+		for _, name := range []string{"node-a", "node-b", "node-c", "node-d", "node-e", "node-f"} {
+			if _, err := h.CreateNode(ctx, newNode(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var nodeNames []string
+		for _, name := range []string{"pod-a", "pod-b", "pod-c"} {
+			if _, err := h.CreatePod(ctx, newPod(name)); err != nil {
+				t.Fatal(err)
+			}
+			h.SchedulePending(ctx)
+			nodeName, err := h.WaitForPodBound(ctx, metav1.NamespaceDefault, name, 10*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodeNames = append(nodeNames, nodeName)
+		}
+		return nodeNames
+	}
+
+	for seed := int64(1); seed <= 5; seed++ {
+		first, second := schedule(seed), schedule(seed)
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("seed %d: the pods are scheduled to %v and then to %v", seed, first, second)
+		}
+	}
+}
+
+func TestEstimateCapacityMatchesScheduling(t *testing.T) {
+	// NodeNumber scores the nodes by the suffix number of the pod name, so the copies must be scored like the template.
+	profile := &v1beta2config.KubeSchedulerProfile{
+		PluginConfig: []v1beta2config.PluginConfig{
+			{Name: nodenumber.Name, Args: runtime.RawExtension{Raw: []byte(`{"delayMultiplier": 0}`)}},
+		},
+	}
+	ctx, h := startHarness(t, minisched.WithProfile(profile), minisched.WithTieBreak(minisched.TieBreakLexical))
+	for _, name := range []string{"node1", "node2", "node3", "node4"} {
+		if _, err := h.CreateNode(ctx, newNode(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	template := newPod("web3")
+	template.Namespace = metav1.NamespaceDefault
+	template.Spec.Containers[0].Resources.Requests = v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")}
+
+	const copies = 3
+	estimate, err := h.Scheduler.EstimateCapacity(ctx, template, copies)
+	if err != nil {
+		t.Fatalf("EstimateCapacity: %v", err)
+	}
+	if estimate.Count != copies || !estimate.MaxReached {
+		t.Fatalf("EstimateCapacity placed %d copies (max reached: %v), want %d", estimate.Count, estimate.MaxReached, copies)
+	}
+	estimated := map[string]int{}
+	for _, n := range estimate.Nodes {
+		if n.Count > 0 {
+			estimated[n.Name] = n.Count
+		}
+	}
+
+	// the template itself is scheduled as many times, in namespaces of its own to keep the name.
+	scheduled := map[string]int{}
+	for i := 0; i < copies; i++ {
+		pod := template.DeepCopy()
+		pod.Namespace = fmt.Sprintf("copy-%d", i)
+		if _, err := h.CreatePod(ctx, pod); err != nil {
+			t.Fatal(err)
+		}
+		h.SchedulePending(ctx)
+		nodeName, err := h.WaitForPodBound(ctx, pod.Namespace, pod.Name, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scheduled[nodeName]++
+	}
+
+	if !reflect.DeepEqual(estimated, scheduled) {
+		t.Errorf("EstimateCapacity placed the copies on %v, but the template is scheduled to %v", estimated, scheduled)
+	}
+}
@@ -2,184 +2,149 @@ package minisched
 
 import (
 	"fmt"
+	"math/rand"
+	"sync"
+	"time"
 
-	"github.com/nakamasato/mini-kube-scheduler/minisched/plugins/score/nodenumber"
+	internalcache "github.com/nakamasato/mini-kube-scheduler/minisched/cache"
 	"github.com/nakamasato/mini-kube-scheduler/minisched/queue"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/trace"
 	"github.com/nakamasato/mini-kube-scheduler/minisched/waitingpod"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
-	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/nodeunschedulable"
+	"k8s.io/utils/clock"
 )
 
 type Scheduler struct {
 	SchedulingQueue *queue.SchedulingQueue
 
-	client clientset.Interface
-
-	waitingPods map[types.UID]*waitingpod.WaitingPod
-
-	filterPlugins   []framework.FilterPlugin
-	preScorePlugins []framework.PreScorePlugin
-	scorePlugins    []framework.ScorePlugin
-	permitPlugins   []framework.PermitPlugin
+	client          clientset.Interface
+	informerFactory informers.SharedInformerFactory
+	// podLister and nodeLister are the informer caches the snapshot is taken from.
+	podLister  corelisters.PodLister
+	nodeLister corelisters.NodeLister
+	// handle is the framework.Handle given to the in-tree plugins.
+	handle *frameworkHandle
+	// snapshot is the nodes and the pods on them at the beginning of the current scheduling cycle.
+	snapshot *internalcache.Snapshot
+	// cycleLock is held during a scheduling cycle, which uses the snapshot, so that FitsNewNode
+	// doesn't replace the snapshot in the middle of the cycle.
+	cycleLock sync.Mutex
+
+	// assumedPods are the pods which have been selected a node but not observed on it by the informer yet.
+	// They are added to the snapshot so that the following scheduling cycles see the resources they use.
+	assumedPods map[types.UID]*v1.Pod
+	// bindingFinished are the assumed pods which have been bound. They are forgotten once the informer observes them.
+	bindingFinished map[types.UID]bool
+	assumedPodsLock sync.RWMutex
+
+	waitingPods     map[types.UID]*waitingpod.WaitingPod
+	waitingPodsLock sync.RWMutex
+
+	// clock is used for the queue, the waiting pods and the plugins.
+	clock clock.WithDelayedExecution
+	// tieBreaker chooses a node among the nodes with the highest score.
+	tieBreaker tieBreaker
+	// nodeSelector chooses a node from the scored nodes by selectionStrategy.
+	nodeSelector      nodeSelector
+	selectionStrategy NodeSelectionStrategy
+
+	// eventHandlers are the handlers registered to informers. They are used to replay informer events.
+	eventHandlers map[framework.GVK][]cache.ResourceEventHandler
+	// traceRecorder records informer events and scheduling decisions. nil if not recording.
+	traceRecorder trace.Recorder
+
+	preFilterPlugins []framework.PreFilterPlugin
+	filterPlugins    []framework.FilterPlugin
+	preScorePlugins  []framework.PreScorePlugin
+	scorePlugins     []framework.ScorePlugin
+	reservePlugins   []framework.ReservePlugin
+	permitPlugins    []framework.PermitPlugin
+	preBindPlugins   []framework.PreBindPlugin
+	// scorePluginWeight is the weight of each score plugin.
+	scorePluginWeight map[string]int64
 }
 
 func New(
 	client clientset.Interface,
 	informerFactory informers.SharedInformerFactory,
+	opts ...Option,
 ) (*Scheduler, error) {
-	sched := &Scheduler{
-		client:      client,
-		waitingPods: map[types.UID]*waitingpod.WaitingPod{},
+	options := schedulerOptions{clock: clock.RealClock{}, tieBreak: TieBreakRandom}
+	for _, opt := range opts {
+		opt(&options)
 	}
 
-	// filter plugin
-	filterP, err := createFilterPlugins()
-	if err != nil {
-		return nil, fmt.Errorf("create filter plugins: %w", err)
+	seed := time.Now().UnixNano()
+	if options.randomSeed != nil {
+		seed = *options.randomSeed
 	}
-	sched.filterPlugins = filterP
-
-	// prescore plugin
-	preScoreP, err := createPreScorePlugins(sched)
+	r := rand.New(rand.NewSource(seed))
+	tieBreaker, err := newTieBreaker(options.tieBreak, r)
 	if err != nil {
-		return nil, fmt.Errorf("create pre score plugins: %w", err)
+		return nil, err
 	}
-	sched.preScorePlugins = preScoreP
-
-	// score plugin
-	scoreP, err := createScorePlugins(sched)
+	selectionArgs, err := pluginArgs(options.profile, NodeSelectionName)
 	if err != nil {
-		return nil, fmt.Errorf("create score plugins: %w", err)
+		return nil, err
 	}
-	sched.scorePlugins = scoreP
-
-	// permit plugin
-	permitP, err := createPermitPlugins(sched)
+	selectionStrategy, nodeSelector, err := newNodeSelector(selectionArgs, tieBreaker, r)
 	if err != nil {
-		return nil, fmt.Errorf("create permit plugins: %w", err)
+		return nil, fmt.Errorf("create node selector: %w", err)
 	}
-	sched.permitPlugins = permitP
 
-	events, err := eventsToRegister(sched)
+	sched := &Scheduler{
+		client:          client,
+		informerFactory: informerFactory,
+		podLister:       informerFactory.Core().V1().Pods().Lister(),
+		nodeLister:      informerFactory.Core().V1().Nodes().Lister(),
+		snapshot:        internalcache.NewEmptySnapshot(),
+		assumedPods:     map[types.UID]*v1.Pod{},
+		bindingFinished: map[types.UID]bool{},
+		waitingPods:     map[types.UID]*waitingpod.WaitingPod{},
+		eventHandlers:   map[framework.GVK][]cache.ResourceEventHandler{},
+		traceRecorder:   options.traceRecorder,
+		clock:           options.clock,
+		tieBreaker:      tieBreaker,
+
+		nodeSelector:      nodeSelector,
+		selectionStrategy: selectionStrategy,
+	}
+
+	sched.handle = newFrameworkHandle(sched)
+
+	// plugins are created for each Scheduler because they have the handle of the Scheduler.
+	plugins, err := sched.initPlugins(options.profile)
 	if err != nil {
-		return nil, fmt.Errorf("create gvks: %w", err)
+		return nil, err
 	}
 
-	sched.SchedulingQueue = queue.New(events)
+	events := eventsToRegister(plugins...)
+
+	sched.SchedulingQueue = queue.New(events, sched.clock)
 
 	addAllEventHandlers(sched, informerFactory, unionedGVKs(events))
 
 	return sched, nil
 }
 
-func createFilterPlugins() ([]framework.FilterPlugin, error) {
-	// nodeunschedulable is FilterPlugin.
-	nodeunschedulableplugin, err := createNodeUnschedulablePlugin()
-	if err != nil {
-		return nil, fmt.Errorf("create nodeunschedulable plugin: %w", err)
-	}
-
-	// We use nodeunschedulable plugin only.
-	filterPlugins := []framework.FilterPlugin{
-		nodeunschedulableplugin.(framework.FilterPlugin),
-	}
-
-	return filterPlugins, nil
-}
-
-var (
-	nodeunschedulableplugin framework.Plugin
-)
-
-func createNodeUnschedulablePlugin() (framework.Plugin, error) {
-	if nodeunschedulableplugin != nil {
-		return nodeunschedulableplugin, nil
-	}
-
-	p, err := nodeunschedulable.New(nil, nil)
-	nodeunschedulableplugin = p
-	return p, err
-}
-
-func createPreScorePlugins(h waitingpod.Handle) ([]framework.PreScorePlugin, error) {
-	nodenumberplugin, err := createNodeNumberPlugin(h)
-	if err != nil {
-		return nil, fmt.Errorf("create nodenumber plugin: %w", err)
-	}
-
-	// We use nodenumber plugin only.
-	preScorePlugins := []framework.PreScorePlugin{
-		nodenumberplugin.(framework.PreScorePlugin),
-	}
-
-	return preScorePlugins, nil
-}
-
-func createScorePlugins(h waitingpod.Handle) ([]framework.ScorePlugin, error) {
-	nodenumberplugin, err := createNodeNumberPlugin(h)
-	if err != nil {
-		return nil, fmt.Errorf("create nodenumber plugin: %w", err)
-	}
-
-	// We use nodenumber plugin only.
-	scorePlugins := []framework.ScorePlugin{
-		nodenumberplugin.(framework.ScorePlugin),
-	}
-
-	return scorePlugins, nil
-}
-
-var (
-	nodenumberplugin framework.Plugin
-)
-
-func createNodeNumberPlugin(h waitingpod.Handle) (framework.Plugin, error) {
-	if nodenumberplugin != nil {
-		return nodenumberplugin, nil
-	}
-
-	p, err := nodenumber.New(nil, h)
-	nodenumberplugin = p
-
-	return p, err
-}
-
-func createPermitPlugins(h waitingpod.Handle) ([]framework.PermitPlugin, error) {
-	// nodenumber is PermitPlugin.
-	nodenumberplugin, err := createNodeNumberPlugin(h)
-	if err != nil {
-		return nil, fmt.Errorf("create nodenumber plugin: %w", err)
-	}
-
-	// We use nodenumber plugin only.
-	permitPlugins := []framework.PermitPlugin{
-		nodenumberplugin.(framework.PermitPlugin),
-	}
-
-	return permitPlugins, nil
-}
-
-func eventsToRegister(h waitingpod.Handle) (map[framework.ClusterEvent]sets.String, error) {
-	unschedulablePlugin, err := createNodeUnschedulablePlugin()
-	if err != nil {
-		return nil, fmt.Errorf("create node unschedulable plugin: %w", err)
-	}
-	nnumberPlugin, err := createNodeNumberPlugin(h)
-	if err != nil {
-		return nil, fmt.Errorf("create node number plugin: %w", err)
-	}
-
+func eventsToRegister(plugins ...framework.Plugin) map[framework.ClusterEvent]sets.String {
 	clusterEventMap := make(map[framework.ClusterEvent]sets.String)
-	nunschedulablePluginEvents := unschedulablePlugin.(framework.EnqueueExtensions).EventsToRegister()
-	registerClusterEvents(unschedulablePlugin.Name(), clusterEventMap, nunschedulablePluginEvents)
-	nnumberPluginEvents := nnumberPlugin.(framework.EnqueueExtensions).EventsToRegister()
-	registerClusterEvents(unschedulablePlugin.Name(), clusterEventMap, nnumberPluginEvents)
+	for _, pl := range plugins {
+		ext, ok := pl.(framework.EnqueueExtensions)
+		if !ok {
+			continue
+		}
+		registerClusterEvents(pl.Name(), clusterEventMap, ext.EventsToRegister())
+	}
 
-	return clusterEventMap, nil
+	return clusterEventMap
 }
 
 func registerClusterEvents(name string, eventToPlugins map[framework.ClusterEvent]sets.String, evts []framework.ClusterEvent) {
@@ -0,0 +1,59 @@
+package minisched
+
+import (
+	v1beta2config "k8s.io/kube-scheduler/config/v1beta2"
+	"k8s.io/utils/clock"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched/trace"
+)
+
+type schedulerOptions struct {
+	traceRecorder trace.Recorder
+	clock         clock.WithDelayedExecution
+	tieBreak      TieBreakStrategy
+	// randomSeed is nil if the seed is not given.
+	randomSeed *int64
+	profile    *v1beta2config.KubeSchedulerProfile
+}
+
+// Option configures a Scheduler.
+type Option func(*schedulerOptions)
+
+// WithTraceRecorder sets the Recorder to record informer events and scheduling decisions.
+func WithTraceRecorder(r trace.Recorder) Option {
+	return func(o *schedulerOptions) {
+		o.traceRecorder = r
+	}
+}
+
+// WithClock sets the clock used for the queue, the waiting pods and the plugins. Defaults to the real clock.
+// With a simulated clock (e.g. *simclock.Clock), Run advances the clock to the next timer when the scheduler is idle
+// but some pods or the other components sharing the clock are waiting for the time to pass, so that backoffs and
+// timeouts finish without waiting in real time.
+func WithClock(c clock.WithDelayedExecution) Option {
+	return func(o *schedulerOptions) {
+		o.clock = c
+	}
+}
+
+// WithTieBreak sets how to choose a node among the nodes with the highest score. Defaults to TieBreakRandom.
+func WithTieBreak(s TieBreakStrategy) Option {
+	return func(o *schedulerOptions) {
+		o.tieBreak = s
+	}
+}
+
+// WithRandomSeed sets the seed of the random number generator of the scheduler, so that the random choices
+// (e.g. TieBreakRandom) are reproducible. The generator is seeded from the current time by default.
+func WithRandomSeed(seed int64) Option {
+	return func(o *schedulerOptions) {
+		o.randomSeed = &seed
+	}
+}
+
+// WithProfile sets the scheduler profile whose PluginConfig configures the scheduler.
+func WithProfile(p *v1beta2config.KubeSchedulerProfile) Option {
+	return func(o *schedulerOptions) {
+		o.profile = p
+	}
+}
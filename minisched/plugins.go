@@ -0,0 +1,393 @@
+package minisched
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	v1beta2config "k8s.io/kube-scheduler/config/v1beta2"
+	"k8s.io/kubernetes/pkg/scheduler/apis/config"
+	configscheme "k8s.io/kubernetes/pkg/scheduler/apis/config/scheme"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/feature"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/interpodaffinity"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/nodeaffinity"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/nodename"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/nodeports"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/noderesources"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/nodeunschedulable"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/nodevolumelimits"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/podtopologyspread"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/tainttoleration"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/volumebinding"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/volumerestrictions"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/volumezone"
+	"k8s.io/utils/pointer"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched/plugins/score/labelaffinity"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/plugins/score/nodenumber"
+)
+
+// features are the feature gates of the in-tree plugins. The features enabled by default in v1.23 are enabled.
+var features = feature.Features{
+	EnablePodAffinityNamespaceSelector: true,
+	EnablePodDisruptionBudget:          true,
+	EnablePodOverhead:                  true,
+	EnableCSIStorageCapacity:           true,
+}
+
+// pluginFactory creates a plugin with the args resolved by pluginArgs.
+type pluginFactory func(args runtime.Object, sched *Scheduler) (framework.Plugin, error)
+
+// registry returns the factories of the plugins supported by minisched.
+// The plugins enabled in the profile but not in the registry are ignored.
+func registry() map[string]pluginFactory {
+	return map[string]pluginFactory{
+		nodeunschedulable.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return nodeunschedulable.New(args, sched.handle)
+		},
+		nodename.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return nodename.New(args, sched.handle)
+		},
+		tainttoleration.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return tainttoleration.New(args, sched.handle)
+		},
+		nodeaffinity.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return nodeaffinity.New(args, sched.handle)
+		},
+		nodeports.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return nodeports.New(args, sched.handle)
+		},
+		noderesources.FitName: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return noderesources.NewFit(args, sched.handle, features)
+		},
+		podtopologyspread.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return podtopologyspread.New(args, sched.handle)
+		},
+		interpodaffinity.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return interpodaffinity.New(args, sched.handle, features)
+		},
+		volumerestrictions.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return volumerestrictions.New(args, sched.handle, features)
+		},
+		nodevolumelimits.CSIName: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return nodevolumelimits.NewCSI(args, sched.handle, features)
+		},
+		volumebinding.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return volumebinding.New(args, sched.handle, features)
+		},
+		volumezone.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return volumezone.New(args, sched.handle)
+		},
+		nodenumber.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return nodenumber.New(args, sched)
+		},
+		labelaffinity.Name: func(args runtime.Object, sched *Scheduler) (framework.Plugin, error) {
+			return labelaffinity.New(args, sched.handle)
+		},
+	}
+}
+
+// defaultPlugins returns the plugins enabled when the profile doesn't configure them.
+func defaultPlugins() *v1beta2config.Plugins {
+	return &v1beta2config.Plugins{
+		PreFilter: v1beta2config.PluginSet{
+			Enabled: []v1beta2config.Plugin{
+				{Name: noderesources.FitName},
+				{Name: nodeports.Name},
+				{Name: volumerestrictions.Name},
+				{Name: nodeaffinity.Name},
+				{Name: podtopologyspread.Name},
+				{Name: interpodaffinity.Name},
+				{Name: volumebinding.Name},
+			},
+		},
+		Filter: v1beta2config.PluginSet{
+			Enabled: []v1beta2config.Plugin{
+				{Name: nodeunschedulable.Name},
+				{Name: nodename.Name},
+				{Name: tainttoleration.Name},
+				{Name: nodeaffinity.Name},
+				{Name: nodeports.Name},
+				{Name: noderesources.FitName},
+				{Name: volumerestrictions.Name},
+				{Name: nodevolumelimits.CSIName},
+				{Name: volumebinding.Name},
+				{Name: volumezone.Name},
+				{Name: podtopologyspread.Name},
+				{Name: interpodaffinity.Name},
+			},
+		},
+		PreScore: v1beta2config.PluginSet{
+			Enabled: []v1beta2config.Plugin{
+				{Name: interpodaffinity.Name},
+				{Name: podtopologyspread.Name},
+				{Name: tainttoleration.Name},
+				{Name: nodeaffinity.Name},
+				{Name: nodenumber.Name},
+				{Name: labelaffinity.Name},
+			},
+		},
+		Score: v1beta2config.PluginSet{
+			Enabled: []v1beta2config.Plugin{
+				{Name: nodenumber.Name, Weight: pointer.Int32Ptr(1)},
+				{Name: labelaffinity.Name, Weight: pointer.Int32Ptr(1)},
+				{Name: noderesources.FitName, Weight: pointer.Int32Ptr(1)},
+				{Name: nodeaffinity.Name, Weight: pointer.Int32Ptr(1)},
+				{Name: tainttoleration.Name, Weight: pointer.Int32Ptr(1)},
+				{Name: interpodaffinity.Name, Weight: pointer.Int32Ptr(1)},
+				{Name: podtopologyspread.Name, Weight: pointer.Int32Ptr(2)},
+			},
+		},
+		Reserve: v1beta2config.PluginSet{
+			Enabled: []v1beta2config.Plugin{
+				{Name: volumebinding.Name},
+			},
+		},
+		Permit: v1beta2config.PluginSet{
+			Enabled: []v1beta2config.Plugin{
+				{Name: nodenumber.Name},
+			},
+		},
+		PreBind: v1beta2config.PluginSet{
+			Enabled: []v1beta2config.Plugin{
+				{Name: volumebinding.Name},
+			},
+		},
+	}
+}
+
+// initPlugins creates the plugins enabled by merging the profile into defaultPlugins,
+// and sets them to the extension points of the scheduler.
+func (sched *Scheduler) initPlugins(profile *v1beta2config.KubeSchedulerProfile) ([]framework.Plugin, error) {
+	plugins := defaultPlugins()
+	if profile != nil {
+		plugins = mergePlugins(plugins, profile.Plugins)
+	}
+
+	reg := registry()
+	created := map[string]framework.Plugin{}
+	var all []framework.Plugin
+	// get returns the plugin with the name, creating it at the first call. It returns nil if the plugin is not supported.
+	get := func(name string) (framework.Plugin, error) {
+		if pl, ok := created[name]; ok {
+			return pl, nil
+		}
+		factory, ok := reg[name]
+		if !ok {
+			klog.Warningf("minisched: plugin %q is not supported and ignored", name)
+			created[name] = nil
+			return nil, nil
+		}
+		args, err := pluginArgs(profile, name)
+		if err != nil {
+			return nil, err
+		}
+		pl, err := factory(args, sched)
+		if err != nil {
+			return nil, fmt.Errorf("create %s plugin: %w", name, err)
+		}
+		created[name] = pl
+		all = append(all, pl)
+		return pl, nil
+	}
+
+	sched.scorePluginWeight = map[string]int64{}
+	extensionPoints := []struct {
+		name   string
+		set    v1beta2config.PluginSet
+		add    func(framework.Plugin) bool
+		weight bool
+	}{
+		{name: "PreFilter", set: plugins.PreFilter, add: func(pl framework.Plugin) bool {
+			p, ok := pl.(framework.PreFilterPlugin)
+			if ok {
+				sched.preFilterPlugins = append(sched.preFilterPlugins, p)
+			}
+			return ok
+		}},
+		{name: "Filter", set: plugins.Filter, add: func(pl framework.Plugin) bool {
+			p, ok := pl.(framework.FilterPlugin)
+			if ok {
+				sched.filterPlugins = append(sched.filterPlugins, p)
+			}
+			return ok
+		}},
+		{name: "PreScore", set: plugins.PreScore, add: func(pl framework.Plugin) bool {
+			p, ok := pl.(framework.PreScorePlugin)
+			if ok {
+				sched.preScorePlugins = append(sched.preScorePlugins, p)
+			}
+			return ok
+		}},
+		{name: "Score", set: plugins.Score, weight: true, add: func(pl framework.Plugin) bool {
+			p, ok := pl.(framework.ScorePlugin)
+			if ok {
+				sched.scorePlugins = append(sched.scorePlugins, p)
+			}
+			return ok
+		}},
+		{name: "Reserve", set: plugins.Reserve, add: func(pl framework.Plugin) bool {
+			p, ok := pl.(framework.ReservePlugin)
+			if ok {
+				sched.reservePlugins = append(sched.reservePlugins, p)
+			}
+			return ok
+		}},
+		{name: "Permit", set: plugins.Permit, add: func(pl framework.Plugin) bool {
+			p, ok := pl.(framework.PermitPlugin)
+			if ok {
+				sched.permitPlugins = append(sched.permitPlugins, p)
+			}
+			return ok
+		}},
+		{name: "PreBind", set: plugins.PreBind, add: func(pl framework.Plugin) bool {
+			p, ok := pl.(framework.PreBindPlugin)
+			if ok {
+				sched.preBindPlugins = append(sched.preBindPlugins, p)
+			}
+			return ok
+		}},
+	}
+	for _, ep := range extensionPoints {
+		enabled := sets.NewString()
+		for _, p := range ep.set.Enabled {
+			if enabled.Has(p.Name) {
+				return nil, fmt.Errorf("plugin %q already registered as %q", p.Name, ep.name)
+			}
+			enabled.Insert(p.Name)
+
+			pl, err := get(p.Name)
+			if err != nil {
+				return nil, err
+			}
+			if pl == nil {
+				continue
+			}
+			if !ep.add(pl) {
+				return nil, fmt.Errorf("plugin %q does not extend %s plugin", p.Name, ep.name)
+			}
+			if ep.weight {
+				// a weight of zero is the same as one like kube-scheduler.
+				weight := int64(1)
+				if p.Weight != nil && *p.Weight != 0 {
+					weight = int64(*p.Weight)
+				}
+				sched.scorePluginWeight[p.Name] = weight
+			}
+		}
+	}
+
+	return all, nil
+}
+
+// mergePlugins merges the custom set into the given default one, handling disabled sets.
+// Only the extension points run by minisched are merged.
+func mergePlugins(defaultPlugins, customPlugins *v1beta2config.Plugins) *v1beta2config.Plugins {
+	if customPlugins == nil {
+		return defaultPlugins
+	}
+
+	defaultPlugins.PreFilter = mergePluginSet(defaultPlugins.PreFilter, customPlugins.PreFilter)
+	defaultPlugins.Filter = mergePluginSet(defaultPlugins.Filter, customPlugins.Filter)
+	defaultPlugins.PreScore = mergePluginSet(defaultPlugins.PreScore, customPlugins.PreScore)
+	defaultPlugins.Score = mergePluginSet(defaultPlugins.Score, customPlugins.Score)
+	defaultPlugins.Reserve = mergePluginSet(defaultPlugins.Reserve, customPlugins.Reserve)
+	defaultPlugins.Permit = mergePluginSet(defaultPlugins.Permit, customPlugins.Permit)
+	defaultPlugins.PreBind = mergePluginSet(defaultPlugins.PreBind, customPlugins.PreBind)
+	return defaultPlugins
+}
+
+type pluginIndex struct {
+	index  int
+	plugin v1beta2config.Plugin
+}
+
+// mergePluginSet is the same as the one of kube-scheduler: the disabled plugins ("*" for all) are removed
+// from the default plugins, the default plugins enabled again are updated in place, and the other enabled
+// plugins are appended.
+func mergePluginSet(defaultPluginSet, customPluginSet v1beta2config.PluginSet) v1beta2config.PluginSet {
+	disabledPlugins := sets.NewString()
+	enabledCustomPlugins := make(map[string]pluginIndex)
+	// replacedPluginIndex is a set of index of plugins, which have replaced the default plugins.
+	replacedPluginIndex := sets.NewInt()
+	for _, disabledPlugin := range customPluginSet.Disabled {
+		disabledPlugins.Insert(disabledPlugin.Name)
+	}
+	for index, enabledPlugin := range customPluginSet.Enabled {
+		enabledCustomPlugins[enabledPlugin.Name] = pluginIndex{index, enabledPlugin}
+	}
+	var enabledPlugins []v1beta2config.Plugin
+	if !disabledPlugins.Has("*") {
+		for _, defaultEnabledPlugin := range defaultPluginSet.Enabled {
+			if disabledPlugins.Has(defaultEnabledPlugin.Name) {
+				continue
+			}
+			// The default plugin is explicitly re-configured, update the default plugin accordingly.
+			if customPlugin, ok := enabledCustomPlugins[defaultEnabledPlugin.Name]; ok {
+				defaultEnabledPlugin = customPlugin.plugin
+				replacedPluginIndex.Insert(customPlugin.index)
+			}
+			enabledPlugins = append(enabledPlugins, defaultEnabledPlugin)
+		}
+	}
+
+	// Append all the custom plugins which haven't replaced any default plugins.
+	for index, plugin := range customPluginSet.Enabled {
+		if !replacedPluginIndex.Has(index) {
+			enabledPlugins = append(enabledPlugins, plugin)
+		}
+	}
+	return v1beta2config.PluginSet{Enabled: enabledPlugins}
+}
+
+// pluginArgs returns the args of the PluginConfig entry with the name in the profile.
+//
+// The args of the in-tree plugins are defaulted and converted to the internal types which their constructors
+// expect, even if the profile has no entry for them.
+// The other args (i.e. those of the plugins in this repository) are returned as *runtime.Unknown,
+// which can be decoded by frameworkruntime.DecodeInto as upstream does, or nil if there is no entry.
+func pluginArgs(profile *v1beta2config.KubeSchedulerProfile, name string) (runtime.Object, error) {
+	var args runtime.RawExtension
+	if profile != nil {
+		for _, pc := range profile.PluginConfig {
+			if pc.Name == name {
+				args = pc.Args
+				break
+			}
+		}
+	}
+
+	versioned, err := configscheme.Scheme.New(v1beta2config.SchemeGroupVersion.WithKind(name + "Args"))
+	if err != nil {
+		// not an in-tree plugin.
+		if args.Object != nil {
+			return args.Object, nil
+		}
+		if args.Raw == nil {
+			return nil, nil
+		}
+		return &runtime.Unknown{Raw: args.Raw, ContentType: runtime.ContentTypeJSON}, nil
+	}
+
+	switch {
+	case args.Object != nil:
+		versioned = args.Object.DeepCopyObject()
+	case args.Raw != nil:
+		if err := json.Unmarshal(args.Raw, versioned); err != nil {
+			return nil, fmt.Errorf("decode args of %s plugin: %w", name, err)
+		}
+	}
+	configscheme.Scheme.Default(versioned)
+
+	internal, err := configscheme.Scheme.New(config.SchemeGroupVersion.WithKind(name + "Args"))
+	if err != nil {
+		return nil, fmt.Errorf("get internal args type of %s plugin: %w", name, err)
+	}
+	if err := configscheme.Scheme.Convert(versioned, internal, nil); err != nil {
+		return nil, fmt.Errorf("convert args of %s plugin: %w", name, err)
+	}
+	return internal, nil
+}
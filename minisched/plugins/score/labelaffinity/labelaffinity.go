@@ -0,0 +1,172 @@
+package labelaffinity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+)
+
+// LabelAffinity is a score plugin that prefers the nodes whose labels match the label selector
+// in the pod's annotation (e.g. `minisched/preferred-node-labels: "disktype=ssd,zone in (a,b)"`). <- PreScore and Score Plugin
+// The score of a node is the number of the requirements in the selector that the node satisfies,
+// which is normalized to [0, 100] so that the best nodes get 100. <- NormalizeScore
+// Pods without the annotation are not affected (all nodes get 0), nor are the pods with a malformed one,
+// which is logged instead of failing the scheduling.
+//
+// Compared to NodeNumber, this plugin shows how to normalize scores and how to register
+// node label updates to retry pods when node labels change.
+type LabelAffinity struct {
+	args LabelAffinityArgs
+}
+
+var _ framework.PreScorePlugin = &LabelAffinity{}
+var _ framework.ScorePlugin = &LabelAffinity{}
+var _ framework.ScoreExtensions = &LabelAffinity{}
+var _ framework.EnqueueExtensions = &LabelAffinity{}
+
+// Name is the name of the plugin used in the plugin registry and configurations.
+const Name = "LabelAffinity"
+const preScoreStateKey = "PreScore" + Name
+
+// DefaultAnnotationKey is the annotation of the pod to read the label selector from by default.
+const DefaultAnnotationKey = "minisched/preferred-node-labels"
+
+// LabelAffinityArgs holds arguments used to configure LabelAffinity plugin.
+// It's given as the args of the PluginConfig entry named LabelAffinity in the profile.
+type LabelAffinityArgs struct {
+	// AnnotationKey is the annotation of the pod to read the label selector from. Defaults to DefaultAnnotationKey.
+	AnnotationKey string `json:"annotationKey,omitempty"`
+}
+
+// Name returns name of the plugin. It is used in logs, etc.
+func (pl *LabelAffinity) Name() string {
+	return Name
+}
+
+// preScoreState computed at PreScore and used at Score.
+type preScoreState struct {
+	// requirements are parsed from the annotation. Empty if the pod doesn't have the annotation.
+	requirements labels.Requirements
+	// nodeLabels are the labels of the nodes to be scored (node name -> labels), because Score gets only the node name.
+	nodeLabels map[string]labels.Set
+}
+
+// Clone implements the mandatory Clone interface. We don't really copy the data since
+// there is no need for that.
+func (s *preScoreState) Clone() framework.StateData {
+	return s
+}
+
+// PreScore parses the label selector in the pod's annotation once per scheduling cycle,
+// and stores the requirements and the labels of the nodes into CycleState so that Score doesn't parse it for each node.
+// A malformed annotation is ignored with a log, i.e. stored as empty requirements, since a preference in the annotation
+// should never make the pod unschedulable.
+func (pl *LabelAffinity) PreScore(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodes []*v1.Node) *framework.Status {
+	s := &preScoreState{}
+	if value, ok := pod.Annotations[pl.args.AnnotationKey]; ok {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			klog.Warningf("labelaffinity: ignore invalid annotation %s of pod %s/%s: %v", pl.args.AnnotationKey, pod.Namespace, pod.Name, err)
+			state.Write(preScoreStateKey, s)
+			return nil
+		}
+		s.requirements, _ = selector.Requirements()
+		s.nodeLabels = make(map[string]labels.Set, len(nodes))
+		for _, n := range nodes {
+			s.nodeLabels[n.Name] = labels.Set(n.Labels)
+		}
+	}
+
+	// Write data to CycleState
+	state.Write(preScoreStateKey, s)
+
+	return nil
+}
+
+// Score reads the requirements from the CycleState and returns the number of them the node's labels satisfy.
+func (pl *LabelAffinity) Score(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) (int64, *framework.Status) {
+	// Get data from CycleState
+	data, err := state.Read(preScoreStateKey)
+	if err != nil {
+		return 0, framework.AsStatus(err)
+	}
+
+	s, ok := data.(*preScoreState)
+	if !ok {
+		return 0, framework.AsStatus(errors.New("failed to convert pre score state"))
+	}
+	if len(s.requirements) == 0 {
+		return 0, nil
+	}
+
+	nodeLabels, ok := s.nodeLabels[nodeName]
+	if !ok {
+		return 0, framework.AsStatus(fmt.Errorf("node %s is not given to PreScore", nodeName))
+	}
+
+	var score int64
+	for _, r := range s.requirements {
+		if r.Matches(nodeLabels) {
+			score++
+		}
+	}
+	return score, nil
+}
+
+// NormalizeScore scales the scores to [0, framework.MaxNodeScore] so that the nodes with the most
+// requirements satisfied get framework.MaxNodeScore. All scores stay 0 if no node satisfies any requirement.
+func (pl *LabelAffinity) NormalizeScore(ctx context.Context, state *framework.CycleState, pod *v1.Pod, scores framework.NodeScoreList) *framework.Status {
+	var maxScore int64
+	for _, ns := range scores {
+		if ns.Score > maxScore {
+			maxScore = ns.Score
+		}
+	}
+	if maxScore == 0 {
+		return nil
+	}
+
+	for i := range scores {
+		scores[i].Score = scores[i].Score * framework.MaxNodeScore / maxScore
+	}
+	return nil
+}
+
+// ScoreExtensions of the Score plugin.
+func (pl *LabelAffinity) ScoreExtensions() framework.ScoreExtensions {
+	return pl
+}
+
+// EventsToRegister returns the events which may change the score: new nodes and the changes of node labels.
+// The scheduler watches the resources in the events, and the queue retries the pods rejected by
+// the plugin on these events. A score plugin never rejects pods by itself, but registering the events
+// makes sure that the node label updates reach the queue (see nodeSchedulingPropertiesChange).
+func (pl *LabelAffinity) EventsToRegister() []framework.ClusterEvent {
+	return []framework.ClusterEvent{
+		{Resource: framework.Node, ActionType: framework.Add | framework.UpdateNodeLabel},
+	}
+}
+
+// New initializes a new plugin and returns it.
+// obj is LabelAffinityArgs as *runtime.Unknown, or nil to use the default args.
+func New(obj runtime.Object, _ framework.Handle) (framework.Plugin, error) {
+	args := LabelAffinityArgs{}
+	if err := frameworkruntime.DecodeInto(obj, &args); err != nil {
+		return nil, fmt.Errorf("decode %s args: %w", Name, err)
+	}
+	if args.AnnotationKey == "" {
+		args.AnnotationKey = DefaultAnnotationKey
+	}
+	if errs := validation.IsQualifiedName(args.AnnotationKey); len(errs) != 0 {
+		return nil, fmt.Errorf("invalid %s args: annotationKey %q: %v", Name, args.AnnotationKey, errs)
+	}
+	return &LabelAffinity{args: args}, nil
+}
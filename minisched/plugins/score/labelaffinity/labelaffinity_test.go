@@ -0,0 +1,100 @@
+package labelaffinity
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+func newPlugin(t *testing.T) *LabelAffinity {
+	t.Helper()
+	pl, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return pl.(*LabelAffinity)
+}
+
+func TestNormalizeScore(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []int64
+		want   []int64
+	}{
+		{name: "no node", scores: nil, want: nil},
+		{name: "no requirement satisfied", scores: []int64{0, 0, 0}, want: []int64{0, 0, 0}},
+		{name: "best nodes get the max score", scores: []int64{2, 1, 0, 2}, want: []int64{100, 50, 0, 100}},
+		{name: "rounded down", scores: []int64{3, 2, 1}, want: []int64{100, 66, 33}},
+		{name: "single node", scores: []int64{1}, want: []int64{100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scores framework.NodeScoreList
+			for i, s := range tt.scores {
+				scores = append(scores, framework.NodeScore{Name: string(rune('a' + i)), Score: s})
+			}
+			status := newPlugin(t).NormalizeScore(context.Background(), framework.NewCycleState(), &v1.Pod{}, scores)
+			if !status.IsSuccess() {
+				t.Fatalf("NormalizeScore: %v", status.AsError())
+			}
+			var got []int64
+			for _, ns := range scores {
+				got = append(got, ns.Score)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeScore(%v) = %v, want %v", tt.scores, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "ssd-a", Labels: map[string]string{"disktype": "ssd", "zone": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "ssd-c", Labels: map[string]string{"disktype": "ssd", "zone": "c"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "hdd-b", Labels: map[string]string{"disktype": "hdd", "zone": "b"}}},
+	}
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        map[string]int64
+	}{
+		{
+			name: "no annotation",
+			want: map[string]int64{"ssd-a": 0, "ssd-c": 0, "hdd-b": 0},
+		},
+		{
+			name:        "requirements satisfied",
+			annotations: map[string]string{DefaultAnnotationKey: "disktype=ssd,zone in (a,b)"},
+			want:        map[string]int64{"ssd-a": 2, "ssd-c": 1, "hdd-b": 1},
+		},
+		{
+			name:        "malformed annotation is ignored",
+			annotations: map[string]string{DefaultAnnotationKey: "disktype in (ssd"},
+			want:        map[string]int64{"ssd-a": 0, "ssd-c": 0, "hdd-b": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pl := newPlugin(t)
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: tt.annotations}}
+			state := framework.NewCycleState()
+			if status := pl.PreScore(context.Background(), state, pod, nodes); !status.IsSuccess() {
+				t.Fatalf("PreScore: %v", status.AsError())
+			}
+			for _, n := range nodes {
+				got, status := pl.Score(context.Background(), state, pod, n.Name)
+				if !status.IsSuccess() {
+					t.Fatalf("Score(%s): %v", n.Name, status.AsError())
+				}
+				if got != tt.want[n.Name] {
+					t.Errorf("Score(%s) = %d, want %d", n.Name, got, tt.want[n.Name])
+				}
+			}
+		})
+	}
+}
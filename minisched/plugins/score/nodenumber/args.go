@@ -0,0 +1,59 @@
+package nodenumber
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+const (
+	defaultMatchScore      int64   = 10
+	defaultDelayMultiplier float64 = 1
+	defaultTimeout                 = 10 * time.Second
+)
+
+// NodeNumberArgs holds arguments used to configure NodeNumber plugin.
+// It's given as the args of the PluginConfig entry named NodeNumber in the profile.
+type NodeNumberArgs struct {
+	// MatchScore is the score of the nodes whose suffix number matches the pod's. Defaults to 10.
+	MatchScore *int64 `json:"matchScore,omitempty"`
+	// DelayMultiplier is the seconds to delay the binding per the suffix number of the node.
+	// Defaults to 1, i.e. the binding to node3 is delayed by 3 seconds. 0 disables the delay.
+	DelayMultiplier *float64 `json:"delayMultiplier,omitempty"`
+	// Timeout is the max time to wait in the permit phase. The pod is rejected at once if the delay is not shorter.
+	// Defaults to 10s.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Reverse gives MatchScore to the nodes whose suffix number does NOT match the pod's instead.
+	Reverse bool `json:"reverse,omitempty"`
+}
+
+// setDefaults sets the default values to the unset fields.
+func (args *NodeNumberArgs) setDefaults() {
+	if args.MatchScore == nil {
+		s := defaultMatchScore
+		args.MatchScore = &s
+	}
+	if args.DelayMultiplier == nil {
+		m := defaultDelayMultiplier
+		args.DelayMultiplier = &m
+	}
+	if args.Timeout == nil {
+		args.Timeout = &metav1.Duration{Duration: defaultTimeout}
+	}
+}
+
+// validate validates the defaulted args.
+func (args *NodeNumberArgs) validate() error {
+	if *args.MatchScore < framework.MinNodeScore || *args.MatchScore > framework.MaxNodeScore {
+		return fmt.Errorf("matchScore must be in [%d, %d], got %d", framework.MinNodeScore, framework.MaxNodeScore, *args.MatchScore)
+	}
+	if *args.DelayMultiplier < 0 {
+		return fmt.Errorf("delayMultiplier must not be negative, got %v", *args.DelayMultiplier)
+	}
+	if args.Timeout.Duration <= 0 {
+		return fmt.Errorf("timeout must be positive, got %v", args.Timeout.Duration)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package nodenumber
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -10,13 +11,15 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
 )
 
-// NodeNumber is a score plugin that returns 10 if the last char of the target Pod's and Node's name is the same integer, otherwise returns 0. <- PreScore and Score Plugin
-// And it will delay the binding of pod by {node suffix number} seconds. <- PermitPlugin
-// IMPORTANT NOTE: this plugin only handle single digit numbers only.
+// NodeNumber is a score plugin that returns MatchScore (10 by default) if the trailing number of the target Pod's and Node's name is the same, otherwise returns 0. <- PreScore and Score Plugin
+// And it will delay the binding of pod by {node suffix number} x DelayMultiplier seconds. <- PermitPlugin
+// The names without a trailing number never match, and the binding to such nodes is not delayed.
 type NodeNumber struct {
-	h waitingpod.Handle
+	h    waitingpod.Handle
+	args NodeNumberArgs
 }
 
 var _ framework.ScorePlugin = &NodeNumber{}
@@ -35,6 +38,8 @@ func (pl *NodeNumber) Name() string {
 // preScoreState computed at PreScore and used at Score.
 type preScoreState struct {
 	podSuffixNumber int
+	// hasSuffixNumber is false if the pod name doesn't end with a number.
+	hasSuffixNumber bool
 }
 
 // Clone implements the mandatory Clone interface. We don't really copy the data since
@@ -43,17 +48,13 @@ func (s *preScoreState) Clone() framework.StateData {
 	return s
 }
 
-// PreScore gets the last character of the given Pod and store it into CycleState with a key named `podSuffixNumber`
+// PreScore gets the trailing number of the given Pod's name and store it into CycleState with a key named `podSuffixNumber`
 func (pl *NodeNumber) PreScore(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodes []*v1.Node) *framework.Status {
-	podNameLastChar := pod.Name[len(pod.Name)-1:]
-	podnum, err := strconv.Atoi(podNameLastChar)
-	if err != nil {
-		// return success even if its suffix is non-number.
-		return nil
-	}
+	podnum, ok := suffixNumber(pod.Name)
 
 	s := &preScoreState{
 		podSuffixNumber: podnum,
+		hasSuffixNumber: ok,
 	}
 	// Write data to CycleState
 	state.Write(preScoreStateKey, s)
@@ -61,9 +62,9 @@ func (pl *NodeNumber) PreScore(ctx context.Context, state *framework.CycleState,
 	return nil
 }
 
-// Score reads the podSuffixNumber from the CycleState, gets the last character of the nodeName,
-// and returns 10 if the suffix numbers are same,
-// otherwise return 0.
+// Score reads the podSuffixNumber from the CycleState, gets the trailing number of the nodeName,
+// and returns MatchScore if the suffix numbers are same,
+// otherwise return 0. The result is reversed if Reverse is set.
 func (pl *NodeNumber) Score(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) (int64, *framework.Status) {
 	// Get data from CycleState
 	data, err := state.Read(preScoreStateKey)
@@ -76,40 +77,51 @@ func (pl *NodeNumber) Score(ctx context.Context, state *framework.CycleState, po
 		return 0, framework.AsStatus(errors.New("failed to convert pre score state"))
 	}
 
-	nodeNameLastChar := nodeName[len(nodeName)-1:]
-
-	nodenum, err := strconv.Atoi(nodeNameLastChar)
-	if err != nil {
-		// return success even if its suffix is non-number.
-		return 0, nil
-	}
+	nodenum, ok := suffixNumber(nodeName)
+	match := ok && s.hasSuffixNumber && s.podSuffixNumber == nodenum
 
-	if s.podSuffixNumber == nodenum {
-		// if match, node get high score.
-		return 10, nil
+	if match != pl.args.Reverse {
+		// if match (or not match in reverse mode), node get high score.
+		return *pl.args.MatchScore, nil
 	}
 
 	return 0, nil
 }
 
-// Permit delays binding by calling wp.Allow after waiting the number of seconds
-func (pl *NodeNumber) Permit(ctx context.Context, state *framework.CycleState, p *v1.Pod, nodeName string) (*framework.Status, time.Duration) {
-	nodeNameLastChar := nodeName[len(nodeName)-1:]
+// minDelay is the shortest delay to wait in the permit phase. A shorter delay allows the pod at once, since the timer
+// could fire before the scheduler registers the waiting pod, which would then wait until the timeout.
+const minDelay = 100 * time.Millisecond
 
-	nodenum, err := strconv.Atoi(nodeNameLastChar)
-	if err != nil {
+// Permit delays binding by calling wp.Allow after waiting {node suffix number} x DelayMultiplier seconds.
+// The pod is rejected at once if the delay is not shorter than Timeout, instead of waiting for the timeout.
+func (pl *NodeNumber) Permit(ctx context.Context, state *framework.CycleState, p *v1.Pod, nodeName string) (*framework.Status, time.Duration) {
+	nodenum, ok := suffixNumber(nodeName)
+	if !ok {
 		// return allow(success) even if its suffix is non-number.
 		return nil, 0
 	}
 
-	// allow pod after {nodenum} seconds
-	time.AfterFunc(time.Duration(nodenum)*time.Second, func() {
+	// the delay is compared with the timeout in seconds before it's converted to time.Duration,
+	// which would overflow for large suffix numbers.
+	delaySeconds := float64(nodenum) * *pl.args.DelayMultiplier
+	if delaySeconds >= pl.args.Timeout.Seconds() {
+		return framework.NewStatus(framework.Unschedulable, fmt.Sprintf("binding to %s is delayed by %vs, which is not shorter than the timeout %v", nodeName, delaySeconds, pl.args.Timeout.Duration)), 0
+	}
+	delay := time.Duration(delaySeconds * float64(time.Second))
+	if delay < minDelay {
+		return nil, 0
+	}
+
+	// allow pod after the delay
+	pl.h.Clock().AfterFunc(delay, func() {
 		wp := pl.h.GetWaitingPod(p.GetUID())
+		if wp == nil {
+			return
+		}
 		wp.Allow(pl.Name())
 	})
 
-	timeout := time.Duration(10) * time.Second
-	return framework.NewStatus(framework.Wait, ""), timeout
+	return framework.NewStatus(framework.Wait, ""), pl.args.Timeout.Duration
 }
 
 // ScoreExtensions of the Score plugin.
@@ -118,8 +130,17 @@ func (pl *NodeNumber) ScoreExtensions() framework.ScoreExtensions {
 }
 
 // New initializes a new plugin and returns it.
-func New(_ runtime.Object, h waitingpod.Handle) (framework.Plugin, error) {
-	return &NodeNumber{h: h}, nil
+// obj is NodeNumberArgs as *runtime.Unknown, or nil to use the default args.
+func New(obj runtime.Object, h waitingpod.Handle) (framework.Plugin, error) {
+	args := NodeNumberArgs{}
+	if err := frameworkruntime.DecodeInto(obj, &args); err != nil {
+		return nil, fmt.Errorf("decode %s args: %w", Name, err)
+	}
+	args.setDefaults()
+	if err := args.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s args: %w", Name, err)
+	}
+	return &NodeNumber{h: h, args: args}, nil
 }
 
 // To implement EnqueueExtensions
@@ -128,3 +149,20 @@ func (pl *NodeNumber) EventsToRegister() []framework.ClusterEvent {
 		{Resource: framework.Node, ActionType: framework.Add},
 	}
 }
+
+// suffixNumber returns the number at the end of the name (e.g. 12 for "node12").
+// It returns false if the name doesn't end with a digit or the number overflows int.
+func suffixNumber(name string) (int, bool) {
+	i := len(name)
+	for i > 0 && '0' <= name[i-1] && name[i-1] <= '9' {
+		i--
+	}
+	if i == len(name) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(name[i:])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
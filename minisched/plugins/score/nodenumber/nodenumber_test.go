@@ -0,0 +1,240 @@
+package nodenumber_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	v1beta2config "k8s.io/kube-scheduler/config/v1beta2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/utils/clock"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/harness"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/plugins/score/nodenumber"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/simclock"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/waitingpod"
+)
+
+func newArgs(raw string) runtime.Object {
+	if raw == "" {
+		return nil
+	}
+	return &runtime.Unknown{Raw: []byte(raw), ContentType: runtime.ContentTypeJSON}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		wantErr bool
+	}{
+		{name: "default args", args: ""},
+		{name: "all args", args: `{"matchScore": 100, "delayMultiplier": 0.5, "timeout": "30s", "reverse": true}`},
+		{name: "min matchScore", args: `{"matchScore": 0}`},
+		{name: "matchScore over the max node score", args: `{"matchScore": 101}`, wantErr: true},
+		{name: "negative matchScore", args: `{"matchScore": -1}`, wantErr: true},
+		{name: "no delay", args: `{"delayMultiplier": 0}`},
+		{name: "negative delayMultiplier", args: `{"delayMultiplier": -0.1}`, wantErr: true},
+		{name: "zero timeout", args: `{"timeout": "0s"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := nodenumber.New(newArgs(tt.args), nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New(%s) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     string
+		podName  string
+		nodeName string
+		want     int64
+	}{
+		{name: "same number", podName: "pod3", nodeName: "node3", want: 10},
+		{name: "different number", podName: "pod3", nodeName: "node4", want: 0},
+		{name: "multi-digit suffixes", podName: "pod12", nodeName: "node12", want: 10},
+		{name: "only the last digit matches", podName: "pod2", nodeName: "node12", want: 0},
+		{name: "leading zeros", podName: "pod007", nodeName: "node7", want: 10},
+		{name: "digits in the middle are ignored", podName: "pod1-a", nodeName: "node1", want: 0},
+		{name: "no digit on both", podName: "pod", nodeName: "node", want: 0},
+		{name: "no digit on the node", podName: "pod1", nodeName: "node", want: 0},
+		{name: "overflowing numbers never match", podName: "pod99999999999999999999", nodeName: "node99999999999999999999", want: 0},
+		{name: "matchScore", args: `{"matchScore": 3}`, podName: "pod1", nodeName: "node1", want: 3},
+		{name: "reverse with the same number", args: `{"reverse": true}`, podName: "pod1", nodeName: "node1", want: 0},
+		{name: "reverse with a different number", args: `{"reverse": true}`, podName: "pod1", nodeName: "node2", want: 10},
+		{name: "reverse with no digit", args: `{"reverse": true}`, podName: "pod", nodeName: "node", want: 10},
+		{name: "reverse with overflowing numbers", args: `{"reverse": true}`, podName: "pod99999999999999999999", nodeName: "node99999999999999999999", want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pl, err := nodenumber.New(newArgs(tt.args), nil)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			p := pl.(*nodenumber.NodeNumber)
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: tt.podName}}
+			state := framework.NewCycleState()
+			if status := p.PreScore(context.Background(), state, pod, nil); !status.IsSuccess() {
+				t.Fatalf("PreScore: %v", status.AsError())
+			}
+			got, status := p.Score(context.Background(), state, pod, tt.nodeName)
+			if !status.IsSuccess() {
+				t.Fatalf("Score: %v", status.AsError())
+			}
+			if got != tt.want {
+				t.Errorf("Score(%s, %s) = %d, want %d", tt.podName, tt.nodeName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduling(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     string
+		podName  string
+		wantNode string
+	}{
+		{name: "matched node", args: `{"delayMultiplier": 0}`, podName: "pod2", wantNode: "node2"},
+		{name: "reverse", args: `{"delayMultiplier": 0, "reverse": true}`, podName: "pod2", wantNode: "node1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			profile := &v1beta2config.KubeSchedulerProfile{
+				PluginConfig: []v1beta2config.PluginConfig{
+					{Name: nodenumber.Name, Args: runtime.RawExtension{Raw: []byte(tt.args)}},
+				},
+			}
+			h, err := harness.New(minisched.WithProfile(profile))
+			if err != nil {
+				t.Fatalf("create harness: %v", err)
+			}
+			h.Start(ctx)
+
+			for _, name := range []string{"node1", "node2"} {
+				if _, err := h.CreateNode(ctx, newNode(name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pod, err := h.CreatePod(ctx, &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: tt.podName},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "c", Image: "k8s.gcr.io/pause:3.5"}}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.SchedulePending(ctx)
+
+			nodeName, err := h.WaitForPodBound(ctx, pod.Namespace, pod.Name, 10*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nodeName != tt.wantNode {
+				t.Errorf("pod %s is bound to %s, want %s", tt.podName, nodeName, tt.wantNode)
+			}
+		})
+	}
+}
+
+func newNode(name string) *v1.Node {
+	resources := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("4"),
+		v1.ResourceMemory: resource.MustParse("8Gi"),
+		v1.ResourcePods:   resource.MustParse("110"),
+	}
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     v1.NodeStatus{Capacity: resources, Allocatable: resources},
+	}
+}
+
+// fakeHandle is a waitingpod.Handle with the waiting pods registered by the test.
+type fakeHandle struct {
+	clock       *simclock.Clock
+	waitingPods map[types.UID]*waitingpod.WaitingPod
+}
+
+func (h *fakeHandle) GetWaitingPod(uid types.UID) *waitingpod.WaitingPod {
+	return h.waitingPods[uid]
+}
+
+func (h *fakeHandle) Clock() clock.WithDelayedExecution {
+	return h.clock
+}
+
+func TestPermit(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     string
+		nodeName string
+		// wantCode is the code of the status returned by Permit.
+		wantCode framework.Code
+		// wantDelay is the time the waiting pod is allowed after, if wantCode is Wait.
+		wantDelay time.Duration
+	}{
+		{name: "no suffix number", nodeName: "node", wantCode: framework.Success},
+		{name: "delayed by the suffix number", nodeName: "node3", wantCode: framework.Wait, wantDelay: 3 * time.Second},
+		{name: "delayMultiplier", args: `{"delayMultiplier": 0.5}`, nodeName: "node3", wantCode: framework.Wait, wantDelay: 1500 * time.Millisecond},
+		{name: "no delay", args: `{"delayMultiplier": 0}`, nodeName: "node3", wantCode: framework.Success},
+		{name: "too short delay to wait", args: `{"delayMultiplier": 0.01}`, nodeName: "node3", wantCode: framework.Success},
+		{name: "delay as long as the timeout", nodeName: "node10", wantCode: framework.Unschedulable},
+		{name: "delay longer than the timeout", args: `{"timeout": "5s"}`, nodeName: "node6", wantCode: framework.Unschedulable},
+		{name: "delay overflowing time.Duration", nodeName: "node99999999999999999", wantCode: framework.Unschedulable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := simclock.New(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+			h := &fakeHandle{clock: clk, waitingPods: map[types.UID]*waitingpod.WaitingPod{}}
+			pl, err := nodenumber.New(newArgs(tt.args), h)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			p := pl.(*nodenumber.NodeNumber)
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", UID: "uid"}}
+
+			status, timeout := p.Permit(context.Background(), framework.NewCycleState(), pod, tt.nodeName)
+			if got := status.Code(); got != tt.wantCode {
+				t.Fatalf("Permit(%s) = %v, want %v", tt.nodeName, status, tt.wantCode)
+			}
+			if tt.wantCode != framework.Wait {
+				return
+			}
+
+			// the scheduler registers the waiting pod after Permit returns.
+			wp := waitingpod.NewWaitingPod(pod, map[string]time.Duration{nodenumber.Name: timeout}, clk)
+			h.waitingPods[pod.UID] = wp
+			signal := make(chan *framework.Status, 1)
+			go func() { signal <- wp.GetSignal() }()
+
+			clk.Step(tt.wantDelay - time.Millisecond)
+			select {
+			case s := <-signal:
+				t.Fatalf("the pod got the signal before the delay: %v", s)
+			case <-time.After(50 * time.Millisecond):
+			}
+			clk.Step(time.Millisecond)
+			select {
+			case s := <-signal:
+				if !s.IsSuccess() {
+					t.Errorf("the pod is rejected after the delay: %v", s)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("the pod isn't allowed after the delay")
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package queue
+
+import (
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+var (
+	// NodeAdd is the event when a new node is added to the cluster.
+	NodeAdd = framework.ClusterEvent{Resource: framework.Node, ActionType: framework.Add, Label: "NodeAdd"}
+	// NodeSpecUnschedulableChange is the event when unschedulable node spec is changed.
+	NodeSpecUnschedulableChange = framework.ClusterEvent{Resource: framework.Node, ActionType: framework.UpdateNodeTaint, Label: "NodeSpecUnschedulableChange"}
+	// NodeAllocatableChange is the event when node allocatable is changed.
+	NodeAllocatableChange = framework.ClusterEvent{Resource: framework.Node, ActionType: framework.UpdateNodeAllocatable, Label: "NodeAllocatableChange"}
+	// NodeLabelChange is the event when node label is changed.
+	NodeLabelChange = framework.ClusterEvent{Resource: framework.Node, ActionType: framework.UpdateNodeLabel, Label: "NodeLabelChange"}
+	// NodeTaintChange is the event when node taint is changed.
+	NodeTaintChange = framework.ClusterEvent{Resource: framework.Node, ActionType: framework.UpdateNodeTaint, Label: "NodeTaintChange"}
+	// NodeConditionChange is the event when node condition is changed.
+	NodeConditionChange = framework.ClusterEvent{Resource: framework.Node, ActionType: framework.UpdateNodeCondition, Label: "NodeConditionChange"}
+	// StorageClassAdd is the event when a StorageClass is added in the cluster.
+	StorageClassAdd = framework.ClusterEvent{Resource: framework.StorageClass, ActionType: framework.Add, Label: "StorageClassAdd"}
+	// StorageClassUpdate is the event when a StorageClass is updated in the cluster.
+	StorageClassUpdate = framework.ClusterEvent{Resource: framework.StorageClass, ActionType: framework.Update, Label: "StorageClassUpdate"}
+	// UnschedulableTimeout is the event when a pod stays in unschedulable for longer than timeout.
+	UnschedulableTimeout = framework.ClusterEvent{Resource: framework.WildCard, ActionType: framework.All, Label: "UnschedulableTimeout"}
+)
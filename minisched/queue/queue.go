@@ -6,9 +6,9 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/utils/clock"
 )
 
 type SchedulingQueue struct {
@@ -20,9 +20,14 @@ type SchedulingQueue struct {
 
 	clusterEventMap map[framework.ClusterEvent]sets.String
 	stop            chan struct{}
+	// closed is true after Close. NextPod returns nil then.
+	closed bool
+
+	// clock is used for the timestamps of the pods and the periodic flushes.
+	clock clock.WithDelayedExecution
 }
 
-func New(clusterEventMap map[framework.ClusterEvent]sets.String) *SchedulingQueue {
+func New(clusterEventMap map[framework.ClusterEvent]sets.String, clk clock.WithDelayedExecution) *SchedulingQueue {
 	return &SchedulingQueue{
 		activeQ:         []*framework.QueuedPodInfo{},
 		podBackoffQ:     []*framework.QueuedPodInfo{},
@@ -30,19 +35,54 @@ func New(clusterEventMap map[framework.ClusterEvent]sets.String) *SchedulingQueu
 		clusterEventMap: clusterEventMap,
 		lock:            sync.NewCond(&sync.Mutex{}),
 		stop:            make(chan struct{}),
+		clock:           clk,
 	}
 }
 
-// Run starts the goroutine to pump from podBackoffQ to activeQ
+// Run starts the periodic flushes to pump from podBackoffQ and unschedulableQ to activeQ
 func (s *SchedulingQueue) Run() {
-	go wait.Until(s.flushBackoffQCompleted, 1*time.Second, s.stop)
-	go wait.Until(s.flushUnschedulablePodsLeftover, 1*time.Second, s.stop) // originally 30 sec
+	s.runEvery(s.flushBackoffQCompleted, 1*time.Second)
+	s.runEvery(s.flushUnschedulablePodsLeftover, 1*time.Second) // originally 30 sec
+}
+
+// backgroundClock is a simulated clock which can tell the housekeeping timers from those waited for,
+// such as *simclock.Clock.
+type backgroundClock interface {
+	AfterFuncInBackground(d time.Duration, f func()) clock.Timer
 }
 
+// runEvery calls f every period until the queue is closed.
+// clock.AfterFunc is used instead of wait.Until so that f runs on the virtual time with a simulated clock.
+// The flushes alone don't keep the simulated clock advancing, since no pod may be waiting for them.
+func (s *SchedulingQueue) runEvery(f func(), period time.Duration) {
+	afterFunc := s.clock.AfterFunc
+	if c, ok := s.clock.(backgroundClock); ok {
+		afterFunc = c.AfterFuncInBackground
+	}
+	var tick func()
+	tick = func() {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		f()
+		afterFunc(period, tick)
+	}
+	afterFunc(period, tick)
+}
+
+// Close stops the periodic flushes and wakes up NextPod, which returns nil after that.
+// It can be called more than once.
 func (s *SchedulingQueue) Close() {
 	s.lock.L.Lock()
 	defer s.lock.L.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
 	close(s.stop)
+	s.lock.Broadcast()
 }
 
 func (s *SchedulingQueue) Add(pod *v1.Pod) {
@@ -55,23 +95,79 @@ func (s *SchedulingQueue) Add(pod *v1.Pod) {
 	s.lock.Signal() // Awaken wait
 }
 
-func (s *SchedulingQueue) NextPod() *v1.Pod {
+// NextPod pops the pod at the head of activeQ, blocking until one is available or the queue is closed.
+// It returns nil if the queue is closed.
+// Like kube-scheduler, the number of the scheduling attempts of the pod is incremented, and the QueuedPodInfo
+// should be passed back to AddUnschedulable or AddBackoff if the attempt fails, so that the backoff grows.
+func (s *SchedulingQueue) NextPod() *framework.QueuedPodInfo {
 	// wait
 	s.lock.L.Lock()
-	for len(s.activeQ) == 0 {
+	for len(s.activeQ) == 0 && !s.closed {
 		klog.Info("NextPod: waiting")
 		s.lock.Wait()
 		klog.Info("NextPod: awoken")
 	}
+	if s.closed {
+		s.lock.L.Unlock()
+		return nil
+	}
 
 	p := s.activeQ[0]
 	s.activeQ = s.activeQ[1:]
+	p.Attempts++
 	s.lock.L.Unlock()
-	return p.Pod
+	return p
+}
+
+// HasActivePods returns true if activeQ has at least one pod, which means NextPod doesn't block.
+func (s *SchedulingQueue) HasActivePods() bool {
+	s.lock.L.Lock()
+	defer s.lock.L.Unlock()
+	return len(s.activeQ) > 0
+}
+
+// PendingPods returns all the pods in activeQ, podBackoffQ and unschedulableQ.
+func (s *SchedulingQueue) PendingPods() []*v1.Pod {
+	s.lock.L.Lock()
+	defer s.lock.L.Unlock()
+	result := make([]*v1.Pod, 0, len(s.activeQ)+len(s.podBackoffQ)+len(s.unschedulableQ))
+	for _, pInfo := range s.activeQ {
+		result = append(result, pInfo.Pod)
+	}
+	for _, pInfo := range s.podBackoffQ {
+		result = append(result, pInfo.Pod)
+	}
+	for _, pInfo := range s.unschedulableQ {
+		result = append(result, pInfo.Pod)
+	}
+	return result
+}
+
+// NominatedPodsForNode returns the pending pods nominated to run on the node (i.e. Status.NominatedNodeName),
+// e.g. by preemption of another scheduler before the cluster state is imported.
+func (s *SchedulingQueue) NominatedPodsForNode(nodeName string) []*framework.PodInfo {
+	s.lock.L.Lock()
+	defer s.lock.L.Unlock()
+	var result []*framework.PodInfo
+	add := func(pInfo *framework.QueuedPodInfo) {
+		if pInfo.Pod.Status.NominatedNodeName == nodeName {
+			result = append(result, pInfo.PodInfo)
+		}
+	}
+	for _, pInfo := range s.activeQ {
+		add(pInfo)
+	}
+	for _, pInfo := range s.podBackoffQ {
+		add(pInfo)
+	}
+	for _, pInfo := range s.unschedulableQ {
+		add(pInfo)
+	}
+	return result
 }
 
 func (s *SchedulingQueue) newQueuedPodInfo(pod *v1.Pod, unschedulableplugins ...string) *framework.QueuedPodInfo {
-	now := time.Now()
+	now := s.clock.Now()
 	return &framework.QueuedPodInfo{
 		PodInfo:                 framework.NewPodInfo(pod),
 		Timestamp:               now,
@@ -85,7 +181,7 @@ func (s *SchedulingQueue) AddUnschedulable(pInfo *framework.QueuedPodInfo) error
 	defer s.lock.L.Unlock()
 
 	// Refresh the timestamp since the pod is re-added.
-	pInfo.Timestamp = time.Now()
+	pInfo.Timestamp = s.clock.Now()
 
 	// add or update
 	s.unschedulableQ[keyFunc(pInfo)] = pInfo
@@ -94,6 +190,32 @@ func (s *SchedulingQueue) AddUnschedulable(pInfo *framework.QueuedPodInfo) error
 	return nil
 }
 
+// AddBackoff adds the pod which failed for a reason other than the plugins (e.g. an error of API server)
+// to podBackoffQ, so that it's retried after the backoff by its attempts without waiting for a cluster event.
+// The pod is ignored if it's already in activeQ or podBackoffQ (e.g. a new pod with the same name is added),
+// and it replaces the pod in unschedulableQ.
+func (s *SchedulingQueue) AddBackoff(pInfo *framework.QueuedPodInfo) {
+	s.lock.L.Lock()
+	defer s.lock.L.Unlock()
+
+	key := keyFunc(pInfo)
+	for _, q := range [][]*framework.QueuedPodInfo{s.activeQ, s.podBackoffQ} {
+		for _, p := range q {
+			if keyFunc(p) == key {
+				klog.Infof("queue: pod is already in activeQ or podBackoffQ: %s", pInfo.Pod.Name)
+				return
+			}
+		}
+	}
+	delete(s.unschedulableQ, key)
+
+	// Refresh the timestamp since the pod is re-added.
+	pInfo.Timestamp = s.clock.Now()
+	s.podBackoffQ = append(s.podBackoffQ, pInfo)
+
+	klog.Infof("queue: pod added to podBackoffQ: %s (attempts: %d)", pInfo.Pod.Name, pInfo.Attempts)
+}
+
 func keyFunc(pInfo *framework.QueuedPodInfo) string {
 	return pInfo.Pod.Name + "_" + pInfo.Pod.Namespace
 }
@@ -146,7 +268,7 @@ func (s *SchedulingQueue) movePodsToActiveOrBackoffQueue(podInfoList []*framewor
 			continue
 		}
 
-		if isPodBackingoff(pInfo) {
+		if s.isPodBackingoff(pInfo) {
 			klog.Infof("queue: add Pod(%s) to podBackoffQ", pInfo.Pod.Name)
 			s.podBackoffQ = append(s.podBackoffQ, pInfo)
 		} else {
@@ -172,10 +294,11 @@ func intersect(x, y sets.String) bool {
 
 // isPodBackingoff returns true if a pod is still waiting for its backoff timer.
 // If this returns true, the pod should not be re-tried.
-func isPodBackingoff(podInfo *framework.QueuedPodInfo) bool {
+func (s *SchedulingQueue) isPodBackingoff(podInfo *framework.QueuedPodInfo) bool {
 	boTime := getBackoffTime(podInfo)
-	klog.Infof("queue: Pod: %s, backoff time: %s, now: %s", podInfo.Pod.Name, boTime, time.Now())
-	return boTime.After(time.Now())
+	now := s.clock.Now()
+	klog.Infof("queue: Pod: %s, backoff time: %s, now: %s", podInfo.Pod.Name, boTime, now)
+	return boTime.After(now)
 }
 
 // getBackoffTime returns the time that podInfo completes backoff
@@ -191,8 +314,6 @@ const (
 	podMaxInUnschedulablePodsDuration = 5 * time.Minute
 )
 
-var UnschedulableTimeout = framework.ClusterEvent{Resource: framework.WildCard, ActionType: framework.All, Label: "UnschedulableTimeout"}
-
 // calculateBackoffDuration is a helper function for calculating the backoffDuration
 // based on the number of attempts the pod has made.
 func calculateBackoffDuration(podInfo *framework.QueuedPodInfo) time.Duration {
@@ -207,35 +328,27 @@ func calculateBackoffDuration(podInfo *framework.QueuedPodInfo) time.Duration {
 	return duration
 }
 
-// flushBackoffQCompleted Moves all pods from backoffQ which have completed backoff in to activeQ
+// flushBackoffQCompleted moves all pods from podBackoffQ which have completed backoff to activeQ.
+// podBackoffQ isn't ordered by the backoff time since the pods have different attempts, so all the pods are checked.
 func (s *SchedulingQueue) flushBackoffQCompleted() {
 	s.lock.L.Lock()
 	defer s.lock.L.Unlock()
-	for {
-		if len(s.podBackoffQ) == 0 {
-			break
-		}
-
-		podBackoffQLen := len(s.podBackoffQ)
-		queuedPodInfo := s.podBackoffQ[0] // Get item
-		s.podBackoffQ = s.podBackoffQ[1:] // Remove the first item
-		klog.Infof("flushBackoffQCompleted: podBackOffQ: %d -> %d", podBackoffQLen, len(s.podBackoffQ))
-		if queuedPodInfo == nil {
-			klog.Info("flushBackoffQCompleted: queuedPodInfo is nil")
-			break
-		}
 
-		boTime := getBackoffTime(queuedPodInfo)
-		if boTime.After(time.Now()) {
-			s.podBackoffQ = append(s.podBackoffQ, queuedPodInfo) // Put to the last
-			klog.Infof("flushBackoffQCompleted: put pod(%s) back to podBackoffQ (backoffTime: %s, now: %s)", queuedPodInfo.Pod.Name, boTime, time.Now())
-			break
-		} else {
-			s.activeQ = append(s.activeQ, queuedPodInfo)
-			s.lock.Signal() // awaken Wait() in NextPod()
-			klog.Infof("flushBackoffQCompleted: added pod(%s) to activeQ", queuedPodInfo.Pod.Name)
+	now := s.clock.Now()
+	backingOff := make([]*framework.QueuedPodInfo, 0, len(s.podBackoffQ))
+	for _, queuedPodInfo := range s.podBackoffQ {
+		if boTime := getBackoffTime(queuedPodInfo); boTime.After(now) {
+			backingOff = append(backingOff, queuedPodInfo)
+			continue
 		}
+		s.activeQ = append(s.activeQ, queuedPodInfo)
+		s.lock.Signal() // awaken Wait() in NextPod()
+		klog.Infof("flushBackoffQCompleted: added pod(%s) to activeQ", queuedPodInfo.Pod.Name)
+	}
+	if len(backingOff) != len(s.podBackoffQ) {
+		klog.Infof("flushBackoffQCompleted: podBackOffQ: %d -> %d", len(s.podBackoffQ), len(backingOff))
 	}
+	s.podBackoffQ = backingOff
 }
 
 // flushUnschedulablePodsLeftover moves pods which stay in unschedulableQ
@@ -245,7 +358,7 @@ func (s *SchedulingQueue) flushUnschedulablePodsLeftover() {
 	defer s.lock.L.Unlock()
 
 	var podsToMove []*framework.QueuedPodInfo
-	currentTime := time.Now()
+	currentTime := s.clock.Now()
 	for _, pInfo := range s.unschedulableQ {
 		lastScheduleTime := pInfo.Timestamp
 		if currentTime.Sub(lastScheduleTime) > podMaxInUnschedulablePodsDuration {
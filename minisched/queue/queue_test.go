@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched/simclock"
+)
+
+func newPod(name string) *v1.Pod {
+	return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceDefault, Name: name, UID: types.UID(name)}}
+}
+
+func newTestQueue() (*SchedulingQueue, *simclock.Clock) {
+	clk := simclock.New(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	return New(map[framework.ClusterEvent]sets.String{}, clk), clk
+}
+
+func names(pInfos []*framework.QueuedPodInfo) []string {
+	var result []string
+	for _, p := range pInfos {
+		result = append(result, p.Pod.Name)
+	}
+	return result
+}
+
+func TestAddBackoff(t *testing.T) {
+	q, _ := newTestQueue()
+
+	q.Add(newPod("active"))
+	q.AddBackoff(q.newQueuedPodInfo(newPod("backoff")))
+	if err := q.AddUnschedulable(q.newQueuedPodInfo(newPod("unschedulable"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pods already in activeQ or podBackoffQ are not added again.
+	q.AddBackoff(q.newQueuedPodInfo(newPod("active")))
+	q.AddBackoff(q.newQueuedPodInfo(newPod("backoff")))
+	// the pod in unschedulableQ is moved to podBackoffQ.
+	q.AddBackoff(q.newQueuedPodInfo(newPod("unschedulable")))
+
+	if got := names(q.activeQ); len(got) != 1 || got[0] != "active" {
+		t.Errorf("activeQ = %v, want [active]", got)
+	}
+	if got := names(q.podBackoffQ); len(got) != 2 || got[0] != "backoff" || got[1] != "unschedulable" {
+		t.Errorf("podBackoffQ = %v, want [backoff unschedulable]", got)
+	}
+	if len(q.unschedulableQ) != 0 {
+		t.Errorf("unschedulableQ has %d pods, want none", len(q.unschedulableQ))
+	}
+}
+
+func TestFlushBackoffQCompleted(t *testing.T) {
+	q, clk := newTestQueue()
+
+	// the pod at the head backs off for 8s by its attempts, longer than the pod added after it.
+	long := q.newQueuedPodInfo(newPod("long"))
+	long.Attempts = 4
+	q.AddBackoff(long)
+	short := q.newQueuedPodInfo(newPod("short"))
+	short.Attempts = 1
+	q.AddBackoff(short)
+
+	clk.Step(time.Second)
+	q.flushBackoffQCompleted()
+	if got := names(q.activeQ); len(got) != 1 || got[0] != "short" {
+		t.Errorf("activeQ after 1s = %v, want [short]", got)
+	}
+	if got := names(q.podBackoffQ); len(got) != 1 || got[0] != "long" {
+		t.Errorf("podBackoffQ after 1s = %v, want [long]", got)
+	}
+
+	clk.Step(7 * time.Second)
+	q.flushBackoffQCompleted()
+	if got := names(q.activeQ); len(got) != 2 || got[1] != "long" {
+		t.Errorf("activeQ after 8s = %v, want [short long]", got)
+	}
+	if len(q.podBackoffQ) != 0 {
+		t.Errorf("podBackoffQ after 8s = %v, want empty", names(q.podBackoffQ))
+	}
+}
+
+func TestNextPodReturnsNilAfterClose(t *testing.T) {
+	q, _ := newTestQueue()
+	q.Run()
+
+	got := make(chan *framework.QueuedPodInfo)
+	go func() {
+		got <- q.NextPod()
+	}()
+	q.Close()
+	select {
+	case p := <-got:
+		if p != nil {
+			t.Errorf("NextPod after Close = %v, want nil", p.Pod.Name)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("NextPod is still blocked after Close")
+	}
+
+	// Close can be called again, and NextPod doesn't block once the queue is closed.
+	q.Close()
+	q.Add(newPod("pod"))
+	if p := q.NextPod(); p != nil {
+		t.Errorf("NextPod after Close = %v, want nil", p.Pod.Name)
+	}
+}
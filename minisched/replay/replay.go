@@ -0,0 +1,228 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/harness"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/simclock"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/trace"
+)
+
+const defaultDecisionTimeout = 15 * time.Second
+
+// Options is the options for Replay.
+type Options struct {
+	// DecisionTimeout is the virtual time to wait for a pod to be in activeQ at each recorded decision.
+	// Defaults to 15s, which is longer than the max backoff duration.
+	DecisionTimeout time.Duration
+	// SchedulerOptions are passed to minisched.New. For example, they can change the plugins to compare.
+	SchedulerOptions []minisched.Option
+}
+
+// Diff is a scheduling decision which differs between the trace and the replay.
+type Diff struct {
+	Recorded *trace.SchedulingDecision `json:"recorded"`
+	// Replayed is nil if no pod was in activeQ in the replay.
+	Replayed *trace.SchedulingDecision `json:"replayed,omitempty"`
+}
+
+// Result is the result of Replay.
+type Result struct {
+	// Decisions is the number of the recorded decisions.
+	Decisions int    `json:"decisions"`
+	Diffs     []Diff `json:"diffs,omitempty"`
+}
+
+// Replay feeds the recorded informer events to the event handlers of a fresh minisched.Scheduler
+// running against a fake clientset, runs a scheduling cycle at each recorded decision, and
+// returns the decisions which differ from the recorded ones.
+//
+// The scheduler runs on a simulated clock which is set to the recorded time of each event,
+// so the backoffs and the timeouts are replayed without waiting in real time.
+func Replay(ctx context.Context, events []*trace.Event, opts Options) (*Result, error) {
+	timeout := opts.DecisionTimeout
+	if timeout == 0 {
+		timeout = defaultDecisionTimeout
+	}
+	if len(events) == 0 {
+		return &Result{}, nil
+	}
+
+	clk := simclock.New(events[0].Time)
+	collector := &trace.Collector{}
+	schedOpts := append([]minisched.Option{}, opts.SchedulerOptions...)
+	schedOpts = append(schedOpts, minisched.WithClock(clk), minisched.WithTraceRecorder(collector))
+	h, err := harness.New(schedOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("create harness: %w", err)
+	}
+	// The informers of the harness are not started. Instead, the recorded events are applied to
+	// the fake clientset so that the scheduler can bind pods, and the informer caches are synced with it
+	// so that the scheduler takes the snapshots of them.
+	tracker := h.Client.Tracker()
+
+	h.Scheduler.SchedulingQueue.Run()
+	defer h.Scheduler.SchedulingQueue.Close()
+
+	result := &Result{}
+	// replayedNodes is the node selected for each pod (namespace/name) in the replay, or empty if the pod failed.
+	replayedNodes := map[string]string{}
+	for i, e := range events {
+		switch e.Type {
+		case trace.Informer:
+			clk.SetTime(e.Time)
+			if err := apply(tracker, e.Informer); err != nil {
+				return nil, fmt.Errorf("apply event %d: %w", i, err)
+			}
+			if err := h.SyncCaches(ctx); err != nil {
+				return nil, fmt.Errorf("sync caches at event %d: %w", i, err)
+			}
+			if err := h.Scheduler.ReplayEvent(withReplayedNode(e.Informer, replayedNodes)); err != nil {
+				return nil, fmt.Errorf("replay event %d: %w", i, err)
+			}
+		case trace.Decision:
+			result.Decisions++
+			clk.SetTime(e.Decision.CycleStart)
+			replayed, err := scheduleOne(ctx, h, clk, collector, timeout)
+			if err != nil {
+				return nil, fmt.Errorf("replay decision %d: %w", i, err)
+			}
+			if replayed != nil {
+				replayedNodes[replayed.Pod] = replayed.NodeName
+			}
+			if !sameDecision(e.Decision, replayed) {
+				result.Diffs = append(result.Diffs, Diff{Recorded: e.Decision, Replayed: replayed})
+			}
+		default:
+			return nil, fmt.Errorf("unknown event type %q at %d", e.Type, i)
+		}
+	}
+
+	return result, nil
+}
+
+// scheduleOne advances the clock until a pod comes to activeQ and runs a scheduling cycle.
+// It returns nil if no pod comes to activeQ within the timeout.
+func scheduleOne(ctx context.Context, h *harness.Harness, clk *simclock.Clock, collector *trace.Collector, timeout time.Duration) (*trace.SchedulingDecision, error) {
+	deadline := clk.Now().Add(timeout)
+	for !h.Scheduler.SchedulingQueue.HasActivePods() {
+		next, ok := clk.Next()
+		if !ok || next.After(deadline) {
+			return nil, nil
+		}
+		clk.SetTime(next)
+	}
+
+	// the pods bound in the previous cycles are in the fake clientset.
+	if err := h.SyncCaches(ctx); err != nil {
+		return nil, err
+	}
+	n := len(collector.Events())
+	h.ScheduleOne(ctx)
+	events := collector.Events()
+	if len(events) == n {
+		return nil, fmt.Errorf("no decision is recorded by the scheduling cycle")
+	}
+	return events[len(events)-1].Decision, nil
+}
+
+// apply applies the informer event to the fake clientset.
+// Pod updates are not applied because the scheduler binds the pods by itself in the replay.
+func apply(tracker k8stesting.ObjectTracker, e *trace.InformerEvent) error {
+	var obj runtime.Object
+	var gvr schema.GroupVersionResource
+	switch {
+	case e.Pod != nil:
+		if e.Action == trace.ActionUpdate {
+			return nil
+		}
+		obj, gvr = e.Pod.DeepCopy(), v1.SchemeGroupVersion.WithResource("pods")
+	case e.Node != nil:
+		obj, gvr = e.Node.DeepCopy(), v1.SchemeGroupVersion.WithResource("nodes")
+	default:
+		return fmt.Errorf("event has no object")
+	}
+
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	switch e.Action {
+	case trace.ActionAdd:
+		return ignoreAlreadyExists(tracker.Add(obj))
+	case trace.ActionUpdate:
+		return tracker.Update(gvr, obj, m.GetNamespace())
+	case trace.ActionDelete:
+		return ignoreNotFound(tracker.Delete(gvr, m.GetNamespace(), m.GetName()))
+	}
+	return fmt.Errorf("unknown action %q", e.Action)
+}
+
+// withReplayedNode returns the pod event with Spec.NodeName replaced by the node selected in the replay, if the pod
+// was scheduled in the replay. Otherwise the event of the recorded binding would tell the event handlers that the pod
+// is bound to the recorded node. If the pod failed in the replay, the recorded binding becomes an update between
+// unassigned pods, which the event handlers ignore.
+func withReplayedNode(e *trace.InformerEvent, replayedNodes map[string]string) *trace.InformerEvent {
+	if e.Pod == nil {
+		return e
+	}
+	nodeName, ok := replayedNodes[e.Pod.Namespace+"/"+e.Pod.Name]
+	if !ok {
+		return e
+	}
+
+	rewritten := *e
+	rewrite := func(pod *v1.Pod) *v1.Pod {
+		if pod == nil || pod.Spec.NodeName == "" || pod.Spec.NodeName == nodeName {
+			return pod
+		}
+		pod = pod.DeepCopy()
+		pod.Spec.NodeName = nodeName
+		return pod
+	}
+	rewritten.Pod = rewrite(e.Pod)
+	rewritten.OldPod = rewrite(e.OldPod)
+	return &rewritten
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func ignoreAlreadyExists(err error) error {
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// sameDecision returns true if both decisions are for the same pod and have the same result: the selected node,
+// the error and the failed plugin and the message for each node. The scores are compared only if they were recorded,
+// because they are not recorded when no node passes the filter plugins.
+func sameDecision(recorded, replayed *trace.SchedulingDecision) bool {
+	if replayed == nil {
+		return false
+	}
+	if recorded.Pod != replayed.Pod || recorded.NodeName != replayed.NodeName || recorded.Error != replayed.Error {
+		return false
+	}
+	// the statuses are omitted from the trace if empty.
+	if (len(recorded.Statuses) > 0 || len(replayed.Statuses) > 0) && !reflect.DeepEqual(recorded.Statuses, replayed.Statuses) {
+		return false
+	}
+	return recorded.Scores == nil || reflect.DeepEqual(recorded.Scores, replayed.Scores)
+}
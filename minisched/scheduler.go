@@ -3,51 +3,139 @@ package minisched
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"time"
 
+	"github.com/nakamasato/mini-kube-scheduler/minisched/trace"
 	"github.com/nakamasato/mini-kube-scheduler/minisched/waitingpod"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
 	"k8s.io/klog/v2"
+	podutil "k8s.io/kubernetes/pkg/api/v1/pod"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
+	schedutil "k8s.io/kubernetes/pkg/scheduler/util"
+	"k8s.io/utils/clock"
 
+	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
+// simIdleWait is the real time to wait before advancing the simulated clock,
+// so that the binding goroutines and the informers catch up with the scheduling cycles.
+const simIdleWait = 1 * time.Millisecond
+
+// simQuietPeriod is the real time for which the scheduler must stay idle before the simulated clock is advanced
+// only for the other components, so that API server, the informers and the controllers catch up.
+const simQuietPeriod = 100 * time.Millisecond
+
+// simulatedClock is a clock which doesn't pass by itself, such as *simclock.Clock.
+type simulatedClock interface {
+	AdvanceToNext() bool
+	// HasPendingTimers returns true if something (e.g. the fake kubelet or a scenario) waits on the clock.
+	HasPendingTimers() bool
 }
 
+// Run runs the scheduling cycles until ctx is done. The scheduling queue is closed when ctx is done,
+// which wakes up the scheduling cycle waiting for a pod.
 func (sched *Scheduler) Run(ctx context.Context) {
 	sched.SchedulingQueue.Run()
-	wait.UntilWithContext(ctx, sched.scheduleOne, 0)
-	sched.SchedulingQueue.Close()
+	go func() {
+		<-ctx.Done()
+		sched.SchedulingQueue.Close()
+	}()
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		sched.advanceSimulatedClock(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		sched.ScheduleOne(ctx)
+	}, 0)
 }
 
-func (sched *Scheduler) scheduleOne(ctx context.Context) {
+// advanceSimulatedClock advances the clock to the next timer while no pod is in activeQ
+// but some pods are waiting for the time to pass (backoff, unschedulable timeout or permit),
+// or the other components sharing the clock wait on it (e.g. the startup latency of the fake kubelet).
+// It does nothing with a real clock. With a simulated clock, it returns only when a pod is in activeQ or ctx is done,
+// so that the clock can be advanced for the other components while no pod is pending. If nothing waits,
+// the clock isn't advanced, so that the virtual time doesn't run away while nothing happens.
+// The clock is advanced for the other components only after the scheduler stays idle for simQuietPeriod,
+// since they may be about to create pods (e.g. the workload controllers) in real time.
+func (sched *Scheduler) advanceSimulatedClock(ctx context.Context) {
+	c, ok := sched.clock.(simulatedClock)
+	if !ok {
+		return
+	}
+	quietSince := time.Now()
+	for ctx.Err() == nil {
+		time.Sleep(simIdleWait)
+		if sched.SchedulingQueue.HasActivePods() {
+			return
+		}
+		if len(sched.SchedulingQueue.PendingPods()) == 0 && sched.numWaitingPods() == 0 {
+			if !c.HasPendingTimers() || time.Since(quietSince) < simQuietPeriod {
+				continue
+			}
+		}
+		c.AdvanceToNext()
+		quietSince = time.Now()
+	}
+}
+
+// ScheduleOne does the entire scheduling workflow for a single pod.
+// It blocks until a pod is available in activeQ, and returns without scheduling if the queue is closed.
+func (sched *Scheduler) ScheduleOne(ctx context.Context) {
 	klog.Info("minischeduler: Try to get pod from activeQ")
-	pod := sched.SchedulingQueue.NextPod()
+	podInfo := sched.SchedulingQueue.NextPod()
+	if podInfo == nil {
+		return
+	}
+	pod := podInfo.Pod
 	klog.Info("minischeduler: Start schedule(" + pod.Name + ")")
+	sched.cycleLock.Lock()
+	defer sched.cycleLock.Unlock()
+	cycleStart := sched.clock.Now()
 
 	state := framework.NewCycleState()
 
-	// get nodes
-	nodes, err := sched.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-	if err != nil {
+	// take the snapshot of nodes and pods
+	if err := sched.updateSnapshot(); err != nil {
+		klog.Error(err)
+		sched.recordDecision(pod, cycleStart, "", nil, err)
+		sched.ErrorFunc(podInfo, err)
+		return
+	}
+	klog.Info("minischeduler: got nodes: ", sched.snapshot.NumNodes())
+
+	// pre filter
+	status := sched.RunPreFilterPlugins(ctx, state, pod)
+	if !status.IsSuccess() {
+		err := status.AsError()
+		if status.IsUnschedulable() {
+			err = sched.preFilterFitError(pod, status)
+		}
 		klog.Error(err)
+		sched.recordDecision(pod, cycleStart, "", nil, err)
+		sched.ErrorFunc(podInfo, err)
 		return
 	}
-	klog.Info("minischeduler: Got Nodes successfully")
-	klog.Info("minischeduler: got nodes: ", len(nodes.Items))
+	klog.Info("minischeduler: ran pre filter plugins successfully")
 
 	// filter
-	feasibleNodes, err := sched.RunFilterPlugins(ctx, nil, pod, nodes.Items)
+	nodeInfos, err := sched.snapshot.NodeInfos().List()
 	if err != nil {
 		klog.Error(err)
-		sched.ErrorFunc(pod, err)
+		sched.recordDecision(pod, cycleStart, "", nil, err)
+		sched.ErrorFunc(podInfo, err)
+		return
+	}
+	feasibleNodes, err := sched.RunFilterPlugins(ctx, state, pod, nodeInfos)
+	if err != nil {
+		klog.Error(err)
+		sched.recordDecision(pod, cycleStart, "", nil, err)
+		sched.ErrorFunc(podInfo, err)
 		return
 	}
 
@@ -55,10 +143,11 @@ func (sched *Scheduler) scheduleOne(ctx context.Context) {
 	klog.Info("minischeduler: feasible nodes: ", len(feasibleNodes))
 
 	// pre score
-	status := sched.RunPreScorePlugins(ctx, state, pod, feasibleNodes)
+	status = sched.RunPreScorePlugins(ctx, state, pod, feasibleNodes)
 	if !status.IsSuccess() {
 		klog.Error(status.AsError())
-		sched.ErrorFunc(pod, err)
+		sched.recordDecision(pod, cycleStart, "", nil, status.AsError())
+		sched.ErrorFunc(podInfo, status.AsError())
 		return
 	}
 	klog.Info("minischeduler: ran pre score plugins successfully")
@@ -67,7 +156,8 @@ func (sched *Scheduler) scheduleOne(ctx context.Context) {
 	score, status := sched.RunScorePlugins(ctx, state, pod, feasibleNodes)
 	if !status.IsSuccess() {
 		klog.Error(status.AsError())
-		sched.ErrorFunc(pod, err)
+		sched.recordDecision(pod, cycleStart, "", nil, status.AsError())
+		sched.ErrorFunc(podInfo, status.AsError())
 		return
 	}
 
@@ -78,16 +168,37 @@ func (sched *Scheduler) scheduleOne(ctx context.Context) {
 	nodeName, err := sched.selectNode(score)
 	if err != nil {
 		klog.Error(err)
-		sched.ErrorFunc(pod, err)
+		sched.recordDecision(pod, cycleStart, "", score, err)
+		sched.ErrorFunc(podInfo, err)
+		return
+	}
+	klog.Info("minischeduler: selected node ", nodeName, " by ", sched.selectionStrategy, " (rank ", scoreRank(score, nodeName), " by score)")
+
+	// assume the pod is on the node so that the following scheduling cycles see it before binding.
+	// The plugins from Reserve to PreBind get the assumed pod, whose Spec.NodeName is set, like kube-scheduler.
+	assumedPod := sched.assume(pod, nodeName)
+
+	// reserve
+	status = sched.RunReservePluginsReserve(ctx, state, assumedPod, nodeName)
+	if !status.IsSuccess() {
+		klog.Error(status.AsError())
+		sched.RunReservePluginsUnreserve(ctx, state, assumedPod, nodeName)
+		sched.forget(pod)
+		sched.recordDecision(pod, cycleStart, "", score, status.AsError())
+		sched.ErrorFunc(podInfo, status.AsError())
 		return
 	}
 
-	status = sched.RunPermitPlugins(ctx, state, pod, nodeName)
+	status = sched.RunPermitPlugins(ctx, state, assumedPod, nodeName)
 	if status.Code() != framework.Wait && !status.IsSuccess() {
 		klog.Error(status.AsError())
-		sched.ErrorFunc(pod, err)
+		sched.RunReservePluginsUnreserve(ctx, state, assumedPod, nodeName)
+		sched.forget(pod)
+		sched.recordDecision(pod, cycleStart, "", score, status.AsError())
+		sched.ErrorFunc(podInfo, status.AsError())
 		return
 	}
+	sched.recordDecision(pod, cycleStart, nodeName, score, nil)
 
 	go func() {
 		ctx := ctx
@@ -95,26 +206,45 @@ func (sched *Scheduler) scheduleOne(ctx context.Context) {
 		status := sched.WaitOnPermit(ctx, pod)
 		if !status.IsSuccess() {
 			klog.Error(status.AsError())
-			sched.ErrorFunc(pod, err)
+			sched.RunReservePluginsUnreserve(ctx, state, assumedPod, nodeName)
+			sched.forget(pod)
+			sched.ErrorFunc(podInfo, status.AsError())
+			return
+		}
+
+		// pre bind, e.g. VolumeBinding binds the volumes of the pod and waits until the PV controller completes it.
+		status = sched.RunPreBindPlugins(ctx, state, assumedPod, nodeName)
+		if !status.IsSuccess() {
+			klog.Error(status.AsError())
+			sched.RunReservePluginsUnreserve(ctx, state, assumedPod, nodeName)
+			sched.forget(pod)
+			sched.ErrorFunc(podInfo, status.AsError())
 			return
 		}
 
-		if err := sched.Bind(ctx, pod, nodeName); err != nil {
-			klog.Error(err)
-			sched.ErrorFunc(pod, err)
+		if err := sched.bindWithRetries(ctx, pod, nodeName); err != nil {
+			sched.RunReservePluginsUnreserve(ctx, state, assumedPod, nodeName)
+			sched.forget(pod)
+			sched.handleBindingFailure(podInfo, err)
 			return
 		}
+		// the bound pod stays assumed until the informer observes it on the node.
+		sched.finishBinding(pod)
 		klog.Info("minischeduler: Bind Pod successfully")
 	}()
 }
 
 // WaitOnPermit will block, if the pod is a waiting pod, until the waiting pod is rejected or allowed.
 func (sched *Scheduler) WaitOnPermit(ctx context.Context, pod *v1.Pod) *framework.Status {
-	waitingPod := sched.waitingPods[pod.UID]
+	waitingPod := sched.GetWaitingPod(pod.UID)
 	if waitingPod == nil {
 		return nil
 	}
-	defer delete(sched.waitingPods, pod.UID)
+	defer func() {
+		sched.waitingPodsLock.Lock()
+		defer sched.waitingPodsLock.Unlock()
+		delete(sched.waitingPods, pod.UID)
+	}()
 
 	klog.Info("minischeduler: Pod waiting on permit. pod: ", klog.KObj(pod))
 
@@ -136,6 +266,70 @@ func (sched *Scheduler) WaitOnPermit(ctx context.Context, pod *v1.Pod) *framewor
 	return nil
 }
 
+// bindRetryBackoff is the backoff of the retries of the binding on transient errors of API server.
+// The retries wait in real time even with a simulated clock, since they wait for API server.
+var bindRetryBackoff = wait.Backoff{
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+}
+
+// bindWithRetries binds the pod to the node, retrying on the transient errors of API server up to
+// bindRetryBackoff.Steps times. A conflict means that the pod has been bound (or replaced by a new pod with the same
+// name), and it's regarded as success if the pod is bound to the node, e.g. by a previous attempt whose response was lost.
+func (sched *Scheduler) bindWithRetries(ctx context.Context, pod *v1.Pod, nodeName string) error {
+	var err error
+	retryErr := wait.ExponentialBackoffWithContext(ctx, bindRetryBackoff, func() (bool, error) {
+		err = sched.Bind(ctx, pod, nodeName)
+		if err == nil || !isTransientBindError(err) {
+			return true, nil
+		}
+		klog.ErrorS(err, "minischeduler: Failed to bind pod; retrying", "pod", klog.KObj(pod), "node", nodeName)
+		return false, nil
+	})
+	if retryErr != nil && err == nil {
+		// ctx is done before the first attempt.
+		err = retryErr
+	}
+
+	if apierrors.IsConflict(err) {
+		latest, getErr := sched.client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if getErr == nil && latest.UID == pod.UID && latest.Spec.NodeName == nodeName {
+			return nil
+		}
+	}
+	return err
+}
+
+// isTransientBindError returns whether the binding may succeed if it's retried.
+func isTransientBindError(err error) bool {
+	return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) ||
+		utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) || utilnet.IsProbableEOF(err)
+}
+
+// handleBindingFailure handles the error of bindWithRetries after the pod is unreserved and forgotten:
+//   - NotFound: the pod has been deleted, so it's dropped.
+//   - Conflict: the pod has been bound to another node (or replaced by a new pod with the same name), so it's dropped.
+//     The following scheduling cycles see the bound pod in the snapshot taken from the informer cache.
+//   - the others (including the transient errors which the retries didn't resolve): the pod is requeued to
+//     podBackoffQ with its attempts, since no cluster event will make the binding succeed.
+func (sched *Scheduler) handleBindingFailure(podInfo *framework.QueuedPodInfo, err error) {
+	pod := podInfo.Pod
+	switch {
+	case apierrors.IsNotFound(err):
+		klog.InfoS("minischeduler: Pod is deleted while binding; dropping it", "pod", klog.KObj(pod), "err", err)
+	case apierrors.IsConflict(err):
+		klog.InfoS("minischeduler: Pod is already bound or replaced; dropping it", "pod", klog.KObj(pod), "err", err)
+	default:
+		klog.ErrorS(err, "minischeduler: Failed to bind pod; requeueing it with backoff", "pod", klog.KObj(pod), "attempts", podInfo.Attempts)
+		podInfo.UnschedulablePlugins = sets.NewString()
+		sched.SchedulingQueue.AddBackoff(podInfo)
+		sched.updateSchedulingFailedCondition(pod, err)
+	}
+}
+
 func (sched *Scheduler) Bind(ctx context.Context, p *v1.Pod, nodeName string) error {
 	binding := &v1.Binding{
 		ObjectMeta: metav1.ObjectMeta{Namespace: p.Namespace, Name: p.Name, UID: p.UID},
@@ -149,45 +343,182 @@ func (sched *Scheduler) Bind(ctx context.Context, p *v1.Pod, nodeName string) er
 	return nil
 }
 
-func (sched *Scheduler) RunFilterPlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodes []v1.Node) ([]*v1.Node, error) {
-	feasibleNodes := make([]*v1.Node, 0, len(nodes))
+// RunPreFilterPlugins runs the pre filter plugins. It returns the first non-success status.
+func (sched *Scheduler) RunPreFilterPlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod) *framework.Status {
+	for _, pl := range sched.preFilterPlugins {
+		status := pl.PreFilter(ctx, state, pod)
+		if !status.IsSuccess() {
+			status.SetFailedPlugin(pl.Name())
+			if status.IsUnschedulable() {
+				return status
+			}
+			return framework.AsStatus(fmt.Errorf("running PreFilter plugin %q: %w", pl.Name(), status.AsError())).WithFailedPlugin(pl.Name())
+		}
+	}
+
+	return nil
+}
+
+// preFilterFitError returns the FitError with the unschedulable status of a pre filter plugin for all nodes.
+func (sched *Scheduler) preFilterFitError(pod *v1.Pod, status *framework.Status) *framework.FitError {
+	nodeInfos, _ := sched.snapshot.NodeInfos().List()
+	diagnosis := framework.Diagnosis{
+		NodeToStatusMap:      make(framework.NodeToStatusMap, len(nodeInfos)),
+		UnschedulablePlugins: sets.NewString(status.FailedPlugin()),
+	}
+	for _, n := range nodeInfos {
+		diagnosis.NodeToStatusMap[n.Node().Name] = status
+	}
+	return &framework.FitError{
+		Pod:         pod,
+		NumAllNodes: len(nodeInfos),
+		Diagnosis:   diagnosis,
+	}
+}
+
+func (sched *Scheduler) RunFilterPlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeInfos []*framework.NodeInfo) ([]*v1.Node, error) {
+	feasibleNodes := make([]*v1.Node, 0, len(nodeInfos))
 
 	diagnosis := framework.Diagnosis{
 		NodeToStatusMap:      make(framework.NodeToStatusMap),
 		UnschedulablePlugins: sets.NewString(),
 	}
 
-	// TODO: consider about nominated pod
-	for _, n := range nodes {
-		n := n
-		nodeInfo := framework.NewNodeInfo()
-		nodeInfo.SetNode(&n)
-
-		status := framework.NewStatus(framework.Success)
-		for _, pl := range sched.filterPlugins {
-			status = pl.Filter(ctx, state, pod, nodeInfo)
-			if !status.IsSuccess() {
-				status.SetFailedPlugin(pl.Name())
-				diagnosis.UnschedulablePlugins.Insert(status.FailedPlugin())
-				break
+	for _, nodeInfo := range nodeInfos {
+		status := sched.RunFilterPluginsWithNominatedPods(ctx, state, pod, nodeInfo)
+		if !status.IsSuccess() {
+			if !status.IsUnschedulable() {
+				return nil, status.AsError()
 			}
+			diagnosis.NodeToStatusMap[nodeInfo.Node().Name] = status
+			diagnosis.UnschedulablePlugins.Insert(status.FailedPlugin())
+			continue
 		}
-		if status.IsSuccess() {
-			feasibleNodes = append(feasibleNodes, nodeInfo.Node())
-		}
-
+		feasibleNodes = append(feasibleNodes, nodeInfo.Node())
 	}
 
 	if len(feasibleNodes) == 0 {
 		return nil, &framework.FitError{
-			Pod:       pod,
-			Diagnosis: diagnosis,
+			Pod:         pod,
+			NumAllNodes: len(nodeInfos),
+			Diagnosis:   diagnosis,
 		}
 	}
 
 	return feasibleNodes, nil
 }
 
+// RunFilterPluginsWithNominatedPods runs the filter plugins for the pod on the node like kube-scheduler:
+// if some pods with equal or greater priority are nominated to the node, the filter plugins run twice,
+// once with the nominated pods added to the node and once without them, and the pod fits the node only if both pass.
+// The nominated pods are added by the AddPod of the PreFilterExtensions, so that the plugins can update their
+// PreFilter state without computing it again.
+func (sched *Scheduler) RunFilterPluginsWithNominatedPods(ctx context.Context, state *framework.CycleState, pod *v1.Pod, info *framework.NodeInfo) *framework.Status {
+	var status *framework.Status
+
+	podsAdded := false
+	for i := 0; i < 2; i++ {
+		stateToUse := state
+		nodeInfoToUse := info
+		if i == 0 {
+			var err error
+			podsAdded, stateToUse, nodeInfoToUse, err = sched.addNominatedPods(ctx, pod, state, info)
+			if err != nil {
+				return framework.AsStatus(err)
+			}
+		} else if !podsAdded || !status.IsSuccess() {
+			break
+		}
+
+		status = sched.runFilterPlugins(ctx, stateToUse, pod, nodeInfoToUse)
+		if !status.IsSuccess() && !status.IsUnschedulable() {
+			return status
+		}
+	}
+
+	return status
+}
+
+// runFilterPlugins runs the filter plugins for the pod on the node, and returns the first non-success status.
+func (sched *Scheduler) runFilterPlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeInfo *framework.NodeInfo) *framework.Status {
+	for _, pl := range sched.filterPlugins {
+		status := pl.Filter(ctx, state, pod, nodeInfo)
+		if !status.IsSuccess() {
+			if !status.IsUnschedulable() {
+				// Filter plugins are not supposed to return any status other than
+				// Success or Unschedulable.
+				status = framework.AsStatus(fmt.Errorf("running %q filter plugin: %w", pl.Name(), status.AsError()))
+			}
+			status.SetFailedPlugin(pl.Name())
+			return status
+		}
+	}
+
+	return nil
+}
+
+// addNominatedPods adds the pods with equal or greater priority which are nominated to run on the node
+// to the copies of the state and the nodeInfo. It returns false if no pod is added.
+func (sched *Scheduler) addNominatedPods(ctx context.Context, pod *v1.Pod, state *framework.CycleState, nodeInfo *framework.NodeInfo) (bool, *framework.CycleState, *framework.NodeInfo, error) {
+	if nodeInfo.Node() == nil {
+		return false, state, nodeInfo, nil
+	}
+	nominatedPodInfos := sched.SchedulingQueue.NominatedPodsForNode(nodeInfo.Node().Name)
+	if len(nominatedPodInfos) == 0 {
+		return false, state, nodeInfo, nil
+	}
+	nodeInfoOut := nodeInfo.Clone()
+	stateOut := state.Clone()
+	podsAdded := false
+	for _, pi := range nominatedPodInfos {
+		if corev1helpers.PodPriority(pi.Pod) >= corev1helpers.PodPriority(pod) && pi.Pod.UID != pod.UID {
+			nodeInfoOut.AddPodInfo(pi)
+			status := sched.RunPreFilterExtensionAddPod(ctx, stateOut, pod, pi, nodeInfoOut)
+			if !status.IsSuccess() {
+				return false, state, nodeInfo, status.AsError()
+			}
+			podsAdded = true
+		}
+	}
+	return podsAdded, stateOut, nodeInfoOut, nil
+}
+
+// RunPreFilterExtensionAddPod calls the AddPod of the PreFilterExtensions of the pre filter plugins,
+// which updates their state for podToSchedule as if podInfoToAdd is added to the node.
+func (sched *Scheduler) RunPreFilterExtensionAddPod(ctx context.Context, state *framework.CycleState, podToSchedule *v1.Pod, podInfoToAdd *framework.PodInfo, nodeInfo *framework.NodeInfo) *framework.Status {
+	for _, pl := range sched.preFilterPlugins {
+		if pl.PreFilterExtensions() == nil {
+			continue
+		}
+		status := pl.PreFilterExtensions().AddPod(ctx, state, podToSchedule, podInfoToAdd, nodeInfo)
+		if !status.IsSuccess() {
+			err := status.AsError()
+			klog.ErrorS(err, "Failed running AddPod on PreFilter plugin", "plugin", pl.Name(), "pod", klog.KObj(podToSchedule))
+			return framework.AsStatus(fmt.Errorf("running AddPod on PreFilter plugin %q: %w", pl.Name(), err))
+		}
+	}
+
+	return nil
+}
+
+// RunPreFilterExtensionRemovePod calls the RemovePod of the PreFilterExtensions of the pre filter plugins,
+// which updates their state for podToSchedule as if podInfoToRemove is removed from the node.
+func (sched *Scheduler) RunPreFilterExtensionRemovePod(ctx context.Context, state *framework.CycleState, podToSchedule *v1.Pod, podInfoToRemove *framework.PodInfo, nodeInfo *framework.NodeInfo) *framework.Status {
+	for _, pl := range sched.preFilterPlugins {
+		if pl.PreFilterExtensions() == nil {
+			continue
+		}
+		status := pl.PreFilterExtensions().RemovePod(ctx, state, podToSchedule, podInfoToRemove, nodeInfo)
+		if !status.IsSuccess() {
+			err := status.AsError()
+			klog.ErrorS(err, "Failed running RemovePod on PreFilter plugin", "plugin", pl.Name(), "pod", klog.KObj(podToSchedule))
+			return framework.AsStatus(fmt.Errorf("running RemovePod on PreFilter plugin %q: %w", pl.Name(), err))
+		}
+	}
+
+	return nil
+}
+
 func (sched *Scheduler) RunPreScorePlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodes []*v1.Node) *framework.Status {
 	for _, pl := range sched.preScorePlugins {
 		status := pl.PreScore(ctx, state, pod, nodes)
@@ -200,6 +531,18 @@ func (sched *Scheduler) RunPreScorePlugins(ctx context.Context, state *framework
 }
 
 func (sched *Scheduler) RunScorePlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodes []*v1.Node) (framework.NodeScoreList, *framework.Status) {
+	return sched.runScorePlugins(ctx, state, pod, nodes, nil)
+}
+
+// scoreBreakdown records the scores of each score plugin before and after normalizing them.
+type scoreBreakdown struct {
+	raw        framework.PluginToNodeScores
+	normalized framework.PluginToNodeScores
+}
+
+// runScorePlugins runs the score plugins and returns the total scores of the nodes.
+// The scores of each plugin are recorded to breakdown unless it's nil.
+func (sched *Scheduler) runScorePlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodes []*v1.Node, breakdown *scoreBreakdown) (framework.NodeScoreList, *framework.Status) {
 	scoresMap := sched.createPluginToNodeScores(nodes)
 
 	for index, n := range nodes {
@@ -216,7 +559,37 @@ func (sched *Scheduler) RunScorePlugins(ctx context.Context, state *framework.Cy
 		}
 	}
 
-	// TODO: plugin weight & normalizeScore
+	if breakdown != nil {
+		breakdown.raw = copyPluginToNodeScores(scoresMap)
+	}
+
+	// normalize scores
+	for _, pl := range sched.scorePlugins {
+		if pl.ScoreExtensions() == nil {
+			continue
+		}
+		status := pl.ScoreExtensions().NormalizeScore(ctx, state, pod, scoresMap[pl.Name()])
+		if !status.IsSuccess() {
+			return nil, status
+		}
+	}
+
+	if breakdown != nil {
+		breakdown.normalized = copyPluginToNodeScores(scoresMap)
+	}
+
+	// apply the weights of the plugins
+	for _, pl := range sched.scorePlugins {
+		weight := sched.scorePluginWeight[pl.Name()]
+		nodeScoreList := scoresMap[pl.Name()]
+		for i, nodeScore := range nodeScoreList {
+			if nodeScore.Score > framework.MaxNodeScore || nodeScore.Score < framework.MinNodeScore {
+				err := fmt.Errorf("plugin %q returns an invalid score %v, it should in the range of [%v, %v] after normalizing", pl.Name(), nodeScore.Score, framework.MinNodeScore, framework.MaxNodeScore)
+				return nil, framework.AsStatus(err)
+			}
+			nodeScoreList[i].Score = nodeScore.Score * weight
+		}
+	}
 
 	result := make(framework.NodeScoreList, 0, len(nodes))
 	for i := range nodes {
@@ -229,6 +602,42 @@ func (sched *Scheduler) RunScorePlugins(ctx context.Context, state *framework.Cy
 	return result, nil
 }
 
+// RunReservePluginsReserve runs the Reserve of the reserve plugins. It returns the first non-success status.
+func (sched *Scheduler) RunReservePluginsReserve(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) *framework.Status {
+	for _, pl := range sched.reservePlugins {
+		status := pl.Reserve(ctx, state, pod, nodeName)
+		if !status.IsSuccess() {
+			err := status.AsError()
+			klog.ErrorS(err, "Failed running Reserve plugin", "plugin", pl.Name(), "pod", klog.KObj(pod))
+			return framework.AsStatus(fmt.Errorf("running Reserve plugin %q: %w", pl.Name(), err))
+		}
+	}
+
+	return nil
+}
+
+// RunReservePluginsUnreserve runs the Unreserve of the reserve plugins in the reverse order of Reserve,
+// to clean up what they reserved when the scheduling or the binding of the pod fails.
+func (sched *Scheduler) RunReservePluginsUnreserve(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) {
+	for i := len(sched.reservePlugins) - 1; i >= 0; i-- {
+		sched.reservePlugins[i].Unreserve(ctx, state, pod, nodeName)
+	}
+}
+
+// RunPreBindPlugins runs the pre bind plugins. It returns the first non-success status.
+func (sched *Scheduler) RunPreBindPlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) *framework.Status {
+	for _, pl := range sched.preBindPlugins {
+		status := pl.PreBind(ctx, state, pod, nodeName)
+		if !status.IsSuccess() {
+			err := status.AsError()
+			klog.ErrorS(err, "Failed running PreBind plugin", "plugin", pl.Name(), "pod", klog.KObj(pod))
+			return framework.AsStatus(fmt.Errorf("running PreBind plugin %q: %w", pl.Name(), err))
+		}
+	}
+
+	return nil
+}
+
 func (sched *Scheduler) RunPermitPlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) (status *framework.Status) {
 	pluginsWaitTime := make(map[string]time.Duration)
 	statusCode := framework.Success
@@ -257,8 +666,10 @@ func (sched *Scheduler) RunPermitPlugins(ctx context.Context, state *framework.C
 	}
 
 	if statusCode == framework.Wait {
-		waitingPod := waitingpod.NewWaitingPod(pod, pluginsWaitTime)
+		waitingPod := waitingpod.NewWaitingPod(pod, pluginsWaitTime, sched.clock)
+		sched.waitingPodsLock.Lock()
 		sched.waitingPods[pod.UID] = waitingPod
+		sched.waitingPodsLock.Unlock()
 		msg := fmt.Sprintf("PermitPlugins: one or more plugins asked to wait and no plugin rejected pod %q", pod.Name)
 		klog.Info("PermitPlugins: One or more plugins asked to wait and no plugin rejected pod. pod: ", klog.KObj(pod))
 		return framework.NewStatus(framework.Wait, msg)
@@ -267,30 +678,6 @@ func (sched *Scheduler) RunPermitPlugins(ctx context.Context, state *framework.C
 	return nil
 }
 
-// Select the Node with highest score from NodeScoreList and return the node name
-func (sched *Scheduler) selectNode(nodeScoreList framework.NodeScoreList) (string, error) {
-	if len(nodeScoreList) == 0 {
-		return "", fmt.Errorf("empty priorityList")
-	}
-	maxScore := nodeScoreList[0].Score
-	selectedNodeName := nodeScoreList[0].Name
-	cntOfMaxScore := 1
-	for _, ns := range nodeScoreList[1:] {
-		if ns.Score > maxScore {
-			maxScore = ns.Score
-			selectedNodeName = ns.Name
-			cntOfMaxScore = 1
-		} else if ns.Score == maxScore {
-			cntOfMaxScore++
-			if rand.Intn(cntOfMaxScore) == 0 {
-				// Replace the candidate with probability of 1/cntOfMaxScore
-				selectedNodeName = ns.Name
-			}
-		}
-	}
-	return selectedNodeName, nil
-}
-
 // Initialize a PluginToNodeScores (map of NodeScoreList for each node) for each scorePlugins.
 // PluginToNodeScore(pluginName -> NodeScoreList(each element for each node))
 func (sched *Scheduler) createPluginToNodeScores(nodes []*v1.Node) framework.PluginToNodeScores {
@@ -302,23 +689,111 @@ func (sched *Scheduler) createPluginToNodeScores(nodes []*v1.Node) framework.Plu
 	return pluginToNodeScores
 }
 
+func copyPluginToNodeScores(scoresMap framework.PluginToNodeScores) framework.PluginToNodeScores {
+	copied := make(framework.PluginToNodeScores, len(scoresMap))
+	for name, scores := range scoresMap {
+		copied[name] = append(framework.NodeScoreList(nil), scores...)
+	}
+	return copied
+}
+
 func (sched *Scheduler) GetWaitingPod(uid types.UID) *waitingpod.WaitingPod {
+	sched.waitingPodsLock.RLock()
+	defer sched.waitingPodsLock.RUnlock()
 	return sched.waitingPods[uid]
 }
 
-func (sched *Scheduler) ErrorFunc(pod *v1.Pod, err error) {
-	podInfo := &framework.QueuedPodInfo{
-		PodInfo: framework.NewPodInfo(pod),
-	}
+func (sched *Scheduler) numWaitingPods() int {
+	sched.waitingPodsLock.RLock()
+	defer sched.waitingPodsLock.RUnlock()
+	return len(sched.waitingPods)
+}
+
+// Clock returns the clock of the scheduler.
+func (sched *Scheduler) Clock() clock.WithDelayedExecution {
+	return sched.clock
+}
+
+func (sched *Scheduler) ErrorFunc(podInfo *framework.QueuedPodInfo, err error) {
+	// the pod info from NextPod is reused to keep the attempts and the initial attempt timestamp.
+	pod := podInfo.Pod
 	if fitError, ok := err.(*framework.FitError); ok {
 		// Inject UnschedulablePlugins to PodInfo, which will be used later for moving Pods between queues efficiently.
 		podInfo.UnschedulablePlugins = fitError.Diagnosis.UnschedulablePlugins
 		klog.V(2).InfoS("Unable to schedule pod; no fit; waiting", "pod", klog.KObj(pod), "err", err)
 	} else {
+		// the plugins of the previous attempt don't apply, so that any cluster event moves the pod.
+		podInfo.UnschedulablePlugins = sets.NewString()
 		klog.ErrorS(err, "Error scheduling pod; retrying", "pod", klog.KObj(pod))
 	}
 
 	if err := sched.SchedulingQueue.AddUnschedulable(podInfo); err != nil {
 		klog.ErrorS(err, "Error occurred")
 	}
+	sched.updateSchedulingFailedCondition(pod, err)
+}
+
+// updateSchedulingFailedCondition sets the PodScheduled condition of the pod to False with the error:
+// the Unschedulable reason if no node fits the pod, or SchedulerError otherwise.
+func (sched *Scheduler) updateSchedulingFailedCondition(pod *v1.Pod, err error) {
+	reason := v1.PodReasonUnschedulable
+	if _, ok := err.(*framework.FitError); !ok {
+		reason = "SchedulerError"
+	}
+	if err := sched.updatePodCondition(pod, &v1.PodCondition{
+		Type:    v1.PodScheduled,
+		Status:  v1.ConditionFalse,
+		Reason:  reason,
+		Message: err.Error(),
+	}); err != nil {
+		klog.ErrorS(err, "Error updating pod", "pod", klog.KObj(pod))
+	}
+}
+
+// updatePodCondition sets the condition to the status of the pod like kube-scheduler, so that others
+// (e.g. a cluster autoscaler) can see why the pod is pending. The pod is patched only if the condition changes.
+// The pod in the queue may be stale, so the latest pod in the informer is compared if it's there.
+func (sched *Scheduler) updatePodCondition(pod *v1.Pod, condition *v1.PodCondition) error {
+	if latest, err := sched.informerFactory.Core().V1().Pods().Lister().Pods(pod.Namespace).Get(pod.Name); err == nil && latest.UID == pod.UID {
+		pod = latest
+	}
+	podStatusCopy := pod.Status.DeepCopy()
+	if !podutil.UpdatePodCondition(podStatusCopy, condition) {
+		return nil
+	}
+	return schedutil.PatchPodStatus(sched.client, pod, podStatusCopy)
+}
+
+// recordDecision records the result of the scheduling cycle if the Scheduler has traceRecorder.
+func (sched *Scheduler) recordDecision(pod *v1.Pod, cycleStart time.Time, nodeName string, scores framework.NodeScoreList, err error) {
+	if sched.traceRecorder == nil {
+		return
+	}
+
+	d := &trace.SchedulingDecision{
+		Pod:        pod.Namespace + "/" + pod.Name,
+		CycleStart: cycleStart,
+		NodeName:   nodeName,
+	}
+	if len(scores) > 0 {
+		d.Scores = make(map[string]int64, len(scores))
+		for _, ns := range scores {
+			d.Scores[ns.Name] = ns.Score
+		}
+	}
+	if nodeName != "" {
+		d.SelectionStrategy = string(sched.selectionStrategy)
+		d.SelectedRank = scoreRank(scores, nodeName)
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if fitError, ok := err.(*framework.FitError); ok {
+		d.Statuses = make(map[string]string, len(fitError.Diagnosis.NodeToStatusMap))
+		for node, status := range fitError.Diagnosis.NodeToStatusMap {
+			d.Statuses[node] = status.FailedPlugin() + ": " + status.Message()
+		}
+	}
+
+	sched.traceRecorder.Record(&trace.Event{Time: sched.clock.Now(), Type: trace.Decision, Decision: d})
 }
@@ -0,0 +1,129 @@
+package minisched
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched/simclock"
+)
+
+func TestBindWithRetries(t *testing.T) {
+	// the retries don't need to wait in the test.
+	backoff := bindRetryBackoff
+	bindRetryBackoff = wait.Backoff{Duration: time.Millisecond, Steps: backoff.Steps}
+	t.Cleanup(func() { bindRetryBackoff = backoff })
+
+	unavailable := apierrors.NewServiceUnavailable("etcd is down")
+	conflict := apierrors.NewConflict(v1.Resource("pods/binding"), "pod", fmt.Errorf("pod pod is already assigned"))
+	tests := []struct {
+		name string
+		// boundTo is Spec.NodeName of the pod in API server.
+		boundTo string
+		// errs are returned by the bindings in order. The binding succeeds once they run out.
+		errs []error
+		// deleted deletes the pod before the binding.
+		deleted bool
+
+		wantErr      bool
+		wantBindings int
+		// wantRequeued is whether the pod is requeued to podBackoffQ, or dropped, by handleBindingFailure.
+		wantRequeued bool
+	}{
+		{name: "transient error and then success", errs: []error{unavailable}, wantBindings: 2},
+		{name: "pod is deleted", deleted: true, wantErr: true, wantBindings: 1},
+		{name: "pod is bound to the node already", boundTo: "node-a", errs: []error{conflict}, wantBindings: 1},
+		{name: "pod is bound to another node", boundTo: "node-b", errs: []error{conflict}, wantErr: true, wantBindings: 1},
+		{
+			name:         "retries are exhausted",
+			errs:         []error{unavailable, unavailable, unavailable, unavailable, unavailable},
+			wantErr:      true,
+			wantBindings: backoff.Steps,
+			wantRequeued: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceDefault, Name: "pod", UID: "uid"},
+				Spec:       v1.PodSpec{NodeName: tt.boundTo},
+			}
+			client := fake.NewSimpleClientset()
+			if !tt.deleted {
+				client = fake.NewSimpleClientset(pod)
+			}
+			bindings := 0
+			client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "binding" {
+					return false, nil, nil
+				}
+				bindings++
+				if tt.deleted {
+					return true, nil, apierrors.NewNotFound(v1.Resource("pods"), pod.Name)
+				}
+				if bindings <= len(tt.errs) {
+					return true, nil, tt.errs[bindings-1]
+				}
+				return true, action.(k8stesting.CreateAction).GetObject(), nil
+			})
+
+			clk := simclock.New(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+			sched, err := New(client, informers.NewSharedInformerFactory(client, 0), WithClock(clk))
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			sched.SchedulingQueue.Run()
+			defer sched.SchedulingQueue.Close()
+
+			err = sched.bindWithRetries(ctx, pod, "node-a")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bindWithRetries: got %v, wantErr %v", err, tt.wantErr)
+			}
+			if bindings != tt.wantBindings {
+				t.Errorf("got %d bindings, want %d", bindings, tt.wantBindings)
+			}
+			if err == nil {
+				return
+			}
+
+			podInfo := &framework.QueuedPodInfo{PodInfo: framework.NewPodInfo(pod), Attempts: 3}
+			sched.handleBindingFailure(podInfo, err)
+			pending := sched.SchedulingQueue.PendingPods()
+			if !tt.wantRequeued {
+				if len(pending) != 0 {
+					t.Errorf("the pod isn't dropped: %v", pending)
+				}
+				return
+			}
+			if len(pending) != 1 || sched.SchedulingQueue.HasActivePods() {
+				t.Fatalf("the pod isn't requeued to podBackoffQ: pending %v, active %v", pending, sched.SchedulingQueue.HasActivePods())
+			}
+			// the backoff of the 3 attempts is 4s.
+			clk.Step(3 * time.Second)
+			if sched.SchedulingQueue.HasActivePods() {
+				t.Fatalf("the pod completed the backoff of its attempts before 4s")
+			}
+			clk.Step(time.Second)
+			if !sched.SchedulingQueue.HasActivePods() {
+				t.Fatalf("the pod didn't complete the backoff of its attempts in 4s")
+			}
+			if got := sched.SchedulingQueue.NextPod(); got.Attempts != 4 {
+				t.Errorf("Attempts of the next attempt = %d, want 4", got.Attempts)
+			}
+		})
+	}
+}
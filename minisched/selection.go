@@ -0,0 +1,237 @@
+package minisched
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+)
+
+// NodeSelectionName is the name of the PluginConfig entry in the profile which has NodeSelectionArgs.
+const NodeSelectionName = "NodeSelection"
+
+// NodeSelectionStrategy is how selectNode chooses a node from the scored nodes.
+type NodeSelectionStrategy string
+
+const (
+	// SelectMaxScore chooses the node with the highest score. The ties are broken by the TieBreakStrategy.
+	SelectMaxScore NodeSelectionStrategy = "MaxScore"
+	// SelectTopKWeightedRandom chooses one of the K nodes with the highest scores at random,
+	// with the probability proportional to the score. The choice is uniform if all of them have 0.
+	SelectTopKWeightedRandom NodeSelectionStrategy = "TopKWeightedRandom"
+	// SelectSoftmax chooses a node at random with the probability proportional to exp(score/Temperature).
+	// A higher temperature spreads pods more evenly; a lower one approaches SelectMaxScore.
+	SelectSoftmax NodeSelectionStrategy = "Softmax"
+	// SelectPowerOfTwoChoices picks two nodes uniformly at random and chooses the one with the higher score.
+	SelectPowerOfTwoChoices NodeSelectionStrategy = "PowerOfTwoChoices"
+)
+
+const (
+	defaultTopK               = 3
+	defaultSoftmaxTemperature = 1.0
+)
+
+// NodeSelectionArgs configures the node selection strategy.
+// It's given as the args of the PluginConfig entry named NodeSelection in the profile:
+//
+//	pluginConfig:
+//	- name: NodeSelection
+//	  args:
+//	    strategy: Softmax
+//	    temperature: 10
+type NodeSelectionArgs struct {
+	// Strategy defaults to MaxScore.
+	Strategy NodeSelectionStrategy `json:"strategy,omitempty"`
+	// K is the number of the candidates for TopKWeightedRandom. Defaults to 3.
+	K int `json:"k,omitempty"`
+	// Temperature for Softmax. Defaults to 1.
+	Temperature float64 `json:"temperature,omitempty"`
+}
+
+// nodeSelector chooses a node from the scored nodes.
+type nodeSelector interface {
+	selectNode(nodeScoreList framework.NodeScoreList) string
+}
+
+func newNodeSelector(obj runtime.Object, tieBreaker tieBreaker, r *rand.Rand) (NodeSelectionStrategy, nodeSelector, error) {
+	args := NodeSelectionArgs{}
+	if err := frameworkruntime.DecodeInto(obj, &args); err != nil {
+		return "", nil, fmt.Errorf("decode %s args: %w", NodeSelectionName, err)
+	}
+	if args.Strategy == "" {
+		args.Strategy = SelectMaxScore
+	}
+
+	switch args.Strategy {
+	case SelectMaxScore:
+		return args.Strategy, &maxScoreSelector{tieBreaker: tieBreaker}, nil
+	case SelectTopKWeightedRandom:
+		if args.K == 0 {
+			args.K = defaultTopK
+		}
+		if args.K < 0 {
+			return "", nil, fmt.Errorf("k must be positive, got %d", args.K)
+		}
+		return args.Strategy, &topKWeightedRandomSelector{k: args.K, rand: r}, nil
+	case SelectSoftmax:
+		if args.Temperature == 0 {
+			args.Temperature = defaultSoftmaxTemperature
+		}
+		if args.Temperature < 0 {
+			return "", nil, fmt.Errorf("temperature must be positive, got %v", args.Temperature)
+		}
+		return args.Strategy, &softmaxSelector{temperature: args.Temperature, rand: r}, nil
+	case SelectPowerOfTwoChoices:
+		return args.Strategy, &powerOfTwoChoicesSelector{tieBreaker: tieBreaker, rand: r}, nil
+	}
+	return "", nil, fmt.Errorf("unknown node selection strategy %q", args.Strategy)
+}
+
+type maxScoreSelector struct {
+	tieBreaker tieBreaker
+}
+
+func (s *maxScoreSelector) selectNode(nodeScoreList framework.NodeScoreList) string {
+	nodeScoreList = sortByName(nodeScoreList)
+	maxScore := nodeScoreList[0].Score
+	selectedNodeName := nodeScoreList[0].Name
+	cntOfMaxScore := 1
+	for _, ns := range nodeScoreList[1:] {
+		if ns.Score > maxScore {
+			maxScore = ns.Score
+			selectedNodeName = ns.Name
+			cntOfMaxScore = 1
+		} else if ns.Score == maxScore {
+			cntOfMaxScore++
+			if s.tieBreaker.prefer(ns.Name, selectedNodeName, cntOfMaxScore) {
+				selectedNodeName = ns.Name
+			}
+		}
+	}
+	return selectedNodeName
+}
+
+type topKWeightedRandomSelector struct {
+	k    int
+	rand *rand.Rand
+}
+
+func (s *topKWeightedRandomSelector) selectNode(nodeScoreList framework.NodeScoreList) string {
+	candidates := sortByScore(nodeScoreList)
+	if len(candidates) > s.k {
+		candidates = candidates[:s.k]
+	}
+	weights := make([]float64, len(candidates))
+	for i, ns := range candidates {
+		weights[i] = math.Max(float64(ns.Score), 0)
+	}
+	return candidates[weightedChoice(s.rand, weights)].Name
+}
+
+type softmaxSelector struct {
+	temperature float64
+	rand        *rand.Rand
+}
+
+func (s *softmaxSelector) selectNode(nodeScoreList framework.NodeScoreList) string {
+	candidates := sortByScore(nodeScoreList)
+	// candidates[0] has the max score, which is subtracted to avoid overflow.
+	maxScore := float64(candidates[0].Score)
+	weights := make([]float64, len(candidates))
+	for i, ns := range candidates {
+		weights[i] = math.Exp((float64(ns.Score) - maxScore) / s.temperature)
+	}
+	return candidates[weightedChoice(s.rand, weights)].Name
+}
+
+type powerOfTwoChoicesSelector struct {
+	tieBreaker tieBreaker
+	rand       *rand.Rand
+}
+
+func (s *powerOfTwoChoicesSelector) selectNode(nodeScoreList framework.NodeScoreList) string {
+	if len(nodeScoreList) == 1 {
+		return nodeScoreList[0].Name
+	}
+	candidates := sortByName(nodeScoreList)
+	i := s.rand.Intn(len(candidates))
+	j := s.rand.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := candidates[i], candidates[j]
+	if b.Score > a.Score || (b.Score == a.Score && s.tieBreaker.prefer(b.Name, a.Name, 2)) {
+		return b.Name
+	}
+	return a.Name
+}
+
+// weightedChoice returns an index at random with the probability proportional to the weight.
+// It's uniform if all the weights are 0.
+func weightedChoice(r *rand.Rand, weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return r.Intn(len(weights))
+	}
+	x := r.Float64() * total
+	for i, w := range weights {
+		x -= w
+		if x < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// sortByName returns a copy of nodeScoreList sorted by name, so that the random choices
+// don't depend on the order of the nodes listed.
+func sortByName(nodeScoreList framework.NodeScoreList) framework.NodeScoreList {
+	sorted := append(framework.NodeScoreList(nil), nodeScoreList...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// sortByScore returns a copy of nodeScoreList sorted by score in descending order and then by name.
+func sortByScore(nodeScoreList framework.NodeScoreList) framework.NodeScoreList {
+	sorted := sortByName(nodeScoreList)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Score > sorted[j].Score
+	})
+	return sorted
+}
+
+// scoreRank returns the rank of the node by score (1 is the highest). The nodes with the same score share the best rank.
+func scoreRank(nodeScoreList framework.NodeScoreList, nodeName string) int {
+	var score int64
+	for _, ns := range nodeScoreList {
+		if ns.Name == nodeName {
+			score = ns.Score
+		}
+	}
+	rank := 1
+	for _, ns := range nodeScoreList {
+		if ns.Score > score {
+			rank++
+		}
+	}
+	return rank
+}
+
+// Select a Node from NodeScoreList by sched.nodeSelector and return the node name
+func (sched *Scheduler) selectNode(nodeScoreList framework.NodeScoreList) (string, error) {
+	if len(nodeScoreList) == 0 {
+		return "", fmt.Errorf("empty priorityList")
+	}
+	selectedNodeName := sched.nodeSelector.selectNode(nodeScoreList)
+	sched.tieBreaker.chosen(selectedNodeName)
+	return selectedNodeName, nil
+}
@@ -0,0 +1,309 @@
+package minisched
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"github.com/nakamasato/mini-kube-scheduler/minisched/simclock"
+	"github.com/nakamasato/mini-kube-scheduler/minisched/trace"
+)
+
+func newSelectionArgs(raw string) runtime.Object {
+	if raw == "" {
+		return nil
+	}
+	return &runtime.Unknown{Raw: []byte(raw), ContentType: runtime.ContentTypeJSON}
+}
+
+func TestNewNodeSelector(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         string
+		wantStrategy NodeSelectionStrategy
+		// want is the selector created, without rand and tieBreaker.
+		want nodeSelector
+		// wantErr is a substring of the error.
+		wantErr string
+	}{
+		{name: "default", args: "", wantStrategy: SelectMaxScore, want: &maxScoreSelector{}},
+		{name: "max score", args: `{"strategy": "MaxScore"}`, wantStrategy: SelectMaxScore, want: &maxScoreSelector{}},
+		{name: "top k with the default k", args: `{"strategy": "TopKWeightedRandom"}`, wantStrategy: SelectTopKWeightedRandom, want: &topKWeightedRandomSelector{k: 3}},
+		{name: "top k", args: `{"strategy": "TopKWeightedRandom", "k": 5}`, wantStrategy: SelectTopKWeightedRandom, want: &topKWeightedRandomSelector{k: 5}},
+		{name: "negative k", args: `{"strategy": "TopKWeightedRandom", "k": -1}`, wantErr: "k must be positive"},
+		{name: "softmax with the default temperature", args: `{"strategy": "Softmax"}`, wantStrategy: SelectSoftmax, want: &softmaxSelector{temperature: 1}},
+		{name: "softmax", args: `{"strategy": "Softmax", "temperature": 0.5}`, wantStrategy: SelectSoftmax, want: &softmaxSelector{temperature: 0.5}},
+		{name: "negative temperature", args: `{"strategy": "Softmax", "temperature": -1}`, wantErr: "temperature must be positive"},
+		{name: "power of two choices", args: `{"strategy": "PowerOfTwoChoices"}`, wantStrategy: SelectPowerOfTwoChoices, want: &powerOfTwoChoicesSelector{}},
+		{name: "unknown strategy", args: `{"strategy": "RoundRobin"}`, wantErr: `unknown node selection strategy "RoundRobin"`},
+		{name: "invalid args", args: `{"k": "three"}`, wantErr: "decode NodeSelection args"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, selector, err := newNodeSelector(newSelectionArgs(tt.args), nil, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newNodeSelector: got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newNodeSelector: %v", err)
+			}
+			if strategy != tt.wantStrategy {
+				t.Errorf("strategy = %s, want %s", strategy, tt.wantStrategy)
+			}
+			switch s := selector.(type) {
+			case *maxScoreSelector:
+				_, ok := tt.want.(*maxScoreSelector)
+				if !ok {
+					t.Errorf("selector = %T, want %T", s, tt.want)
+				}
+			case *topKWeightedRandomSelector:
+				want, ok := tt.want.(*topKWeightedRandomSelector)
+				if !ok || s.k != want.k {
+					t.Errorf("selector = %T with k %d, want %#v", s, s.k, tt.want)
+				}
+			case *softmaxSelector:
+				want, ok := tt.want.(*softmaxSelector)
+				if !ok || s.temperature != want.temperature {
+					t.Errorf("selector = %T with temperature %v, want %#v", s, s.temperature, tt.want)
+				}
+			case *powerOfTwoChoicesSelector:
+				_, ok := tt.want.(*powerOfTwoChoicesSelector)
+				if !ok {
+					t.Errorf("selector = %T, want %T", s, tt.want)
+				}
+			default:
+				t.Errorf("unexpected selector %T", s)
+			}
+		})
+	}
+}
+
+// countSelections selects a node n times from scores by the strategy of args with a fixed seed.
+func countSelections(t *testing.T, args string, scores framework.NodeScoreList, n int) map[string]int {
+	t.Helper()
+	r := rand.New(rand.NewSource(1))
+	tb, err := newTieBreaker(TieBreakRandom, r)
+	if err != nil {
+		t.Fatalf("newTieBreaker: %v", err)
+	}
+	_, selector, err := newNodeSelector(newSelectionArgs(args), tb, r)
+	if err != nil {
+		t.Fatalf("newNodeSelector: %v", err)
+	}
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		counts[selector.selectNode(scores)]++
+	}
+	return counts
+}
+
+func TestRandomSelectors(t *testing.T) {
+	scores := framework.NodeScoreList{
+		{Name: "node-c", Score: 50},
+		{Name: "node-a", Score: 100},
+		{Name: "node-e", Score: 10},
+		{Name: "node-b", Score: 50},
+		{Name: "node-d", Score: 30},
+	}
+	tests := []struct {
+		name   string
+		args   string
+		scores framework.NodeScoreList
+		// want is the expected ratio of the selections of each node. The nodes not in want are never selected.
+		want map[string]float64
+	}{
+		{
+			name:   "top k chooses the k nodes with the highest scores by score",
+			args:   `{"strategy": "TopKWeightedRandom", "k": 2}`,
+			scores: scores,
+			// node-b is preferred to node-c with the same score by name.
+			want: map[string]float64{"node-a": 2.0 / 3, "node-b": 1.0 / 3},
+		},
+		{
+			name:   "top k larger than the nodes",
+			args:   `{"strategy": "TopKWeightedRandom", "k": 10}`,
+			scores: scores,
+			want:   map[string]float64{"node-a": 100.0 / 240, "node-b": 50.0 / 240, "node-c": 50.0 / 240, "node-d": 30.0 / 240, "node-e": 10.0 / 240},
+		},
+		{
+			name: "top k with zero scores is uniform",
+			args: `{"strategy": "TopKWeightedRandom"}`,
+			scores: framework.NodeScoreList{
+				{Name: "node-a", Score: 0}, {Name: "node-b", Score: 0}, {Name: "node-c", Score: 0}, {Name: "node-d", Score: 0},
+			},
+			want: map[string]float64{"node-a": 1.0 / 3, "node-b": 1.0 / 3, "node-c": 1.0 / 3},
+		},
+		{
+			name:   "softmax with a low temperature chooses the max score",
+			args:   `{"strategy": "Softmax", "temperature": 0.01}`,
+			scores: scores,
+			want:   map[string]float64{"node-a": 1},
+		},
+		{
+			name:   "softmax",
+			args:   `{"strategy": "Softmax", "temperature": 10}`,
+			scores: framework.NodeScoreList{{Name: "node-a", Score: 10}, {Name: "node-b", Score: 0}},
+			// e^1 / (e^1 + e^0)
+			want: map[string]float64{"node-a": 0.731, "node-b": 0.269},
+		},
+		{
+			name: "power of two choices never chooses the worst node",
+			args: `{"strategy": "PowerOfTwoChoices"}`,
+			scores: framework.NodeScoreList{
+				{Name: "node-c", Score: 0}, {Name: "node-a", Score: 100}, {Name: "node-b", Score: 50},
+			},
+			// node-a wins the 2 pairs with it of the 3 pairs.
+			want: map[string]float64{"node-a": 2.0 / 3, "node-b": 1.0 / 3},
+		},
+		{
+			name:   "power of two choices with a single node",
+			args:   `{"strategy": "PowerOfTwoChoices"}`,
+			scores: framework.NodeScoreList{{Name: "node-a", Score: 0}},
+			want:   map[string]float64{"node-a": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const n = 3000
+			counts := countSelections(t, tt.args, tt.scores, n)
+			for name, count := range counts {
+				ratio, ok := tt.want[name]
+				if !ok {
+					t.Errorf("%s is selected %d times of %d, want never", name, count, n)
+					continue
+				}
+				if got := float64(count) / n; got < ratio-0.05 || got > ratio+0.05 {
+					t.Errorf("%s is selected %d times of %d, want about %v of them", name, count, n, ratio)
+				}
+			}
+			for name := range tt.want {
+				if counts[name] == 0 {
+					t.Errorf("%s is never selected", name)
+				}
+			}
+		})
+	}
+}
+
+func TestRandomSelectorsAreReproducible(t *testing.T) {
+	scores := framework.NodeScoreList{
+		{Name: "node-a", Score: 100},
+		{Name: "node-b", Score: 80},
+		{Name: "node-c", Score: 80},
+		{Name: "node-d", Score: 30},
+		{Name: "node-e", Score: 0},
+	}
+	for _, args := range []string{
+		`{"strategy": "TopKWeightedRandom"}`,
+		`{"strategy": "Softmax", "temperature": 20}`,
+		`{"strategy": "PowerOfTwoChoices"}`,
+	} {
+		t.Run(args, func(t *testing.T) {
+			// the selections with the same seed are the same even if the nodes are listed in another order.
+			var first []string
+			for seed := int64(1); seed <= 5; seed++ {
+				r := rand.New(rand.NewSource(1))
+				tb, err := newTieBreaker(TieBreakRandom, r)
+				if err != nil {
+					t.Fatalf("newTieBreaker: %v", err)
+				}
+				_, selector, err := newNodeSelector(newSelectionArgs(args), tb, r)
+				if err != nil {
+					t.Fatalf("newNodeSelector: %v", err)
+				}
+				var got []string
+				for i := 0; i < 20; i++ {
+					got = append(got, selector.selectNode(shuffled(scores, seed*100+int64(i))))
+				}
+				if first == nil {
+					first = got
+					continue
+				}
+				for i := range got {
+					if got[i] != first[i] {
+						t.Fatalf("selections = %v, want %v with the same seed", got, first)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestScoreRank(t *testing.T) {
+	scores := framework.NodeScoreList{
+		{Name: "node-c", Score: 50},
+		{Name: "node-a", Score: 100},
+		{Name: "node-b", Score: 50},
+		{Name: "node-d", Score: 30},
+	}
+	tests := []struct {
+		nodeName string
+		want     int
+	}{
+		{nodeName: "node-a", want: 1},
+		{nodeName: "node-b", want: 2},
+		{nodeName: "node-c", want: 2},
+		{nodeName: "node-d", want: 4},
+	}
+	for _, tt := range tests {
+		if got := scoreRank(scores, tt.nodeName); got != tt.want {
+			t.Errorf("scoreRank(%s) = %d, want %d", tt.nodeName, got, tt.want)
+		}
+	}
+}
+
+func TestRecordDecisionSelection(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceDefault, Name: "pod"}}
+	scores := framework.NodeScoreList{
+		{Name: "node-a", Score: 100},
+		{Name: "node-b", Score: 50},
+		{Name: "node-c", Score: 50},
+		{Name: "node-d", Score: 30},
+	}
+	tests := []struct {
+		name         string
+		strategy     NodeSelectionStrategy
+		nodeName     string
+		wantStrategy string
+		wantRank     int
+	}{
+		{name: "max score", strategy: SelectMaxScore, nodeName: "node-a", wantStrategy: "MaxScore", wantRank: 1},
+		{name: "top k", strategy: SelectTopKWeightedRandom, nodeName: "node-c", wantStrategy: "TopKWeightedRandom", wantRank: 2},
+		{name: "softmax", strategy: SelectSoftmax, nodeName: "node-d", wantStrategy: "Softmax", wantRank: 4},
+		{name: "power of two choices", strategy: SelectPowerOfTwoChoices, nodeName: "node-b", wantStrategy: "PowerOfTwoChoices", wantRank: 2},
+		// the failed cycles have no selection.
+		{name: "no node is selected", strategy: SelectSoftmax, nodeName: "", wantStrategy: "", wantRank: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := &trace.Collector{}
+			sched := &Scheduler{
+				traceRecorder:     collector,
+				selectionStrategy: tt.strategy,
+				clock:             simclock.New(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+			}
+			sched.recordDecision(pod, sched.clock.Now(), tt.nodeName, scores, nil)
+
+			events := collector.Events()
+			if len(events) != 1 || events[0].Decision == nil {
+				t.Fatalf("recorded events = %v, want a decision", events)
+			}
+			d := events[0].Decision
+			if d.SelectionStrategy != tt.wantStrategy {
+				t.Errorf("SelectionStrategy = %q, want %q", d.SelectionStrategy, tt.wantStrategy)
+			}
+			if d.SelectedRank != tt.wantRank {
+				t.Errorf("SelectedRank = %d, want %d", d.SelectedRank, tt.wantRank)
+			}
+		})
+	}
+}
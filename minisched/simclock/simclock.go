@@ -0,0 +1,240 @@
+package simclock
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/utils/clock"
+)
+
+// Clock is a virtual clock for simulation. The time doesn't pass by itself, but jumps forward
+// by Step, SetTime or AdvanceToNext, which fire the timers due by then in order of their deadlines.
+//
+// Unlike FakeClock in k8s.io/utils/clock/testing, the functions passed to AfterFunc are called
+// synchronously in the goroutine advancing the clock, so the changes made by them (e.g. pods moved
+// to activeQ) are visible when advancing returns. This makes the simulation deterministic.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	seq     uint64
+	waiters map[*waiter]struct{}
+}
+
+var _ clock.WithTicker = &Clock{}
+var _ clock.WithDelayedExecution = &Clock{}
+
+// waiter is a pending timer, ticker or AfterFunc.
+type waiter struct {
+	clock    *Clock
+	deadline time.Time
+	// seq keeps the order of waiters with the same deadline.
+	seq uint64
+	// period is the interval of a ticker. 0 for timers.
+	period time.Duration
+	// background is true for the timers which don't count for HasPendingTimers.
+	background bool
+	// Either ch or f is set.
+	ch chan time.Time
+	f  func()
+}
+
+// New creates Clock starting at t.
+func New(t time.Time) *Clock {
+	return &Clock{now: t, waiters: map[*waiter]struct{}{}}
+}
+
+// Now returns the current virtual time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Since returns the virtual time elapsed since t.
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// After returns a channel which receives the virtual time after d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer creates a timer which fires after d.
+func (c *Clock) NewTimer(d time.Duration) clock.Timer {
+	w := &waiter{clock: c, ch: make(chan time.Time, 1)}
+	c.add(w, d)
+	return w
+}
+
+// AfterFunc calls f after d in the goroutine advancing the clock.
+func (c *Clock) AfterFunc(d time.Duration, f func()) clock.Timer {
+	w := &waiter{clock: c, f: f}
+	c.add(w, d)
+	return w
+}
+
+// AfterFuncInBackground is AfterFunc for housekeeping (e.g. the periodic flushes of the scheduling queue),
+// whose timer is ignored by HasPendingTimers.
+func (c *Clock) AfterFuncInBackground(d time.Duration, f func()) clock.Timer {
+	w := &waiter{clock: c, f: f, background: true}
+	c.add(w, d)
+	return w
+}
+
+// Tick returns a channel which receives the virtual time every d.
+func (c *Clock) Tick(d time.Duration) <-chan time.Time {
+	if d <= 0 {
+		return nil
+	}
+	return c.NewTicker(d).C()
+}
+
+// NewTicker creates a ticker which fires every d.
+func (c *Clock) NewTicker(d time.Duration) clock.Ticker {
+	w := &waiter{clock: c, period: d, ch: make(chan time.Time, 1)}
+	c.add(w, d)
+	return &ticker{w}
+}
+
+// Sleep blocks until the clock advances by d.
+func (c *Clock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Next returns the deadline of the earliest pending timer.
+// It returns false if there is no pending timer.
+func (c *Clock) Next() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := c.earliestLocked()
+	if w == nil {
+		return time.Time{}, false
+	}
+	return w.deadline, true
+}
+
+// HasPendingTimers returns true if some timer or ticker other than AfterFuncInBackground is pending,
+// i.e. something is waiting for the virtual time to pass.
+func (c *Clock) HasPendingTimers() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for w := range c.waiters {
+		if !w.background {
+			return true
+		}
+	}
+	return false
+}
+
+// AdvanceToNext advances the clock to the deadline of the earliest pending timer and fires the timers due.
+// It returns false if there is no pending timer.
+func (c *Clock) AdvanceToNext() bool {
+	t, ok := c.Next()
+	if !ok {
+		return false
+	}
+	c.SetTime(t)
+	return true
+}
+
+// Step advances the clock by d.
+func (c *Clock) Step(d time.Duration) {
+	c.SetTime(c.Now().Add(d))
+}
+
+// SetTime advances the clock to t, firing the timers due by t one by one in order of their deadlines.
+// The clock never goes backward.
+func (c *Clock) SetTime(t time.Time) {
+	for {
+		c.mu.Lock()
+		w := c.earliestLocked()
+		if w == nil || w.deadline.After(t) {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mu.Unlock()
+			return
+		}
+		if w.deadline.After(c.now) {
+			c.now = w.deadline
+		}
+		now := c.now
+		if w.period > 0 {
+			c.seq++
+			w.deadline, w.seq = w.deadline.Add(w.period), c.seq
+		} else {
+			delete(c.waiters, w)
+		}
+		c.mu.Unlock()
+
+		if w.f != nil {
+			w.f()
+			continue
+		}
+		// Like time.Ticker, drop the tick if the previous one is not received yet.
+		select {
+		case w.ch <- now:
+		default:
+		}
+	}
+}
+
+func (c *Clock) add(w *waiter, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addLocked(w, d)
+}
+
+func (c *Clock) addLocked(w *waiter, d time.Duration) {
+	c.seq++
+	w.deadline, w.seq = c.now.Add(d), c.seq
+	c.waiters[w] = struct{}{}
+}
+
+func (c *Clock) earliestLocked() *waiter {
+	var earliest *waiter
+	for w := range c.waiters {
+		if earliest == nil || w.deadline.Before(earliest.deadline) ||
+			(w.deadline.Equal(earliest.deadline) && w.seq < earliest.seq) {
+			earliest = w
+		}
+	}
+	return earliest
+}
+
+// C returns the channel of the timer or the ticker. It is nil for AfterFunc.
+func (w *waiter) C() <-chan time.Time {
+	return w.ch
+}
+
+// Stop stops the timer. It returns false if the timer has already fired or been stopped.
+func (w *waiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	_, ok := w.clock.waiters[w]
+	delete(w.clock.waiters, w)
+	return ok
+}
+
+// Reset changes the timer to fire after d. It returns false if the timer has already fired or been stopped.
+func (w *waiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	_, ok := w.clock.waiters[w]
+	w.clock.addLocked(w, d)
+	return ok
+}
+
+// ticker adapts waiter to clock.Ticker, whose Stop doesn't return a value.
+type ticker struct {
+	w *waiter
+}
+
+func (t *ticker) C() <-chan time.Time {
+	return t.w.C()
+}
+
+func (t *ticker) Stop() {
+	t.w.Stop()
+}
@@ -0,0 +1,175 @@
+package minisched
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// SimulationResult is the result of Simulate: where the pod would go and why.
+type SimulationResult struct {
+	// SelectedNode is the node with the highest score, or empty if no node fits the pod.
+	// The ties are broken by name, so the scheduler may choose another node with the same score
+	// by its node selection strategy and tie-breaking.
+	SelectedNode string `json:"selectedNode,omitempty"`
+	// PreFilter is the status of the pre filter plugin which rejected the pod, if any.
+	// The filter and the score plugins don't run then.
+	PreFilter *PluginStatus `json:"preFilter,omitempty"`
+	// Nodes are the results for each node, sorted by the total score in descending order and then by name.
+	// The nodes which don't fit the pod come last.
+	Nodes []NodeResult `json:"nodes,omitempty"`
+}
+
+// NodeResult is the result of the filter and the score plugins for a node.
+type NodeResult struct {
+	Name string `json:"name"`
+	// Feasible is whether the node passes the filter plugins, including with the nominated pods added.
+	Feasible bool `json:"feasible"`
+	// Filter is the status of each filter plugin, keyed by the plugin name. Unlike a scheduling cycle,
+	// all the filter plugins run even after one of them rejects the pod, with the nominated pods added to the node.
+	Filter map[string]PluginStatus `json:"filter"`
+	// Score is the score of each score plugin, keyed by the plugin name. Only the feasible nodes are scored.
+	Score map[string]PluginScore `json:"score,omitempty"`
+	// TotalScore is the sum of the weighted scores.
+	TotalScore int64 `json:"totalScore"`
+}
+
+// PluginStatus is the status returned by a plugin.
+type PluginStatus struct {
+	// Plugin is the name of the plugin which rejected the pod, set only for PreFilter.
+	Plugin  string   `json:"plugin,omitempty"`
+	Code    string   `json:"code"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// PluginScore is the score of a node by a score plugin.
+type PluginScore struct {
+	// Raw is the score returned by Score.
+	Raw int64 `json:"raw"`
+	// Normalized is the score after NormalizeScore (the same as Raw if the plugin has no ScoreExtensions).
+	Normalized int64 `json:"normalized"`
+	// Weighted is Normalized multiplied by the weight of the plugin, which is summed up to the total score.
+	Weighted int64 `json:"weighted"`
+}
+
+// Simulate runs the plugins from pre filter to score for the pod against the current snapshot, and returns the
+// result of each plugin for each node and the node the pod would go. It's a dry run: the pod isn't enqueued,
+// reserved, permitted nor bound, and the state of the node selection (e.g. the random number generator and
+// the least recently chosen nodes) doesn't change.
+// An unschedulable pod is reported in the result, and the error is returned only if a plugin fails.
+// Like FitsNewNode, it waits for the current scheduling cycle to finish.
+func (sched *Scheduler) Simulate(ctx context.Context, pod *v1.Pod) (*SimulationResult, error) {
+	sched.cycleLock.Lock()
+	defer sched.cycleLock.Unlock()
+
+	if err := sched.updateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	result := &SimulationResult{}
+	state := framework.NewCycleState()
+	if status := sched.RunPreFilterPlugins(ctx, state, pod); !status.IsSuccess() {
+		if !status.IsUnschedulable() {
+			return nil, status.AsError()
+		}
+		s := newPluginStatus(status)
+		result.PreFilter = &s
+		return result, nil
+	}
+
+	nodeInfos, err := sched.snapshot.NodeInfos().List()
+	if err != nil {
+		return nil, err
+	}
+	var feasibleNodes []*v1.Node
+	nodeResults := make(map[string]*NodeResult, len(nodeInfos))
+	for _, nodeInfo := range nodeInfos {
+		status := sched.RunFilterPluginsWithNominatedPods(ctx, state, pod, nodeInfo)
+		if !status.IsSuccess() && !status.IsUnschedulable() {
+			return nil, status.AsError()
+		}
+		filter, err := sched.runAllFilterPlugins(ctx, state, pod, nodeInfo)
+		if err != nil {
+			return nil, err
+		}
+		name := nodeInfo.Node().Name
+		nodeResults[name] = &NodeResult{Name: name, Feasible: status.IsSuccess(), Filter: filter}
+		if status.IsSuccess() {
+			feasibleNodes = append(feasibleNodes, nodeInfo.Node())
+		}
+	}
+
+	if len(feasibleNodes) > 0 {
+		if status := sched.RunPreScorePlugins(ctx, state, pod, feasibleNodes); !status.IsSuccess() {
+			return nil, status.AsError()
+		}
+		breakdown := &scoreBreakdown{}
+		scores, status := sched.runScorePlugins(ctx, state, pod, feasibleNodes, breakdown)
+		if !status.IsSuccess() {
+			return nil, status.AsError()
+		}
+		for i, ns := range scores {
+			r := nodeResults[ns.Name]
+			r.TotalScore = ns.Score
+			r.Score = make(map[string]PluginScore, len(sched.scorePlugins))
+			for _, pl := range sched.scorePlugins {
+				normalized := breakdown.normalized[pl.Name()][i].Score
+				r.Score[pl.Name()] = PluginScore{
+					Raw:        breakdown.raw[pl.Name()][i].Score,
+					Normalized: normalized,
+					Weighted:   normalized * sched.scorePluginWeight[pl.Name()],
+				}
+			}
+		}
+		result.SelectedNode = sortByScore(scores)[0].Name
+	}
+
+	result.Nodes = make([]NodeResult, 0, len(nodeResults))
+	for _, r := range nodeResults {
+		result.Nodes = append(result.Nodes, *r)
+	}
+	sort.Slice(result.Nodes, func(i, j int) bool {
+		a, b := result.Nodes[i], result.Nodes[j]
+		if a.Feasible != b.Feasible {
+			return a.Feasible
+		}
+		if a.TotalScore != b.TotalScore {
+			return a.TotalScore > b.TotalScore
+		}
+		return a.Name < b.Name
+	})
+	return result, nil
+}
+
+// runAllFilterPlugins runs all the filter plugins for the pod on the node with the nominated pods added,
+// and returns the status of each of them.
+func (sched *Scheduler) runAllFilterPlugins(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeInfo *framework.NodeInfo) (map[string]PluginStatus, error) {
+	_, state, nodeInfo, err := sched.addNominatedPods(ctx, pod, state, nodeInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]PluginStatus, len(sched.filterPlugins))
+	for _, pl := range sched.filterPlugins {
+		status := pl.Filter(ctx, state, pod, nodeInfo)
+		if !status.IsSuccess() && !status.IsUnschedulable() {
+			return nil, fmt.Errorf("running %q filter plugin: %w", pl.Name(), status.AsError())
+		}
+		statuses[pl.Name()] = newPluginStatus(status)
+	}
+	return statuses, nil
+}
+
+func newPluginStatus(status *framework.Status) PluginStatus {
+	if status == nil {
+		return PluginStatus{Code: framework.Success.String()}
+	}
+	return PluginStatus{
+		Plugin:  status.FailedPlugin(),
+		Code:    status.Code().String(),
+		Reasons: status.Reasons(),
+	}
+}
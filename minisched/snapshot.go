@@ -0,0 +1,147 @@
+package minisched
+
+import (
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// updateSnapshot takes the snapshot of the nodes and the pods on them for the scheduling cycle.
+// The pods are listed from the informer cache, and the assumed pods are added to the nodes they are assumed on.
+// Like the pod informer of kube-scheduler, the pods which have terminated don't use the resources of the nodes.
+func (sched *Scheduler) updateSnapshot() error {
+	pods, nodes, err := sched.listPodsAndNodes()
+	if err != nil {
+		return err
+	}
+	sched.snapshot.Update(pods, nodes)
+	return nil
+}
+
+// updateSnapshotWithNode takes the snapshot like updateSnapshot, with the node which isn't in the cluster
+// and the pods on it added.
+func (sched *Scheduler) updateSnapshotWithNode(node *v1.Node, podsOnNode []*v1.Pod) error {
+	pods, nodes, err := sched.listPodsAndNodes()
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if n.Name == node.Name {
+			return fmt.Errorf("node %s already exists", node.Name)
+		}
+	}
+	nodes = append(nodes, node)
+	for _, p := range podsOnNode {
+		p = p.DeepCopy()
+		p.Spec.NodeName = node.Name
+		pods = append(pods, p)
+	}
+	sched.snapshot.Update(pods, nodes)
+	return nil
+}
+
+// updateSnapshotWithoutPod takes the snapshot like updateSnapshot, with the pod removed from its node.
+func (sched *Scheduler) updateSnapshotWithoutPod(pod *v1.Pod) error {
+	pods, nodes, err := sched.listPodsAndNodes()
+	if err != nil {
+		return err
+	}
+	others := make([]*v1.Pod, 0, len(pods))
+	for _, p := range pods {
+		if p.UID != pod.UID {
+			others = append(others, p)
+		}
+	}
+	sched.snapshot.Update(others, nodes)
+	return nil
+}
+
+// listPodsAndNodes lists the nodes and the pods on them from the informer caches, including the assumed pods,
+// for the snapshot. The objects are shared with the informers, so they must not be modified.
+// The assumed pods which have been bound are forgotten here once the informer observes them on the node
+// (or deleted), so that no scheduling cycle misses the resources they use in between.
+func (sched *Scheduler) listPodsAndNodes() ([]*v1.Pod, []*v1.Node, error) {
+	nodes, err := sched.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, nil, fmt.Errorf("list nodes: %w", err)
+	}
+	// the informer cache lists the nodes in random order, but the filter plugins and the node selection must see them
+	// in the same order every time, like API server lists them, so that a seeded scheduler is reproducible.
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	cachedPods, err := sched.podLister.List(labels.Everything())
+	if err != nil {
+		return nil, nil, fmt.Errorf("list pods: %w", err)
+	}
+
+	pods := make([]*v1.Pod, 0, len(cachedPods))
+	// observed is whether the informer has observed each pod on a node or terminated.
+	observed := make(map[types.UID]bool, len(cachedPods))
+	for _, pod := range cachedPods {
+		terminated := pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+		observed[pod.UID] = assignedPod(pod) || terminated
+		if assignedPod(pod) && !terminated {
+			pods = append(pods, pod)
+		}
+	}
+
+	sched.assumedPodsLock.Lock()
+	for uid, pod := range sched.assumedPods {
+		o, cached := observed[uid]
+		if sched.bindingFinished[uid] && (o || !cached) {
+			delete(sched.assumedPods, uid)
+			delete(sched.bindingFinished, uid)
+			continue
+		}
+		// the informer has observed the binding before it finishes.
+		if o {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	sched.assumedPodsLock.Unlock()
+
+	return pods, nodes, nil
+}
+
+// assume records that the pod is on the node until it's forgotten.
+// It returns the assumed pod, which is a copy of the pod with Spec.NodeName set.
+func (sched *Scheduler) assume(pod *v1.Pod, nodeName string) *v1.Pod {
+	assumed := pod.DeepCopy()
+	assumed.Spec.NodeName = nodeName
+
+	sched.assumedPodsLock.Lock()
+	defer sched.assumedPodsLock.Unlock()
+	sched.assumedPods[pod.UID] = assumed
+	return assumed
+}
+
+// finishBinding records that the assumed pod has been bound. The pod stays assumed until listPodsAndNodes finds
+// it on the node in the informer cache, which may lag behind API server.
+func (sched *Scheduler) finishBinding(pod *v1.Pod) {
+	sched.assumedPodsLock.Lock()
+	defer sched.assumedPodsLock.Unlock()
+	if _, ok := sched.assumedPods[pod.UID]; ok {
+		sched.bindingFinished[pod.UID] = true
+	}
+}
+
+// forget removes the pod assumed by assume. It's called when the scheduling or the binding has failed.
+func (sched *Scheduler) forget(pod *v1.Pod) {
+	sched.assumedPodsLock.Lock()
+	defer sched.assumedPodsLock.Unlock()
+	delete(sched.assumedPods, pod.UID)
+	delete(sched.bindingFinished, pod.UID)
+}
+
+// isAssumed returns whether the pod is assumed, i.e. it's waiting on permit or being bound.
+func (sched *Scheduler) isAssumed(pod *v1.Pod) bool {
+	sched.assumedPodsLock.RLock()
+	defer sched.assumedPodsLock.RUnlock()
+	_, ok := sched.assumedPods[pod.UID]
+	return ok
+}
@@ -0,0 +1,82 @@
+package minisched
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// TieBreakStrategy is how selectNode chooses a node among the nodes with the highest score.
+type TieBreakStrategy string
+
+const (
+	// TieBreakRandom chooses a node uniformly at random by reservoir sampling, as kube-scheduler does.
+	// Use WithRandomSeed to make it reproducible.
+	TieBreakRandom TieBreakStrategy = "Random"
+	// TieBreakLexical chooses the node with the smallest name in lexical order.
+	TieBreakLexical TieBreakStrategy = "Lexical"
+	// TieBreakLeastRecentlyChosen chooses the node which was selected least recently by this scheduler.
+	// Nodes never selected come first, and the ties among them are broken by name.
+	TieBreakLeastRecentlyChosen TieBreakStrategy = "LeastRecentlyChosen"
+)
+
+// TieBreakStrategies are the available tie-breaking strategies.
+var TieBreakStrategies = []TieBreakStrategy{TieBreakRandom, TieBreakLexical, TieBreakLeastRecentlyChosen}
+
+// tieBreaker chooses a node among the nodes with the same highest score.
+type tieBreaker interface {
+	// prefer returns true if candidate should replace current.
+	// n is the number of the nodes with the highest score seen so far, including candidate.
+	prefer(candidate, current string, n int) bool
+	// chosen is called with the node selected by the scheduling cycle.
+	chosen(nodeName string)
+}
+
+func newTieBreaker(strategy TieBreakStrategy, r *rand.Rand) (tieBreaker, error) {
+	switch strategy {
+	case TieBreakRandom:
+		return &randomTieBreaker{rand: r}, nil
+	case TieBreakLexical:
+		return lexicalTieBreaker{}, nil
+	case TieBreakLeastRecentlyChosen:
+		return &leastRecentlyChosenTieBreaker{lastChosen: map[string]uint64{}}, nil
+	}
+	return nil, fmt.Errorf("unknown tie-breaking strategy %q", strategy)
+}
+
+type randomTieBreaker struct {
+	rand *rand.Rand
+}
+
+func (t *randomTieBreaker) prefer(_, _ string, n int) bool {
+	// Replace the candidate with probability of 1/n
+	return t.rand.Intn(n) == 0
+}
+
+func (t *randomTieBreaker) chosen(string) {}
+
+type lexicalTieBreaker struct{}
+
+func (lexicalTieBreaker) prefer(candidate, current string, _ int) bool {
+	return candidate < current
+}
+
+func (lexicalTieBreaker) chosen(string) {}
+
+type leastRecentlyChosenTieBreaker struct {
+	// seq is incremented every time a node is chosen. The nodes never chosen have 0 in lastChosen.
+	seq        uint64
+	lastChosen map[string]uint64
+}
+
+func (t *leastRecentlyChosenTieBreaker) prefer(candidate, current string, _ int) bool {
+	c, cur := t.lastChosen[candidate], t.lastChosen[current]
+	if c != cur {
+		return c < cur
+	}
+	return candidate < current
+}
+
+func (t *leastRecentlyChosenTieBreaker) chosen(nodeName string) {
+	t.seq++
+	t.lastChosen[nodeName] = t.seq
+}
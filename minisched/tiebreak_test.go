@@ -0,0 +1,151 @@
+package minisched
+
+import (
+	"math/rand"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+func TestNewTieBreaker(t *testing.T) {
+	for _, s := range TieBreakStrategies {
+		if _, err := newTieBreaker(s, rand.New(rand.NewSource(1))); err != nil {
+			t.Errorf("newTieBreaker(%q): %v", s, err)
+		}
+	}
+	if _, err := newTieBreaker("Unknown", rand.New(rand.NewSource(1))); err == nil {
+		t.Errorf("newTieBreaker(%q) succeeded, want an error", "Unknown")
+	}
+}
+
+// shuffled returns a copy of nodeScoreList in a random order by seed.
+func shuffled(nodeScoreList framework.NodeScoreList, seed int64) framework.NodeScoreList {
+	result := append(framework.NodeScoreList(nil), nodeScoreList...)
+	rand.New(rand.NewSource(seed)).Shuffle(len(result), func(i, j int) {
+		result[i], result[j] = result[j], result[i]
+	})
+	return result
+}
+
+func TestMaxScoreSelector(t *testing.T) {
+	tied := framework.NodeScoreList{
+		{Name: "node-a", Score: 80},
+		{Name: "node-b", Score: 80},
+		{Name: "node-c", Score: 80},
+		{Name: "node-d", Score: 50},
+	}
+	highest := framework.NodeScoreList{
+		{Name: "node-a", Score: 80},
+		{Name: "node-b", Score: 80},
+		{Name: "node-c", Score: 50},
+		{Name: "node-d", Score: 90},
+	}
+	tests := []struct {
+		name     string
+		strategy TieBreakStrategy
+		// chosen are the nodes chosen by the previous scheduling cycles in order.
+		chosen []string
+		scores framework.NodeScoreList
+		// want are the nodes which can be selected.
+		want []string
+	}{
+		{name: "random among the ties", strategy: TieBreakRandom, scores: tied, want: []string{"node-a", "node-b", "node-c"}},
+		{name: "random with the highest score", strategy: TieBreakRandom, scores: highest, want: []string{"node-d"}},
+		{name: "lexical among the ties", strategy: TieBreakLexical, scores: tied, want: []string{"node-a"}},
+		{name: "lexical with the highest score", strategy: TieBreakLexical, scores: highest, want: []string{"node-d"}},
+		{name: "least recently chosen without history", strategy: TieBreakLeastRecentlyChosen, scores: tied, want: []string{"node-a"}},
+		{name: "least recently chosen prefers the nodes never chosen", strategy: TieBreakLeastRecentlyChosen, chosen: []string{"node-a"}, scores: tied, want: []string{"node-b"}},
+		{name: "least recently chosen prefers the node chosen first", strategy: TieBreakLeastRecentlyChosen, chosen: []string{"node-b", "node-a", "node-c"}, scores: tied, want: []string{"node-b"}},
+		{name: "least recently chosen ignores the history of the nodes not tied", strategy: TieBreakLeastRecentlyChosen, chosen: []string{"node-d"}, scores: tied, want: []string{"node-a"}},
+		{name: "least recently chosen with the highest score", strategy: TieBreakLeastRecentlyChosen, chosen: []string{"node-c", "node-d"}, scores: highest, want: []string{"node-d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := ""
+			for seed := int64(1); seed <= 20; seed++ {
+				// the tie-breaker has the same seed, so that the selection doesn't depend on the order of the list.
+				tb, err := newTieBreaker(tt.strategy, rand.New(rand.NewSource(1)))
+				if err != nil {
+					t.Fatalf("newTieBreaker: %v", err)
+				}
+				for _, n := range tt.chosen {
+					tb.chosen(n)
+				}
+				list := shuffled(tt.scores, seed)
+				got := (&maxScoreSelector{tieBreaker: tb}).selectNode(list)
+				if !contains(tt.want, got) {
+					t.Fatalf("selectNode(%v) = %s, want one of %v", list, got, tt.want)
+				}
+				if first == "" {
+					first = got
+				} else if got != first {
+					t.Fatalf("selectNode(%v) = %s, but %s for another order of the same nodes", list, got, first)
+				}
+			}
+		})
+	}
+}
+
+func TestRandomTieBreakerIsUniform(t *testing.T) {
+	tb, err := newTieBreaker(TieBreakRandom, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("newTieBreaker: %v", err)
+	}
+	s := &maxScoreSelector{tieBreaker: tb}
+	scores := framework.NodeScoreList{
+		{Name: "node-a", Score: 80},
+		{Name: "node-b", Score: 80},
+		{Name: "node-c", Score: 80},
+		{Name: "node-d", Score: 50},
+	}
+	const n = 3000
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		counts[s.selectNode(scores)]++
+	}
+	for _, name := range []string{"node-a", "node-b", "node-c"} {
+		if counts[name] < n/3*9/10 || counts[name] > n/3*11/10 {
+			t.Errorf("%s is selected %d times of %d, want about %d", name, counts[name], n, n/3)
+		}
+	}
+	if counts["node-d"] != 0 {
+		t.Errorf("node-d without the highest score is selected %d times", counts["node-d"])
+	}
+}
+
+func TestLeastRecentlyChosenTieBreakerRotates(t *testing.T) {
+	tb, err := newTieBreaker(TieBreakLeastRecentlyChosen, nil)
+	if err != nil {
+		t.Fatalf("newTieBreaker: %v", err)
+	}
+	sched := &Scheduler{tieBreaker: tb, nodeSelector: &maxScoreSelector{tieBreaker: tb}}
+	scores := framework.NodeScoreList{
+		{Name: "node-c", Score: 80},
+		{Name: "node-a", Score: 80},
+		{Name: "node-b", Score: 80},
+	}
+
+	var got []string
+	for i := 0; i < 5; i++ {
+		nodeName, err := sched.selectNode(shuffled(scores, int64(i)))
+		if err != nil {
+			t.Fatalf("selectNode: %v", err)
+		}
+		got = append(got, nodeName)
+	}
+	want := []string{"node-a", "node-b", "node-c", "node-a", "node-b"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("selected nodes = %v, want %v", got, want)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
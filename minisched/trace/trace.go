@@ -0,0 +1,158 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// EventType is the type of the trace event.
+type EventType string
+
+const (
+	// Informer is an event delivered from the informers to the event handlers of the scheduler.
+	Informer EventType = "Informer"
+	// Decision is the result of a scheduling cycle.
+	Decision EventType = "Decision"
+)
+
+// Actions of InformerEvent.
+const (
+	ActionAdd    = "Add"
+	ActionUpdate = "Update"
+	ActionDelete = "Delete"
+)
+
+// Event is an event in the trace. Either InformerEvent or SchedulingDecision is set.
+type Event struct {
+	Time     time.Time           `json:"time"`
+	Type     EventType           `json:"type"`
+	Informer *InformerEvent      `json:"informer,omitempty"`
+	Decision *SchedulingDecision `json:"decision,omitempty"`
+}
+
+// InformerEvent is an Add, Update or Delete event of a Pod or a Node.
+// Old is set only for Update.
+type InformerEvent struct {
+	// Resource is "Pod" or "Node".
+	Resource string `json:"resource"`
+	// Action is ActionAdd, ActionUpdate or ActionDelete.
+	Action  string   `json:"action"`
+	Pod     *v1.Pod  `json:"pod,omitempty"`
+	OldPod  *v1.Pod  `json:"oldPod,omitempty"`
+	Node    *v1.Node `json:"node,omitempty"`
+	OldNode *v1.Node `json:"oldNode,omitempty"`
+}
+
+// SchedulingDecision is the result of a scheduling cycle.
+type SchedulingDecision struct {
+	// Pod is namespace/name of the pod.
+	Pod        string    `json:"pod"`
+	CycleStart time.Time `json:"cycleStart"`
+	// NodeName is the selected node. Empty if the scheduling failed.
+	NodeName string `json:"nodeName,omitempty"`
+	// SelectionStrategy is the node selection strategy which chose NodeName.
+	SelectionStrategy string `json:"selectionStrategy,omitempty"`
+	// SelectedRank is the rank of NodeName by score among the feasible nodes (1 is the highest).
+	// The nodes with the same score share the best rank.
+	SelectedRank int `json:"selectedRank,omitempty"`
+	// Scores is the total score of each feasible node.
+	Scores map[string]int64 `json:"scores,omitempty"`
+	// Statuses is the message of the failed status of each node (node name -> message).
+	Statuses map[string]string `json:"statuses,omitempty"`
+	// Error is the reason why the scheduling failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder records trace events.
+type Recorder interface {
+	Record(e *Event)
+}
+
+// Writer is a Recorder which writes events to w as JSON lines.
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+var _ Recorder = &Writer{}
+
+// NewWriter creates Writer.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{enc: json.NewEncoder(w)}
+}
+
+// Record writes the event. The first error is kept and returned by Err, and later events are dropped.
+func (w *Writer) Record(e *Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return
+	}
+	w.err = w.enc.Encode(e)
+}
+
+// Err returns the error occurred on writing events.
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Collector is a Recorder which keeps events in memory.
+type Collector struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+var _ Recorder = &Collector{}
+
+// Record appends the event.
+func (c *Collector) Record(e *Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+}
+
+// Events returns the recorded events.
+func (c *Collector) Events() []*Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Event(nil), c.events...)
+}
+
+// Read reads the events written by Writer.
+func Read(r io.Reader) ([]*Event, error) {
+	var events []*Event
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		e := &Event{}
+		if err := dec.Decode(e); err != nil {
+			if err == io.EOF {
+				return events, nil
+			}
+			return nil, fmt.Errorf("decode event %d: %w", len(events), err)
+		}
+		events = append(events, e)
+	}
+}
+
+// Object returns the object and the old object (only for Update) of the event.
+func (e *InformerEvent) Object() (interface{}, interface{}) {
+	if e.Pod != nil {
+		if e.OldPod != nil {
+			return e.Pod, e.OldPod
+		}
+		return e.Pod, nil
+	}
+	if e.OldNode != nil {
+		return e.Node, e.OldNode
+	}
+	return e.Node, nil
+}
@@ -9,23 +9,28 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/utils/clock"
 )
 
 type Handle interface {
 	// GetWaitingPod returns a waiting pod given its UID.
 	GetWaitingPod(uid types.UID) *WaitingPod
+	// Clock returns the clock of the scheduler. Plugins should use it instead of the time package
+	// so that they follow the virtual time in simulation.
+	Clock() clock.WithDelayedExecution
 }
 
 // WaitingPod represents a pod waiting in the permit phase.
 type WaitingPod struct {
 	pod            *v1.Pod
-	pendingPlugins map[string]*time.Timer
+	pendingPlugins map[string]clock.Timer
 	s              chan *framework.Status
 	mu             sync.RWMutex
 }
 
 // NewWaitingPod returns a new WaitingPod instance.
-func NewWaitingPod(pod *v1.Pod, pluginsMaxWaitTime map[string]time.Duration) *WaitingPod {
+// The timeouts of the plugins are measured by clk.
+func NewWaitingPod(pod *v1.Pod, pluginsMaxWaitTime map[string]time.Duration, clk clock.WithDelayedExecution) *WaitingPod {
 	wp := &WaitingPod{
 		pod: pod,
 		// by using non-blocking send to this channel. This channel has a buffer of size 1
@@ -34,14 +39,14 @@ func NewWaitingPod(pod *v1.Pod, pluginsMaxWaitTime map[string]time.Duration) *Wa
 		s: make(chan *framework.Status, 1),
 	}
 
-	wp.pendingPlugins = make(map[string]*time.Timer, len(pluginsMaxWaitTime))
-	// The time.AfterFunc calls wp.Reject which iterates through pendingPlugins map. Acquire the
-	// lock here so that time.AfterFunc can only execute after NewWaitingPod finishes.
+	wp.pendingPlugins = make(map[string]clock.Timer, len(pluginsMaxWaitTime))
+	// The clk.AfterFunc calls wp.Reject which iterates through pendingPlugins map. Acquire the
+	// lock here so that clk.AfterFunc can only execute after NewWaitingPod finishes.
 	wp.mu.Lock()
 	defer wp.mu.Unlock()
 	for k, v := range pluginsMaxWaitTime {
 		plugin, waitTime := k, v
-		wp.pendingPlugins[plugin] = time.AfterFunc(waitTime, func() {
+		wp.pendingPlugins[plugin] = clk.AfterFunc(waitTime, func() {
 			msg := fmt.Sprintf("rejected due to timeout after waiting %v at plugin %v",
 				waitTime, plugin)
 			wp.Reject(plugin, msg)
@@ -0,0 +1,105 @@
+package minisched
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// FitsNewNode runs the pre filter and the filter plugins for the pod as if the node, which isn't in the cluster,
+// were added with the pods on it, e.g. for a cluster autoscaler to check whether a node made from a template
+// makes the pending pod schedulable. It returns nil if the pod fits the node.
+// It waits for the current scheduling cycle to finish. The next scheduling cycle takes the snapshot again,
+// so the node doesn't affect the scheduling.
+func (sched *Scheduler) FitsNewNode(ctx context.Context, pod *v1.Pod, node *v1.Node, pods []*v1.Pod) *framework.Status {
+	sched.cycleLock.Lock()
+	defer sched.cycleLock.Unlock()
+
+	if err := sched.updateSnapshotWithNode(node, pods); err != nil {
+		return framework.AsStatus(err)
+	}
+
+	state := framework.NewCycleState()
+	if status := sched.RunPreFilterPlugins(ctx, state, pod); !status.IsSuccess() {
+		return status
+	}
+	nodeInfo, err := sched.snapshot.NodeInfos().Get(node.Name)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+	return sched.RunFilterPluginsWithNominatedPods(ctx, state, pod, nodeInfo)
+}
+
+// FitsExistingNode runs the pre filter and the filter plugins for the pod against the nodes in the cluster.
+// It returns nil if some node passes them, i.e. the pod will be scheduled without a new node (e.g. the pod failed
+// to be scheduled before a node was added), or the unschedulable status if no node passes them.
+// The pod which is assumed (i.e. waiting on permit or being bound) is regarded as fitting, since it has
+// a node already though its status may still have the unschedulable condition of the previous attempt.
+// Like FitsNewNode, it waits for the current scheduling cycle to finish.
+func (sched *Scheduler) FitsExistingNode(ctx context.Context, pod *v1.Pod) *framework.Status {
+	sched.cycleLock.Lock()
+	defer sched.cycleLock.Unlock()
+
+	if sched.isAssumed(pod) {
+		return nil
+	}
+
+	if err := sched.updateSnapshot(); err != nil {
+		return framework.AsStatus(err)
+	}
+
+	state := framework.NewCycleState()
+	if status := sched.RunPreFilterPlugins(ctx, state, pod); !status.IsSuccess() {
+		return status
+	}
+	nodeInfos, err := sched.snapshot.NodeInfos().List()
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+	if _, err := sched.RunFilterPlugins(ctx, state, pod, nodeInfos); err != nil {
+		if fitErr, ok := err.(*framework.FitError); ok {
+			return framework.NewStatus(framework.Unschedulable, fitErr.Error())
+		}
+		return framework.AsStatus(err)
+	}
+	return nil
+}
+
+// ScoreAssignedPod runs the plugins from pre filter to score for the pod which is on a node, as if the pod were
+// removed from the node and scheduled again, e.g. for a rebalancer to compare the score of the current node with
+// the other nodes. It returns the scores of the nodes which pass the filter plugins, which include the current node
+// unless it doesn't fit the pod any longer, or the unschedulable status if no node passes them.
+// Like FitsNewNode, it waits for the current scheduling cycle to finish.
+func (sched *Scheduler) ScoreAssignedPod(ctx context.Context, pod *v1.Pod) (framework.NodeScoreList, *framework.Status) {
+	sched.cycleLock.Lock()
+	defer sched.cycleLock.Unlock()
+
+	if err := sched.updateSnapshotWithoutPod(pod); err != nil {
+		return nil, framework.AsStatus(err)
+	}
+
+	// the pod is scheduled again, so the NodeName plugin must not restrict it to the current node.
+	pod = pod.DeepCopy()
+	pod.Spec.NodeName = ""
+
+	state := framework.NewCycleState()
+	if status := sched.RunPreFilterPlugins(ctx, state, pod); !status.IsSuccess() {
+		return nil, status
+	}
+	nodeInfos, err := sched.snapshot.NodeInfos().List()
+	if err != nil {
+		return nil, framework.AsStatus(err)
+	}
+	feasibleNodes, err := sched.RunFilterPlugins(ctx, state, pod, nodeInfos)
+	if err != nil {
+		if fitErr, ok := err.(*framework.FitError); ok {
+			return nil, framework.NewStatus(framework.Unschedulable, fitErr.Error())
+		}
+		return nil, framework.AsStatus(err)
+	}
+	if status := sched.RunPreScorePlugins(ctx, state, pod, feasibleNodes); !status.IsSuccess() {
+		return nil, status
+	}
+	return sched.RunScorePlugins(ctx, state, pod, feasibleNodes)
+}
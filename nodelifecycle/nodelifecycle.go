@@ -0,0 +1,490 @@
+package nodelifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
+	"k8s.io/utils/clock"
+)
+
+// Options is the options of Controller.
+type Options struct {
+	// DefaultNotReadyTolerationSeconds and DefaultUnreachableTolerationSeconds are the tolerationSeconds of the pods
+	// which don't tolerate the not-ready and unreachable NoExecute taints, as the DefaultTolerationSeconds admission
+	// plugin of kube-apiserver adds them (which doesn't run in the simulator).
+	DefaultNotReadyTolerationSeconds    int64
+	DefaultUnreachableTolerationSeconds int64
+}
+
+// DefaultOptions returns the options with the defaults of kube-apiserver.
+func DefaultOptions() Options {
+	return Options{
+		DefaultNotReadyTolerationSeconds:    300,
+		DefaultUnreachableTolerationSeconds: 300,
+	}
+}
+
+// Controller is a stand-in of the node lifecycle controller of kube-controller-manager for the simulator.
+// There is no kubelet posting the node status, so the Ready condition of the nodes is set by scenarios (SetNodeReady),
+// and a node with no Ready condition is regarded as ready. Like the node lifecycle controller, it
+//   - taints the node with node.kubernetes.io/not-ready (Ready is False) or node.kubernetes.io/unreachable
+//     (Ready is Unknown) with the NoSchedule and NoExecute effects, and removes the taints when the node gets ready.
+//   - evicts (deletes) the pods on the nodes with NoExecute taints which the pods don't tolerate, at once or after
+//     the least tolerationSeconds of the tolerations of the taints, counted from when the pod is found on the tainted node.
+//
+// The taints are updated through the API server, so the scheduler gets them as node update events.
+type Controller struct {
+	client clientset.Interface
+	opts   Options
+	clock  clock.WithDelayedExecution
+
+	nodeLister corelisters.NodeLister
+	podLister  corelisters.PodLister
+
+	nodeQueue workqueue.RateLimitingInterface
+	podQueue  workqueue.RateLimitingInterface
+
+	// mu protects tolerationStart.
+	mu sync.Mutex
+	// tolerationStart is the time when each pod is found tolerating the NoExecute taints of its node for a while.
+	tolerationStart map[types.UID]time.Time
+}
+
+// StartNodeLifecycleController starts Controller with its own informers, and returns the function to stop it.
+// clk is the clock for the taints and the tolerationSeconds, e.g. the virtual clock of the scheduler.
+func StartNodeLifecycleController(client clientset.Interface, opts Options, clk clock.WithDelayedExecution) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	c := New(client, informerFactory, opts, clk)
+
+	informerFactory.Start(ctx.Done())
+	for typ, synced := range informerFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			cancel()
+			return nil, xerrors.Errorf("wait for cache sync of %v", typ)
+		}
+	}
+
+	go c.Run(ctx)
+
+	return cancel, nil
+}
+
+// New creates Controller and registers its event handlers to the informers.
+func New(client clientset.Interface, informerFactory informers.SharedInformerFactory, opts Options, clk clock.WithDelayedExecution) *Controller {
+	c := &Controller{
+		client:          client,
+		opts:            opts,
+		clock:           clk,
+		nodeLister:      informerFactory.Core().V1().Nodes().Lister(),
+		podLister:       informerFactory.Core().V1().Pods().Lister(),
+		nodeQueue:       workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "nodes"),
+		podQueue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "evictions"),
+		tolerationStart: map[types.UID]time.Time{},
+	}
+
+	informerFactory.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueNode,
+		UpdateFunc: c.updateNode,
+	})
+	informerFactory.Core().V1().Pods().Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = d.Obj
+			}
+			pod, ok := obj.(*v1.Pod)
+			return ok && pod.Spec.NodeName != ""
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.enqueuePod,
+			UpdateFunc: func(_, newObj interface{}) { c.enqueuePod(newObj) },
+			DeleteFunc: c.deletePod,
+		},
+	})
+
+	return c
+}
+
+// Run runs the workers until ctx is done.
+func (c *Controller) Run(ctx context.Context) {
+	defer c.nodeQueue.ShutDown()
+	defer c.podQueue.ShutDown()
+
+	klog.Info("nodelifecycle: starting")
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for c.processNextItem(ctx, c.nodeQueue, c.syncNode) {
+		}
+	}, time.Second)
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for c.processNextItem(ctx, c.podQueue, c.syncPod) {
+		}
+	}, time.Second)
+
+	<-ctx.Done()
+	klog.Info("nodelifecycle: shutting down")
+}
+
+// processNextItem syncs the next key in the queue. The key is retried with backoff if the sync fails.
+// It returns false if the queue is shut down.
+func (c *Controller) processNextItem(ctx context.Context, queue workqueue.RateLimitingInterface, sync func(ctx context.Context, key string) error) bool {
+	key, quit := queue.Get()
+	if quit {
+		return false
+	}
+	defer queue.Done(key)
+
+	if err := sync(ctx, key.(string)); err != nil {
+		klog.Warningf("nodelifecycle: failed to sync %v, retrying: %v", key, err)
+		queue.AddRateLimited(key)
+		return true
+	}
+	queue.Forget(key)
+	return true
+}
+
+func (c *Controller) enqueueNode(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("nodelifecycle: failed to get key of node: %v", err)
+		return
+	}
+	c.nodeQueue.Add(key)
+}
+
+// updateNode syncs the node, and the pods on it if its taints are changed (by this controller or anyone else).
+func (c *Controller) updateNode(oldObj, newObj interface{}) {
+	c.enqueueNode(newObj)
+
+	oldNode, ok := oldObj.(*v1.Node)
+	if !ok {
+		return
+	}
+	newNode, ok := newObj.(*v1.Node)
+	if !ok {
+		return
+	}
+	if taintsEqual(noExecuteTaints(oldNode.Spec.Taints), noExecuteTaints(newNode.Spec.Taints)) {
+		return
+	}
+	pods, err := c.podLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("nodelifecycle: failed to list pods: %v", err)
+		return
+	}
+	for _, pod := range pods {
+		if pod.Spec.NodeName == newNode.Name {
+			c.enqueuePod(pod)
+		}
+	}
+}
+
+func (c *Controller) enqueuePod(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("nodelifecycle: failed to get key of pod: %v", err)
+		return
+	}
+	c.podQueue.Add(key)
+}
+
+func (c *Controller) deletePod(obj interface{}) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	if pod, ok := obj.(*v1.Pod); ok {
+		c.forget(pod.UID)
+	}
+}
+
+func (c *Controller) forget(uid types.UID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tolerationStart, uid)
+}
+
+// syncNode updates the taints of the node by its Ready condition.
+func (c *Controller) syncNode(ctx context.Context, name string) error {
+	node, err := c.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("get node %s: %w", name, err)
+	}
+
+	taints := desiredTaints(node, c.clock.Now())
+	if taintsEqual(taints, node.Spec.Taints) {
+		return nil
+	}
+
+	node = node.DeepCopy()
+	node.Spec.Taints = taints
+	if _, err := c.client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		return xerrors.Errorf("update taints of node %s: %w", name, err)
+	}
+	klog.Infof("nodelifecycle: updated taints of node %s (Ready=%s): %v", name, readyStatus(node), taints)
+	return nil
+}
+
+// desiredTaints returns the taints of the node with the not-ready and unreachable taints replaced by its Ready condition.
+// The taints which the node already has are kept as they are, so that TimeAdded doesn't change.
+func desiredTaints(node *v1.Node, now time.Time) []v1.Taint {
+	var want []v1.Taint
+	switch readyStatus(node) {
+	case v1.ConditionFalse:
+		want = conditionTaints(v1.TaintNodeNotReady, now)
+	case v1.ConditionUnknown:
+		want = conditionTaints(v1.TaintNodeUnreachable, now)
+	}
+
+	var taints []v1.Taint
+	for _, t := range node.Spec.Taints {
+		if t.Key != v1.TaintNodeNotReady && t.Key != v1.TaintNodeUnreachable {
+			taints = append(taints, t)
+			continue
+		}
+		for i := range want {
+			if want[i].MatchTaint(&t) {
+				want[i] = t
+			}
+		}
+	}
+	return append(taints, want...)
+}
+
+// conditionTaints returns the NoSchedule and NoExecute taints of the key.
+func conditionTaints(key string, now time.Time) []v1.Taint {
+	timeAdded := metav1.NewTime(now)
+	return []v1.Taint{
+		{Key: key, Effect: v1.TaintEffectNoSchedule},
+		{Key: key, Effect: v1.TaintEffectNoExecute, TimeAdded: &timeAdded},
+	}
+}
+
+// readyStatus returns the status of the Ready condition of the node, or True if the node has no Ready condition.
+func readyStatus(node *v1.Node) v1.ConditionStatus {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status
+		}
+	}
+	return v1.ConditionTrue
+}
+
+// syncPod evicts the pod if it doesn't tolerate the NoExecute taints of its node, or requeues it to the end of its tolerationSeconds.
+func (c *Controller) syncPod(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return xerrors.Errorf("split key %s: %w", key, err)
+	}
+	pod, err := c.podLister.Pods(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("get pod %s: %w", key, err)
+	}
+	if pod.DeletionTimestamp != nil || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		c.forget(pod.UID)
+		return nil
+	}
+
+	node, err := c.nodeLister.Get(pod.Spec.NodeName)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("get node %s: %w", pod.Spec.NodeName, err)
+	}
+	taints := noExecuteTaints(node.Spec.Taints)
+	if len(taints) == 0 {
+		c.forget(pod.UID)
+		return nil
+	}
+
+	allTolerated, used := v1helper.GetMatchingTolerations(taints, c.tolerations(pod))
+	if !allTolerated {
+		return c.evict(ctx, pod, "the pod doesn't tolerate the taints of the node")
+	}
+	tolerationTime := minTolerationTime(used)
+	if tolerationTime < 0 {
+		return nil
+	}
+
+	now := c.clock.Now()
+	c.mu.Lock()
+	start, ok := c.tolerationStart[pod.UID]
+	if !ok {
+		start = now
+		c.tolerationStart[pod.UID] = start
+	}
+	c.mu.Unlock()
+
+	if wait := start.Add(tolerationTime).Sub(now); wait > 0 {
+		// workqueue's AddAfter isn't used because it waits in real time.
+		c.clock.AfterFunc(wait, func() {
+			c.podQueue.Add(key)
+		})
+		return nil
+	}
+	return c.evict(ctx, pod, "the tolerationSeconds of the pod passed")
+}
+
+// tolerations returns the tolerations of the pod with the default tolerations for not-ready and unreachable.
+func (c *Controller) tolerations(pod *v1.Pod) []v1.Toleration {
+	tolerations := pod.Spec.Tolerations
+	defaults := []struct {
+		key     string
+		seconds int64
+	}{
+		{key: v1.TaintNodeNotReady, seconds: c.opts.DefaultNotReadyTolerationSeconds},
+		{key: v1.TaintNodeUnreachable, seconds: c.opts.DefaultUnreachableTolerationSeconds},
+	}
+	for _, d := range defaults {
+		taint := &v1.Taint{Key: d.key, Effect: v1.TaintEffectNoExecute}
+		if tolerates(pod.Spec.Tolerations, taint) {
+			continue
+		}
+		seconds := d.seconds
+		tolerations = append(tolerations, v1.Toleration{
+			Key:               d.key,
+			Operator:          v1.TolerationOpExists,
+			Effect:            v1.TaintEffectNoExecute,
+			TolerationSeconds: &seconds,
+		})
+	}
+	return tolerations
+}
+
+func tolerates(tolerations []v1.Toleration, taint *v1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// evict deletes the pod like the taint manager of kube-controller-manager.
+func (c *Controller) evict(ctx context.Context, pod *v1.Pod, reason string) error {
+	err := c.client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+		Preconditions: metav1.NewUIDPreconditions(string(pod.UID)),
+	})
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		return xerrors.Errorf("delete pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	klog.Infof("nodelifecycle: evicted pod %s/%s from node %s: %s", pod.Namespace, pod.Name, pod.Spec.NodeName, reason)
+	c.forget(pod.UID)
+	return nil
+}
+
+// minTolerationTime returns the least tolerationSeconds of the tolerations, or -1 if all of them tolerate forever.
+func minTolerationTime(tolerations []v1.Toleration) time.Duration {
+	min := time.Duration(-1)
+	for _, t := range tolerations {
+		if t.TolerationSeconds == nil {
+			continue
+		}
+		d := time.Duration(*t.TolerationSeconds) * time.Second
+		if d < 0 {
+			d = 0
+		}
+		if min < 0 || d < min {
+			min = d
+		}
+	}
+	return min
+}
+
+func noExecuteTaints(taints []v1.Taint) []v1.Taint {
+	var result []v1.Taint
+	for _, t := range taints {
+		if t.Effect == v1.TaintEffectNoExecute {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// taintsEqual returns true if the taints have the same keys, values and effects in the same order.
+func taintsEqual(a, b []v1.Taint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key || a[i].Value != b[i].Value || a[i].Effect != b[i].Effect {
+			return false
+		}
+	}
+	return true
+}
+
+// SetNodeReady sets the status of the Ready condition of the node, to simulate a node failure (False for NotReady,
+// Unknown for Unreachable) or recovery (True). The reasons and messages are those set by kubelet and
+// the node lifecycle controller.
+func SetNodeReady(ctx context.Context, client clientset.Interface, name string, status v1.ConditionStatus) error {
+	var reason, message string
+	switch status {
+	case v1.ConditionTrue:
+		reason, message = "KubeletReady", "kubelet is posting ready status"
+	case v1.ConditionFalse:
+		reason, message = "KubeletNotReady", "container runtime is down"
+	case v1.ConditionUnknown:
+		reason, message = "NodeStatusUnknown", "Kubelet stopped posting node status."
+	default:
+		return xerrors.Errorf("invalid status %q of Ready condition, must be True, False or Unknown", status)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return xerrors.Errorf("get node %s: %w", name, err)
+		}
+
+		now := metav1.Now()
+		condition := v1.NodeCondition{
+			Type:               v1.NodeReady,
+			Status:             status,
+			LastHeartbeatTime:  now,
+			LastTransitionTime: now,
+			Reason:             reason,
+			Message:            message,
+		}
+		found := false
+		for i, c := range node.Status.Conditions {
+			if c.Type != v1.NodeReady {
+				continue
+			}
+			found = true
+			if c.Status == status {
+				condition.LastTransitionTime = c.LastTransitionTime
+			}
+			node.Status.Conditions[i] = condition
+		}
+		if !found {
+			node.Status.Conditions = append(node.Status.Conditions, condition)
+		}
+
+		if _, err := client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{}); err != nil {
+			return xerrors.Errorf("update status of node %s: %w", name, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,331 @@
+package provisioner
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/reference"
+	"k8s.io/client-go/util/workqueue"
+	storagehelpers "k8s.io/component-helpers/storage/volume"
+	"k8s.io/klog"
+	pvutil "k8s.io/kubernetes/pkg/controller/volume/persistentvolume/util"
+)
+
+// AnyProvisioner in Options.Provisioners makes Provisioner provision the volumes of all the StorageClasses
+// which support dynamic provisioning, i.e. whose provisioner is not kubernetes.io/no-provisioner.
+const AnyProvisioner = "*"
+
+// resyncPeriod is the interval to retry the claims, e.g. those created before their StorageClasses.
+const resyncPeriod = 15 * time.Second
+
+// Options is the options of Provisioner.
+type Options struct {
+	// Provisioners are the names of the provisioners (the provisioner field of StorageClasses) to provision volumes for.
+	// AnyProvisioner matches all of them.
+	Provisioners []string
+	// TopologyKeys are the node labels which the provisioned volumes are restricted to by their node affinity,
+	// with the values of the selected node. They are used if the CSINode of the selected node doesn't have
+	// the topology keys of the driver named as the provisioner.
+	TopologyKeys []string
+}
+
+// DefaultOptions returns the Options to provision volumes for all StorageClasses in the zone of the selected node.
+func DefaultOptions() Options {
+	return Options{
+		Provisioners: []string{AnyProvisioner},
+		TopologyKeys: []string{v1.LabelTopologyZone},
+	}
+}
+
+// Provisioner is a stand-in of the dynamic provisioners (e.g. external-provisioner of CSI drivers) for the simulator.
+// It creates a PV for each unbound claim of the configured StorageClasses without creating a real volume.
+// The PV is bound to the claim by its claimRef, and the PV controller completes the binding.
+//
+// Like external-provisioner, the claims of WaitForFirstConsumer StorageClasses are provisioned after the VolumeBinding
+// plugin of the scheduler sets the selected node annotation, and the PVs get the node affinity to the topology of the node.
+// The claims of Immediate StorageClasses are provisioned at once, in the first allowed topology of the class if any.
+type Provisioner struct {
+	client clientset.Interface
+	opts   Options
+
+	claimLister   corelisters.PersistentVolumeClaimLister
+	volumeLister  corelisters.PersistentVolumeLister
+	classLister   storagelisters.StorageClassLister
+	nodeLister    corelisters.NodeLister
+	csiNodeLister storagelisters.CSINodeLister
+
+	queue workqueue.RateLimitingInterface
+}
+
+// StartProvisioner starts Provisioner with its own informers, and returns the function to stop it.
+func StartProvisioner(client clientset.Interface, opts Options) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	informerFactory := informers.NewSharedInformerFactory(client, resyncPeriod)
+	p := New(client, informerFactory, opts)
+
+	informerFactory.Start(ctx.Done())
+	for typ, synced := range informerFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			cancel()
+			return nil, xerrors.Errorf("wait for cache sync of %v", typ)
+		}
+	}
+
+	go p.Run(ctx)
+
+	return cancel, nil
+}
+
+// New creates Provisioner and registers its event handlers to the informers.
+func New(client clientset.Interface, informerFactory informers.SharedInformerFactory, opts Options) *Provisioner {
+	p := &Provisioner{
+		client:        client,
+		opts:          opts,
+		claimLister:   informerFactory.Core().V1().PersistentVolumeClaims().Lister(),
+		volumeLister:  informerFactory.Core().V1().PersistentVolumes().Lister(),
+		classLister:   informerFactory.Storage().V1().StorageClasses().Lister(),
+		nodeLister:    informerFactory.Core().V1().Nodes().Lister(),
+		csiNodeLister: informerFactory.Storage().V1().CSINodes().Lister(),
+		queue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "provisioner"),
+	}
+
+	informerFactory.Core().V1().PersistentVolumeClaims().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    p.enqueueClaim,
+		UpdateFunc: func(_, newObj interface{}) { p.enqueueClaim(newObj) },
+	})
+
+	return p
+}
+
+// Run runs the worker until ctx is done.
+func (p *Provisioner) Run(ctx context.Context) {
+	defer p.queue.ShutDown()
+
+	klog.Info("provisioner: starting")
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for p.processNextItem(ctx) {
+		}
+	}, time.Second)
+
+	<-ctx.Done()
+	klog.Info("provisioner: shutting down")
+}
+
+// processNextItem syncs the next claim in the queue. The claim is retried with backoff if the sync fails.
+// It returns false if the queue is shut down.
+func (p *Provisioner) processNextItem(ctx context.Context) bool {
+	key, quit := p.queue.Get()
+	if quit {
+		return false
+	}
+	defer p.queue.Done(key)
+
+	if err := p.syncClaim(ctx, key.(string)); err != nil {
+		klog.Warningf("provisioner: failed to provision volume for claim %v, retrying: %v", key, err)
+		p.queue.AddRateLimited(key)
+		return true
+	}
+	p.queue.Forget(key)
+	return true
+}
+
+func (p *Provisioner) enqueueClaim(obj interface{}) {
+	claim, ok := obj.(*v1.PersistentVolumeClaim)
+	if !ok || claim.Spec.VolumeName != "" {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(claim)
+	if err != nil {
+		klog.Errorf("provisioner: failed to get key of claim: %v", err)
+		return
+	}
+	p.queue.Add(key)
+}
+
+// syncClaim provisions a volume for the claim if it should be.
+func (p *Provisioner) syncClaim(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return xerrors.Errorf("split key %s: %w", key, err)
+	}
+	claim, err := p.claimLister.PersistentVolumeClaims(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("get claim %s: %w", key, err)
+	}
+	if claim.Spec.VolumeName != "" || claim.DeletionTimestamp != nil {
+		return nil
+	}
+
+	className := storagehelpers.GetPersistentVolumeClaimClass(claim)
+	if className == "" {
+		return nil
+	}
+	class, err := p.classLister.Get(className)
+	if apierrors.IsNotFound(err) {
+		// retried at resync after the class is created.
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("get storage class %s: %w", className, err)
+	}
+	if !p.handles(class) {
+		return nil
+	}
+
+	if _, err := p.volumeLister.Get(volumeName(claim)); err == nil {
+		// already provisioned.
+		return nil
+	}
+
+	var node *v1.Node
+	if class.VolumeBindingMode != nil && *class.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer {
+		nodeName, ok := claim.Annotations[pvutil.AnnSelectedNode]
+		if !ok {
+			// wait for the scheduler to select a node, which it does only if no PV matches the claim on the node.
+			return nil
+		}
+		node, err = p.nodeLister.Get(nodeName)
+		if err != nil {
+			return xerrors.Errorf("get selected node %s: %w", nodeName, err)
+		}
+	} else {
+		// Like the PV controller, the claim is provisioned only if no PV matches it.
+		volumes, err := p.volumeLister.List(labels.Everything())
+		if err != nil {
+			return xerrors.Errorf("list volumes: %w", err)
+		}
+		volume, err := pvutil.FindMatchingVolume(claim, volumes, nil, nil, false)
+		if err != nil {
+			return xerrors.Errorf("find volume for claim %s: %w", key, err)
+		}
+		if volume != nil {
+			return nil
+		}
+	}
+
+	volume, err := p.newVolume(claim, class, node)
+	if err != nil {
+		return err
+	}
+	if _, err := p.client.CoreV1().PersistentVolumes().Create(ctx, volume, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return xerrors.Errorf("create volume %s: %w", volume.Name, err)
+	}
+	klog.Infof("provisioner: provisioned volume %s for claim %s", volume.Name, key)
+	return nil
+}
+
+// handles returns true if the provisioner of the class is configured.
+func (p *Provisioner) handles(class *storagev1.StorageClass) bool {
+	if class.Provisioner == "" || class.Provisioner == pvutil.NotSupportedProvisioner {
+		return false
+	}
+	provisioners := sets.NewString(p.opts.Provisioners...)
+	return provisioners.Has(AnyProvisioner) || provisioners.Has(class.Provisioner)
+}
+
+// newVolume returns the volume to provision for the claim. It's pre-bound to the claim by its claimRef.
+// The volume is a CSI volume of the driver named as the provisioner, so that it's counted by the NodeVolumeLimits plugin.
+func (p *Provisioner) newVolume(claim *v1.PersistentVolumeClaim, class *storagev1.StorageClass, node *v1.Node) (*v1.PersistentVolume, error) {
+	claimRef, err := reference.GetReference(scheme.Scheme, claim)
+	if err != nil {
+		return nil, xerrors.Errorf("get reference to claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+	reclaimPolicy := v1.PersistentVolumeReclaimDelete
+	if class.ReclaimPolicy != nil {
+		reclaimPolicy = *class.ReclaimPolicy
+	}
+
+	name := volumeName(claim)
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{pvutil.AnnDynamicallyProvisioned: class.Provisioner},
+		},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity: v1.ResourceList{
+				v1.ResourceStorage: claim.Spec.Resources.Requests[v1.ResourceStorage],
+			},
+			AccessModes:                   claim.Spec.AccessModes,
+			VolumeMode:                    claim.Spec.VolumeMode,
+			ClaimRef:                      claimRef,
+			PersistentVolumeReclaimPolicy: reclaimPolicy,
+			StorageClassName:              class.Name,
+			MountOptions:                  class.MountOptions,
+			NodeAffinity:                  p.nodeAffinity(class, node),
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       class.Provisioner,
+					VolumeHandle: name,
+				},
+			},
+		},
+	}, nil
+}
+
+// nodeAffinity returns the node affinity of the volume provisioned for the node.
+// The volume is restricted to the values of the topology keys of the node. If the node is nil (i.e. Immediate binding),
+// the volume is restricted to the first allowed topology of the class, if any.
+func (p *Provisioner) nodeAffinity(class *storagev1.StorageClass, node *v1.Node) *v1.VolumeNodeAffinity {
+	var requirements []v1.NodeSelectorRequirement
+	if node == nil {
+		if len(class.AllowedTopologies) == 0 {
+			return nil
+		}
+		for _, e := range class.AllowedTopologies[0].MatchLabelExpressions {
+			requirements = append(requirements, v1.NodeSelectorRequirement{Key: e.Key, Operator: v1.NodeSelectorOpIn, Values: e.Values})
+		}
+	} else {
+		for _, key := range p.topologyKeys(class, node) {
+			if value, ok := node.Labels[key]; ok {
+				requirements = append(requirements, v1.NodeSelectorRequirement{Key: key, Operator: v1.NodeSelectorOpIn, Values: []string{value}})
+			}
+		}
+	}
+	if len(requirements) == 0 {
+		return nil
+	}
+
+	return &v1.VolumeNodeAffinity{
+		Required: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: requirements}},
+		},
+	}
+}
+
+// topologyKeys returns the topology keys of the driver in the CSINode of the node like external-provisioner,
+// or Options.TopologyKeys if the node has no CSINode for the driver.
+func (p *Provisioner) topologyKeys(class *storagev1.StorageClass, node *v1.Node) []string {
+	csiNode, err := p.csiNodeLister.Get(node.Name)
+	if err != nil {
+		return p.opts.TopologyKeys
+	}
+	for _, driver := range csiNode.Spec.Drivers {
+		if driver.Name == class.Provisioner && len(driver.TopologyKeys) > 0 {
+			return driver.TopologyKeys
+		}
+	}
+	return p.opts.TopologyKeys
+}
+
+// volumeName returns the name of the volume provisioned for the claim, which is the same as external-provisioner.
+func volumeName(claim *v1.PersistentVolumeClaim) string {
+	return "pvc-" + string(claim.UID)
+}
@@ -0,0 +1,383 @@
+package pvcontroller
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+	pvutil "k8s.io/kubernetes/pkg/controller/volume/persistentvolume/util"
+)
+
+// resyncPeriod is the same as the default of kube-controller-manager's PV controller.
+// The claims waiting for volumes are retried at every resync.
+const resyncPeriod = 15 * time.Second
+
+// Controller is a stand-in of the PV controller of kube-controller-manager for the simulator.
+// It doesn't operate real volumes, but only does the API part of the PV controller:
+//   - marks the unbound volumes Available, and Released (or deletes them by the Delete reclaim policy) after their claims are deleted.
+//   - binds the claims with Immediate binding mode to the smallest matching volumes.
+//   - completes the binding of the claims with WaitForFirstConsumer binding mode to the volumes chosen by the VolumeBinding plugin of the scheduler,
+//     which sets the claimRef of the volumes in PreBind and waits until the claims are bound.
+type Controller struct {
+	client clientset.Interface
+
+	claimLister  corelisters.PersistentVolumeClaimLister
+	volumeLister corelisters.PersistentVolumeLister
+	classLister  storagelisters.StorageClassLister
+
+	claimQueue  workqueue.RateLimitingInterface
+	volumeQueue workqueue.RateLimitingInterface
+}
+
+// StartPersistentVolumeController starts Controller with its own informers, and returns the function to stop it.
+func StartPersistentVolumeController(client clientset.Interface) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	informerFactory := informers.NewSharedInformerFactory(client, resyncPeriod)
+	c := New(client, informerFactory)
+
+	informerFactory.Start(ctx.Done())
+	for typ, synced := range informerFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			cancel()
+			return nil, xerrors.Errorf("wait for cache sync of %v", typ)
+		}
+	}
+
+	go c.Run(ctx)
+
+	return cancel, nil
+}
+
+// New creates Controller and registers its event handlers to the informers.
+func New(client clientset.Interface, informerFactory informers.SharedInformerFactory) *Controller {
+	c := &Controller{
+		client:       client,
+		claimLister:  informerFactory.Core().V1().PersistentVolumeClaims().Lister(),
+		volumeLister: informerFactory.Core().V1().PersistentVolumes().Lister(),
+		classLister:  informerFactory.Storage().V1().StorageClasses().Lister(),
+		claimQueue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "claims"),
+		volumeQueue:  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "volumes"),
+	}
+
+	informerFactory.Core().V1().PersistentVolumeClaims().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueClaim,
+		UpdateFunc: func(_, newObj interface{}) { c.enqueueClaim(newObj) },
+		DeleteFunc: c.deleteClaim,
+	})
+	informerFactory.Core().V1().PersistentVolumes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.addVolume,
+		UpdateFunc: func(_, newObj interface{}) { c.updateVolume(newObj) },
+	})
+	// The informer of StorageClasses is used by the lister.
+	informerFactory.Storage().V1().StorageClasses().Informer()
+
+	return c
+}
+
+// Run runs the workers until ctx is done.
+func (c *Controller) Run(ctx context.Context) {
+	defer c.claimQueue.ShutDown()
+	defer c.volumeQueue.ShutDown()
+
+	klog.Info("pvcontroller: starting")
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for c.processNextItem(ctx, c.volumeQueue, c.syncVolume) {
+		}
+	}, time.Second)
+	go wait.UntilWithContext(ctx, func(ctx context.Context) {
+		for c.processNextItem(ctx, c.claimQueue, c.syncClaim) {
+		}
+	}, time.Second)
+
+	<-ctx.Done()
+	klog.Info("pvcontroller: shutting down")
+}
+
+// processNextItem syncs the next key in the queue. The key is retried with backoff if the sync fails.
+// It returns false if the queue is shut down.
+func (c *Controller) processNextItem(ctx context.Context, queue workqueue.RateLimitingInterface, sync func(ctx context.Context, key string) error) bool {
+	key, quit := queue.Get()
+	if quit {
+		return false
+	}
+	defer queue.Done(key)
+
+	if err := sync(ctx, key.(string)); err != nil {
+		klog.Warningf("pvcontroller: failed to sync %v, retrying: %v", key, err)
+		queue.AddRateLimited(key)
+		return true
+	}
+	queue.Forget(key)
+	return true
+}
+
+func (c *Controller) enqueueClaim(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		klog.Errorf("pvcontroller: failed to get key of claim: %v", err)
+		return
+	}
+	c.claimQueue.Add(key)
+}
+
+// deleteClaim syncs the volume bound to the deleted claim so that it is released.
+func (c *Controller) deleteClaim(obj interface{}) {
+	if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = d.Obj
+	}
+	claim, ok := obj.(*v1.PersistentVolumeClaim)
+	if !ok || claim.Spec.VolumeName == "" {
+		return
+	}
+	c.volumeQueue.Add(claim.Spec.VolumeName)
+}
+
+// addVolume syncs the new volume and the claims waiting for a volume, which may be bound to it.
+func (c *Controller) addVolume(obj interface{}) {
+	c.updateVolume(obj)
+
+	claims, err := c.claimLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("pvcontroller: failed to list claims: %v", err)
+		return
+	}
+	for _, claim := range claims {
+		if claim.Spec.VolumeName == "" {
+			c.enqueueClaim(claim)
+		}
+	}
+}
+
+// updateVolume syncs the volume and the claim which it is bound to.
+// The VolumeBinding plugin binds a volume to a claim by setting the claimRef of the volume, and the claim completes it.
+func (c *Controller) updateVolume(obj interface{}) {
+	volume, ok := obj.(*v1.PersistentVolume)
+	if !ok {
+		return
+	}
+	c.volumeQueue.Add(volume.Name)
+	if ref := volume.Spec.ClaimRef; ref != nil {
+		c.claimQueue.Add(ref.Namespace + "/" + ref.Name)
+	}
+}
+
+// syncClaim binds the claim to a volume, or checks the volume of the bound claim.
+func (c *Controller) syncClaim(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return xerrors.Errorf("split key %s: %w", key, err)
+	}
+	claim, err := c.claimLister.PersistentVolumeClaims(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("get claim %s: %w", key, err)
+	}
+	if claim.DeletionTimestamp != nil {
+		return nil
+	}
+
+	if metav1.HasAnnotation(claim.ObjectMeta, pvutil.AnnBindCompleted) {
+		return c.syncBoundClaim(ctx, claim)
+	}
+	return c.syncUnboundClaim(ctx, claim)
+}
+
+func (c *Controller) syncBoundClaim(ctx context.Context, claim *v1.PersistentVolumeClaim) error {
+	if claim.Spec.VolumeName == "" {
+		return c.updateClaimPhase(ctx, claim, v1.ClaimLost)
+	}
+	volume, err := c.volumeLister.Get(claim.Spec.VolumeName)
+	if apierrors.IsNotFound(err) {
+		return c.updateClaimPhase(ctx, claim, v1.ClaimLost)
+	}
+	if err != nil {
+		return xerrors.Errorf("get volume %s: %w", claim.Spec.VolumeName, err)
+	}
+	if volume.Spec.ClaimRef != nil && !pvutil.IsVolumeBoundToClaim(volume, claim) {
+		// the volume is bound to another claim.
+		return c.updateClaimPhase(ctx, claim, v1.ClaimLost)
+	}
+	return c.bind(ctx, volume, claim)
+}
+
+func (c *Controller) syncUnboundClaim(ctx context.Context, claim *v1.PersistentVolumeClaim) error {
+	if claim.Spec.VolumeName != "" {
+		// the claim is pre-bound to the volume by the user.
+		volume, err := c.volumeLister.Get(claim.Spec.VolumeName)
+		if apierrors.IsNotFound(err) {
+			return c.updateClaimPhase(ctx, claim, v1.ClaimPending)
+		}
+		if err != nil {
+			return xerrors.Errorf("get volume %s: %w", claim.Spec.VolumeName, err)
+		}
+		if volume.Spec.ClaimRef != nil && !pvutil.IsVolumeBoundToClaim(volume, claim) {
+			return c.updateClaimPhase(ctx, claim, v1.ClaimPending)
+		}
+		return c.bind(ctx, volume, claim)
+	}
+
+	delayBinding, err := pvutil.IsDelayBindingMode(claim, c.classLister)
+	if err != nil {
+		return xerrors.Errorf("get binding mode of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+	volumes, err := c.volumeLister.List(labels.Everything())
+	if err != nil {
+		return xerrors.Errorf("list volumes: %w", err)
+	}
+	// With delayBinding, only the volume chosen by the scheduler (i.e. whose claimRef is the claim) is returned.
+	volume, err := pvutil.FindMatchingVolume(claim, volumes, nil, nil, delayBinding)
+	if err != nil {
+		return xerrors.Errorf("find volume for claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+	if volume == nil {
+		// wait for the scheduler, or for a matching volume to be created.
+		return c.updateClaimPhase(ctx, claim, v1.ClaimPending)
+	}
+	return c.bind(ctx, volume, claim)
+}
+
+// bind binds the volume and the claim to each other, and updates their status to Bound.
+func (c *Controller) bind(ctx context.Context, volume *v1.PersistentVolume, claim *v1.PersistentVolumeClaim) error {
+	newVolume, dirty, err := pvutil.GetBindVolumeToClaim(volume, claim)
+	if err != nil {
+		return xerrors.Errorf("bind volume %s: %w", volume.Name, err)
+	}
+	if dirty {
+		newVolume, err = c.client.CoreV1().PersistentVolumes().Update(ctx, newVolume, metav1.UpdateOptions{})
+		if err != nil {
+			return xerrors.Errorf("update volume %s: %w", volume.Name, err)
+		}
+	}
+	volume = newVolume
+	if err := c.updateVolumePhase(ctx, volume, v1.VolumeBound); err != nil {
+		return err
+	}
+
+	newClaim := claim.DeepCopy()
+	dirty = false
+	if newClaim.Spec.VolumeName != volume.Name {
+		newClaim.Spec.VolumeName = volume.Name
+		metav1.SetMetaDataAnnotation(&newClaim.ObjectMeta, pvutil.AnnBoundByController, "yes")
+		dirty = true
+	}
+	if !metav1.HasAnnotation(newClaim.ObjectMeta, pvutil.AnnBindCompleted) {
+		metav1.SetMetaDataAnnotation(&newClaim.ObjectMeta, pvutil.AnnBindCompleted, "yes")
+		dirty = true
+	}
+	if dirty {
+		newClaim, err = c.client.CoreV1().PersistentVolumeClaims(claim.Namespace).Update(ctx, newClaim, metav1.UpdateOptions{})
+		if err != nil {
+			return xerrors.Errorf("update claim %s/%s: %w", claim.Namespace, claim.Name, err)
+		}
+	}
+	claim = newClaim
+
+	if claim.Status.Phase == v1.ClaimBound {
+		return nil
+	}
+	claim = claim.DeepCopy()
+	claim.Status.Phase = v1.ClaimBound
+	claim.Status.AccessModes = volume.Spec.AccessModes
+	claim.Status.Capacity = volume.Spec.Capacity
+	if _, err := c.client.CoreV1().PersistentVolumeClaims(claim.Namespace).UpdateStatus(ctx, claim, metav1.UpdateOptions{}); err != nil {
+		return xerrors.Errorf("update status of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+	klog.Infof("pvcontroller: bound claim %s/%s to volume %s", claim.Namespace, claim.Name, volume.Name)
+	return nil
+}
+
+// syncVolume updates the phase of the volume which is not bound, or reclaims the volume whose claim is deleted.
+func (c *Controller) syncVolume(ctx context.Context, name string) error {
+	volume, err := c.volumeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("get volume %s: %w", name, err)
+	}
+	if volume.DeletionTimestamp != nil {
+		return nil
+	}
+
+	ref := volume.Spec.ClaimRef
+	if ref == nil {
+		return c.updateVolumePhase(ctx, volume, v1.VolumeAvailable)
+	}
+	claim, err := c.claimLister.PersistentVolumeClaims(ref.Namespace).Get(ref.Name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return xerrors.Errorf("get claim %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+	notFound := apierrors.IsNotFound(err)
+	if notFound && ref.UID == "" {
+		// the volume is pre-bound to the claim which is not created yet.
+		return c.updateVolumePhase(ctx, volume, v1.VolumeAvailable)
+	}
+	if notFound || (ref.UID != "" && claim.UID != ref.UID) {
+		// the informer cache may lag behind API server (e.g. the claim has just been created), so the claim is
+		// checked against API server before the volume is reclaimed, like kube-controller-manager does.
+		claim, err = c.client.CoreV1().PersistentVolumeClaims(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return xerrors.Errorf("get claim %s/%s: %w", ref.Namespace, ref.Name, err)
+		}
+		if apierrors.IsNotFound(err) || claim.UID != ref.UID {
+			// the claim is deleted (or deleted and created again).
+			return c.reclaimVolume(ctx, volume)
+		}
+	}
+	// the claim completes the binding.
+	return nil
+}
+
+// reclaimVolume deletes the volume if its reclaim policy is Delete. Otherwise, it marks the volume Released.
+func (c *Controller) reclaimVolume(ctx context.Context, volume *v1.PersistentVolume) error {
+	if volume.Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimDelete {
+		return c.updateVolumePhase(ctx, volume, v1.VolumeReleased)
+	}
+
+	err := c.client.CoreV1().PersistentVolumes().Delete(ctx, volume.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return xerrors.Errorf("delete volume %s: %w", volume.Name, err)
+	}
+	klog.Infof("pvcontroller: deleted volume %s released from claim %s/%s", volume.Name, volume.Spec.ClaimRef.Namespace, volume.Spec.ClaimRef.Name)
+	return nil
+}
+
+func (c *Controller) updateVolumePhase(ctx context.Context, volume *v1.PersistentVolume, phase v1.PersistentVolumePhase) error {
+	if volume.Status.Phase == phase {
+		return nil
+	}
+	volume = volume.DeepCopy()
+	volume.Status.Phase = phase
+	volume.Status.Message = ""
+	if _, err := c.client.CoreV1().PersistentVolumes().UpdateStatus(ctx, volume, metav1.UpdateOptions{}); err != nil {
+		return xerrors.Errorf("update status of volume %s: %w", volume.Name, err)
+	}
+	return nil
+}
+
+func (c *Controller) updateClaimPhase(ctx context.Context, claim *v1.PersistentVolumeClaim, phase v1.PersistentVolumeClaimPhase) error {
+	if claim.Status.Phase == phase {
+		return nil
+	}
+	claim = claim.DeepCopy()
+	claim.Status.Phase = phase
+	if _, err := c.client.CoreV1().PersistentVolumeClaims(claim.Namespace).UpdateStatus(ctx, claim, metav1.UpdateOptions{}); err != nil {
+		return xerrors.Errorf("update status of claim %s/%s: %w", claim.Namespace, claim.Name, err)
+	}
+	return nil
+}
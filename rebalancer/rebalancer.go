@@ -0,0 +1,334 @@
+package rebalancer
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	clientset "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	policylisters "k8s.io/client-go/listers/policy/v1"
+	"k8s.io/klog"
+	"k8s.io/kubernetes/pkg/apis/scheduling"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// Options is the options of Rebalancer.
+type Options struct {
+	// Interval is the interval of the rebalancing runs.
+	Interval time.Duration
+	// Threshold is how much the best other node must score higher than the current node of a pod to evict the pod.
+	// The scores are the sums of the weighted scores of the score plugins.
+	Threshold int64
+	// MaxEvictionsPerRun is the maximum number of the pods evicted in a run. 0 means no limit.
+	MaxEvictionsPerRun int
+}
+
+// DefaultOptions returns the default options.
+func DefaultOptions() Options {
+	return Options{
+		Interval:           time.Minute,
+		Threshold:          50,
+		MaxEvictionsPerRun: 10,
+	}
+}
+
+// Scheduler runs the plugins of the scheduler to score the nodes for the pods on them.
+// It's implemented by scheduler.Service.
+type Scheduler interface {
+	// ScoreAssignedPod returns the scores of the nodes which pass the filter plugins for the pod on a node,
+	// as if the pod were scheduled again.
+	ScoreAssignedPod(ctx context.Context, pod *v1.Pod) (framework.NodeScoreList, *framework.Status)
+}
+
+// Rebalancer is a descheduler-style component for the simulator, which evaluates whether the placements by the score
+// plugins stay stable as the cluster changes. At every interval, it scores the nodes for each pod on a node by the
+// filter and the score plugins of the scheduler as if the pod were scheduled again, and evicts (deletes) the pod if
+// another node scores higher than the current node by the threshold, so that the owner of the pod creates a new one
+// and the scheduler places it. Like descheduler, it only evicts the pods owned by a controller except DaemonSets,
+// and not the system critical pods.
+//
+// The PodDisruptionBudgets are respected by computing the allowed disruptions from the pods, as the disruption
+// controller doesn't run in the simulator. Since the scores are computed before the evicted pods are scheduled again,
+// at most one pod is evicted from or toward each node in a run.
+type Rebalancer struct {
+	client clientset.Interface
+	opts   Options
+	sched  Scheduler
+
+	podLister corelisters.PodLister
+	pdbLister policylisters.PodDisruptionBudgetLister
+}
+
+// StartRebalancer starts Rebalancer with its own informers, and returns the function to stop it.
+func StartRebalancer(client clientset.Interface, sched Scheduler, opts Options) (func(), error) {
+	if opts.Interval <= 0 {
+		return nil, xerrors.Errorf("rebalance interval must be positive: %v", opts.Interval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	r := New(client, informerFactory, sched, opts)
+
+	informerFactory.Start(ctx.Done())
+	for typ, synced := range informerFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			cancel()
+			return nil, xerrors.Errorf("wait for cache sync of %v", typ)
+		}
+	}
+
+	go r.Run(ctx)
+
+	return cancel, nil
+}
+
+// New creates Rebalancer with the listers of the informers.
+func New(client clientset.Interface, informerFactory informers.SharedInformerFactory, sched Scheduler, opts Options) *Rebalancer {
+	return &Rebalancer{
+		client:    client,
+		opts:      opts,
+		sched:     sched,
+		podLister: informerFactory.Core().V1().Pods().Lister(),
+		pdbLister: informerFactory.Policy().V1().PodDisruptionBudgets().Lister(),
+	}
+}
+
+// Run rebalances the pods at every interval until ctx is done.
+func (r *Rebalancer) Run(ctx context.Context) {
+	klog.Info("rebalancer: starting")
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		evicted, err := r.RunOnce(ctx)
+		if err != nil {
+			klog.Errorf("rebalancer: failed to rebalance: %v", err)
+		}
+		if evicted > 0 {
+			klog.Infof("rebalancer: evicted %d pods", evicted)
+		}
+	}, r.opts.Interval)
+	klog.Info("rebalancer: shutting down")
+}
+
+// RunOnce scores the nodes for the pods on them and evicts the pods which another node fits better.
+// It returns the number of the evicted pods.
+func (r *Rebalancer) RunOnce(ctx context.Context) (int, error) {
+	pods, err := r.podLister.List(labels.Everything())
+	if err != nil {
+		return 0, xerrors.Errorf("list pods: %w", err)
+	}
+	pdbs, err := r.pdbLister.List(labels.Everything())
+	if err != nil {
+		return 0, xerrors.Errorf("list pod disruption budgets: %w", err)
+	}
+	budgets, err := disruptionBudgets(pdbs, pods)
+	if err != nil {
+		return 0, err
+	}
+
+	candidates := make([]*v1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if evictable(pod) {
+			candidates = append(candidates, pod)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Namespace != candidates[j].Namespace {
+			return candidates[i].Namespace < candidates[j].Namespace
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+
+	evicted := 0
+	// touched are the nodes which a pod is evicted from or expected to move to in this run.
+	touched := map[string]bool{}
+	for _, pod := range candidates {
+		if r.opts.MaxEvictionsPerRun > 0 && evicted >= r.opts.MaxEvictionsPerRun {
+			break
+		}
+		if touched[pod.Spec.NodeName] {
+			continue
+		}
+
+		scores, status := r.sched.ScoreAssignedPod(ctx, pod)
+		if status.IsUnschedulable() {
+			klog.V(2).Infof("rebalancer: no node fits pod %s/%s: %s", pod.Namespace, pod.Name, status.Message())
+			continue
+		}
+		if !status.IsSuccess() {
+			return evicted, xerrors.Errorf("score nodes for pod %s/%s: %w", pod.Namespace, pod.Name, status.AsError())
+		}
+
+		current, best, ok := compareScores(scores, pod.Spec.NodeName)
+		if !ok {
+			// e.g. the node is tainted with NoSchedule. It's up to the other components (e.g. the node lifecycle
+			// controller) to evict the pod.
+			klog.V(2).Infof("rebalancer: node %s of pod %s/%s doesn't pass the filter plugins", pod.Spec.NodeName, pod.Namespace, pod.Name)
+			continue
+		}
+		if best.Name == "" || best.Score-current < r.opts.Threshold || touched[best.Name] {
+			continue
+		}
+
+		matched := matchingBudgets(budgets, pod)
+		if blocking := blockingBudget(matched); blocking != nil {
+			klog.Infof("rebalancer: pod %s/%s is not evicted by pod disruption budget %s", pod.Namespace, pod.Name, blocking.pdb.Name)
+			continue
+		}
+
+		if err := r.evict(ctx, pod); err != nil {
+			return evicted, err
+		}
+		klog.Infof("rebalancer: evicted pod %s/%s from node %s (score %d), node %s scores %d", pod.Namespace, pod.Name, pod.Spec.NodeName, current, best.Name, best.Score)
+		for _, b := range matched {
+			b.allowed--
+		}
+		touched[pod.Spec.NodeName] = true
+		touched[best.Name] = true
+		evicted++
+	}
+	return evicted, nil
+}
+
+// compareScores returns the score of the current node and the best of the other nodes.
+// ok is false if the current node isn't in the scores.
+func compareScores(scores framework.NodeScoreList, currentNode string) (current int64, best framework.NodeScore, ok bool) {
+	for _, s := range scores {
+		if s.Name == currentNode {
+			current = s.Score
+			ok = true
+			continue
+		}
+		if best.Name == "" || s.Score > best.Score {
+			best = s
+		}
+	}
+	return current, best, ok
+}
+
+// evictable returns whether the pod on a node can be evicted to be placed again:
+// it's owned by a controller other than DaemonSet, which creates a new pod, and it's not system critical.
+func evictable(pod *v1.Pod) bool {
+	if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil || terminated(pod) {
+		return false
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind == "DaemonSet" {
+		return false
+	}
+	return pod.Spec.Priority == nil || *pod.Spec.Priority < scheduling.SystemCriticalPriority
+}
+
+func (r *Rebalancer) evict(ctx context.Context, pod *v1.Pod) error {
+	err := r.client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+		Preconditions: metav1.NewUIDPreconditions(string(pod.UID)),
+	})
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		return xerrors.Errorf("delete pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	return nil
+}
+
+// budget is the disruptions which a PodDisruptionBudget allows in a run.
+type budget struct {
+	pdb      *policyv1.PodDisruptionBudget
+	selector labels.Selector
+	allowed  int
+}
+
+// disruptionBudgets computes the allowed disruptions of the PodDisruptionBudgets from the pods like the disruption
+// controller. The expected number of the pods is the number of the matching pods which are neither terminated
+// nor being deleted, instead of the scale of their controller.
+func disruptionBudgets(pdbs []*policyv1.PodDisruptionBudget, pods []*v1.Pod) ([]*budget, error) {
+	budgets := make([]*budget, 0, len(pdbs))
+	for _, pdb := range pdbs {
+		// a nil selector matches no pods in policy/v1.
+		if pdb.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			return nil, xerrors.Errorf("parse selector of pod disruption budget %s/%s: %w", pdb.Namespace, pdb.Name, err)
+		}
+
+		expected, healthy := 0, 0
+		for _, pod := range pods {
+			if pod.Namespace != pdb.Namespace || terminated(pod) || pod.DeletionTimestamp != nil || !selector.Matches(labels.Set(pod.Labels)) {
+				continue
+			}
+			expected++
+			if isHealthy(pod) {
+				healthy++
+			}
+		}
+
+		desiredHealthy := 0
+		switch {
+		case pdb.Spec.MinAvailable != nil:
+			desiredHealthy, err = intstr.GetScaledValueFromIntOrPercent(pdb.Spec.MinAvailable, expected, true)
+		case pdb.Spec.MaxUnavailable != nil:
+			var maxUnavailable int
+			maxUnavailable, err = intstr.GetScaledValueFromIntOrPercent(pdb.Spec.MaxUnavailable, expected, true)
+			desiredHealthy = expected - maxUnavailable
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("compute disruptions allowed by pod disruption budget %s/%s: %w", pdb.Namespace, pdb.Name, err)
+		}
+
+		allowed := healthy - desiredHealthy
+		if allowed < 0 {
+			allowed = 0
+		}
+		budgets = append(budgets, &budget{pdb: pdb, selector: selector, allowed: allowed})
+	}
+	return budgets, nil
+}
+
+// matchingBudgets returns the budgets of the PodDisruptionBudgets which select the pod.
+func matchingBudgets(budgets []*budget, pod *v1.Pod) []*budget {
+	var matched []*budget
+	for _, b := range budgets {
+		if b.pdb.Namespace == pod.Namespace && b.selector.Matches(labels.Set(pod.Labels)) {
+			matched = append(matched, b)
+		}
+	}
+	return matched
+}
+
+// blockingBudget returns the first budget which allows no more disruptions, or nil if all of them allow one.
+func blockingBudget(budgets []*budget) *budget {
+	for _, b := range budgets {
+		if b.allowed <= 0 {
+			return b
+		}
+	}
+	return nil
+}
+
+// isHealthy returns whether the pod counts as healthy for the PodDisruptionBudgets. The pods with the Ready condition
+// are healthy if it's True, and the pods with no Ready condition (i.e. no kubelet has run them) are healthy
+// once they are bound.
+func isHealthy(pod *v1.Pod) bool {
+	if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return true
+}
+
+func terminated(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
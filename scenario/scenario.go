@@ -0,0 +1,365 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/xerrors"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/yaml"
+
+	"github.com/nakamasato/mini-kube-scheduler/nodelifecycle"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Scenario is a list of steps which create storage, nodes, pods and workloads in order.
+// After all steps are done, it waits until all the created pods and the pods of the created workloads
+// are bound to nodes or Timeout passes. The workloads need the workload controllers of the simulator (--controllers).
+type Scenario struct {
+	// Timeout is the time to wait for all pods to be bound. Defaults to 10s.
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	Steps   []Step          `json:"steps"`
+}
+
+// Step creates StorageClasses, PersistentVolumes, PersistentVolumeClaims and Nodes, sets the readiness of nodes,
+// creates Pods and then the workloads (ReplicaSets, Deployments, Jobs and DaemonSets), and waits for Wait.
+type Step struct {
+	Name                   string                         `json:"name,omitempty"`
+	StorageClasses         []storagev1.StorageClass       `json:"storageClasses,omitempty"`
+	PersistentVolumes      []v1.PersistentVolume          `json:"persistentVolumes,omitempty"`
+	PersistentVolumeClaims []v1.PersistentVolumeClaim     `json:"persistentVolumeClaims,omitempty"`
+	Nodes                  []v1.Node                      `json:"nodes,omitempty"`
+	NodeReadiness          []NodeReadiness                `json:"nodeReadiness,omitempty"`
+	PodDisruptionBudgets   []policyv1.PodDisruptionBudget `json:"podDisruptionBudgets,omitempty"`
+	Pods                   []v1.Pod                       `json:"pods,omitempty"`
+	ReplicaSets            []appsv1.ReplicaSet            `json:"replicaSets,omitempty"`
+	Deployments            []appsv1.Deployment            `json:"deployments,omitempty"`
+	Jobs                   []batchv1.Job                  `json:"jobs,omitempty"`
+	DaemonSets             []appsv1.DaemonSet             `json:"daemonSets,omitempty"`
+	// Wait is the time to wait after the step, e.g. for the pods to be evicted from the failed nodes.
+	Wait metav1.Duration `json:"wait,omitempty"`
+}
+
+// NodeReadiness sets the status of the Ready condition of a node to simulate its failure or recovery:
+// "False" for NotReady, "Unknown" for Unreachable, and "True" for Ready.
+// The node lifecycle controller of the simulator (--node-lifecycle) taints the node and evicts the pods on it.
+type NodeReadiness struct {
+	Node   string             `json:"node"`
+	Status v1.ConditionStatus `json:"status"`
+}
+
+// Load reads a Scenario from a YAML or JSON file.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read scenario file: %w", err)
+	}
+
+	s := &Scenario{}
+	if err := yaml.UnmarshalStrict(data, s); err != nil {
+		return nil, xerrors.Errorf("decode scenario file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Run creates the resources in the scenario and waits until the created pods and the pods of the workloads are bound.
+// clk is the clock for the waits of the steps, e.g. the virtual clock of the scheduler.
+func Run(ctx context.Context, client clientset.Interface, s *Scenario, clk clock.Clock) error {
+	var pods []*v1.Pod
+	var workloads []workload
+	for i, step := range s.Steps {
+		for _, sc := range step.StorageClasses {
+			sc := sc
+			_, err := client.StorageV1().StorageClasses().Create(ctx, &sc, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create storage class: %w", err)
+			}
+			klog.Infof("scenario: created storage class: %s", sc.Name)
+		}
+
+		for _, pv := range step.PersistentVolumes {
+			pv := pv
+			_, err := client.CoreV1().PersistentVolumes().Create(ctx, &pv, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create persistent volume: %w", err)
+			}
+			klog.Infof("scenario: created persistent volume: %s", pv.Name)
+		}
+
+		for _, pvc := range step.PersistentVolumeClaims {
+			pvc := pvc
+			if pvc.Namespace == "" {
+				pvc.Namespace = metav1.NamespaceDefault
+			}
+			_, err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(ctx, &pvc, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create persistent volume claim: %w", err)
+			}
+			klog.Infof("scenario: created persistent volume claim: %s", pvc.Name)
+		}
+
+		for _, n := range step.Nodes {
+			n := n
+			_, err := client.CoreV1().Nodes().Create(ctx, &n, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create node: %w", err)
+			}
+			klog.Infof("scenario: created node: %s", n.Name)
+		}
+
+		for _, r := range step.NodeReadiness {
+			if err := nodelifecycle.SetNodeReady(ctx, client, r.Node, r.Status); err != nil {
+				return fmt.Errorf("set readiness of node: %w", err)
+			}
+			klog.Infof("scenario: set Ready condition of node %s to %s", r.Node, r.Status)
+		}
+
+		for _, pdb := range step.PodDisruptionBudgets {
+			pdb := pdb
+			if pdb.Namespace == "" {
+				pdb.Namespace = metav1.NamespaceDefault
+			}
+			_, err := client.PolicyV1().PodDisruptionBudgets(pdb.Namespace).Create(ctx, &pdb, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create pod disruption budget: %w", err)
+			}
+			klog.Infof("scenario: created pod disruption budget: %s", pdb.Name)
+		}
+
+		for _, p := range step.Pods {
+			p := p
+			if p.Namespace == "" {
+				p.Namespace = metav1.NamespaceDefault
+			}
+			created, err := client.CoreV1().Pods(p.Namespace).Create(ctx, &p, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create pod: %w", err)
+			}
+			pods = append(pods, created)
+			klog.Infof("scenario: created pod: %s", p.Name)
+		}
+
+		for _, rs := range step.ReplicaSets {
+			rs := rs
+			if rs.Namespace == "" {
+				rs.Namespace = metav1.NamespaceDefault
+			}
+			_, err := client.AppsV1().ReplicaSets(rs.Namespace).Create(ctx, &rs, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create replica set: %w", err)
+			}
+			workloads = append(workloads, workload{kind: "ReplicaSet", namespace: rs.Namespace, name: rs.Name})
+			klog.Infof("scenario: created replica set: %s", rs.Name)
+		}
+
+		for _, d := range step.Deployments {
+			d := d
+			if d.Namespace == "" {
+				d.Namespace = metav1.NamespaceDefault
+			}
+			_, err := client.AppsV1().Deployments(d.Namespace).Create(ctx, &d, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create deployment: %w", err)
+			}
+			workloads = append(workloads, workload{kind: "Deployment", namespace: d.Namespace, name: d.Name})
+			klog.Infof("scenario: created deployment: %s", d.Name)
+		}
+
+		for _, j := range step.Jobs {
+			j := j
+			if j.Namespace == "" {
+				j.Namespace = metav1.NamespaceDefault
+			}
+			_, err := client.BatchV1().Jobs(j.Namespace).Create(ctx, &j, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create job: %w", err)
+			}
+			workloads = append(workloads, workload{kind: "Job", namespace: j.Namespace, name: j.Name})
+			klog.Infof("scenario: created job: %s", j.Name)
+		}
+
+		for _, ds := range step.DaemonSets {
+			ds := ds
+			if ds.Namespace == "" {
+				ds.Namespace = metav1.NamespaceDefault
+			}
+			_, err := client.AppsV1().DaemonSets(ds.Namespace).Create(ctx, &ds, metav1.CreateOptions{})
+			if err != nil {
+				return fmt.Errorf("create daemon set: %w", err)
+			}
+			workloads = append(workloads, workload{kind: "DaemonSet", namespace: ds.Namespace, name: ds.Name})
+			klog.Infof("scenario: created daemon set: %s", ds.Name)
+		}
+
+		klog.Infof("scenario: step %d (%s) done", i, step.Name)
+
+		if step.Wait.Duration > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-clk.After(step.Wait.Duration):
+			}
+		}
+	}
+
+	return waitForPodsBound(ctx, client, pods, workloads, timeout(s))
+}
+
+func timeout(s *Scenario) time.Duration {
+	if s.Timeout.Duration == 0 {
+		return defaultTimeout
+	}
+	return s.Timeout.Duration
+}
+
+// waitForPodsBound checks the pods and the workloads every second until all of them are bound.
+// It doesn't return error on timeout, but just logs the pods and the workloads which are not bound yet.
+func waitForPodsBound(ctx context.Context, client clientset.Interface, pods []*v1.Pod, workloads []workload, timeout time.Duration) error {
+	scheduled := make(map[string]bool, len(pods)+len(workloads))
+	timer := time.After(timeout)
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		if len(scheduled) == len(pods)+len(workloads) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer:
+			for _, p := range pods {
+				klog.Infof("scenario: Timeout %s: %t", p.Name, scheduled[podKey(p)])
+			}
+			for _, w := range workloads {
+				klog.Infof("scenario: Timeout %s: %t", w, scheduled[w.String()])
+			}
+			return nil
+		case <-ticker.C:
+			for _, p := range pods {
+				if scheduled[podKey(p)] {
+					continue
+				}
+				pod, err := client.CoreV1().Pods(p.Namespace).Get(ctx, p.Name, metav1.GetOptions{})
+				if apierrors.IsNotFound(err) {
+					// e.g. evicted by the node lifecycle controller.
+					klog.Info("scenario: " + p.Name + " is deleted")
+					scheduled[podKey(p)] = true
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("get pod: %w", err)
+				}
+				if pod.Spec.NodeName != "" {
+					klog.Info("scenario: " + pod.Name + " is bound to " + pod.Spec.NodeName)
+					scheduled[podKey(p)] = true
+				}
+			}
+			for _, w := range workloads {
+				if scheduled[w.String()] {
+					continue
+				}
+				bound, err := w.bound(ctx, client)
+				if err != nil {
+					return err
+				}
+				if bound {
+					klog.Infof("scenario: the pods of %s are bound", w)
+					scheduled[w.String()] = true
+				}
+			}
+		}
+	}
+}
+
+// workload is a ReplicaSet, Deployment, Job or DaemonSet created by the scenario.
+type workload struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (w workload) String() string {
+	return w.kind + " " + w.namespace + "/" + w.name
+}
+
+// bound returns true if the workload has as many bound pods as it wants:
+// the replicas of ReplicaSets and Deployments, the parallelism of Jobs (up to the completions),
+// and the nodes which should run the pods of DaemonSets.
+func (w workload) bound(ctx context.Context, client clientset.Interface) (bool, error) {
+	var selector *metav1.LabelSelector
+	var want int32
+	switch w.kind {
+	case "ReplicaSet":
+		rs, err := client.AppsV1().ReplicaSets(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("get replica set: %w", err)
+		}
+		selector, want = rs.Spec.Selector, int32Value(rs.Spec.Replicas, 1)
+	case "Deployment":
+		d, err := client.AppsV1().Deployments(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("get deployment: %w", err)
+		}
+		selector, want = d.Spec.Selector, int32Value(d.Spec.Replicas, 1)
+	case "Job":
+		j, err := client.BatchV1().Jobs(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("get job: %w", err)
+		}
+		selector, want = j.Spec.Selector, int32Value(j.Spec.Parallelism, 1)
+		if j.Spec.Completions != nil && *j.Spec.Completions < want {
+			want = *j.Spec.Completions
+		}
+	case "DaemonSet":
+		ds, err := client.AppsV1().DaemonSets(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("get daemon set: %w", err)
+		}
+		// The desired number is unknown until the controller observes the daemon set.
+		if ds.Status.ObservedGeneration < ds.Generation {
+			return false, nil
+		}
+		selector, want = ds.Spec.Selector, ds.Status.DesiredNumberScheduled
+	default:
+		return false, fmt.Errorf("unknown workload kind %s", w.kind)
+	}
+
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, fmt.Errorf("convert selector of %s: %w", w, err)
+	}
+	pods, err := client.CoreV1().Pods(w.namespace).List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return false, fmt.Errorf("list pods of %s: %w", w, err)
+	}
+	var bound int32
+	for _, p := range pods.Items {
+		if p.DeletionTimestamp == nil && p.Spec.NodeName != "" {
+			bound++
+		}
+	}
+	return bound >= want, nil
+}
+
+func int32Value(p *int32, def int32) int32 {
+	if p == nil {
+		return def
+	}
+	return *p
+}
+
+func podKey(p *v1.Pod) string {
+	return p.Namespace + "/" + p.Name
+}
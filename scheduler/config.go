@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"os"
+
+	"golang.org/x/xerrors"
+	v1beta2config "k8s.io/kube-scheduler/config/v1beta2"
+	configscheme "k8s.io/kubernetes/pkg/scheduler/apis/config/scheme"
+)
+
+// LoadSchedulerConfig reads KubeSchedulerConfiguration (kubescheduler.config.k8s.io/v1beta2) from the file.
+func LoadSchedulerConfig(path string) (*v1beta2config.KubeSchedulerConfiguration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read scheduler config file: %w", err)
+	}
+
+	obj, gvk, err := configscheme.Codecs.UniversalDeserializer().Decode(data, nil, &v1beta2config.KubeSchedulerConfiguration{})
+	if err != nil {
+		return nil, xerrors.Errorf("decode scheduler config file %s: %w", path, err)
+	}
+	cfg, ok := obj.(*v1beta2config.KubeSchedulerConfiguration)
+	if !ok {
+		return nil, xerrors.Errorf("unsupported scheduler config %s in %s: only v1beta2 is supported", gvk, path)
+	}
+	// Defaulting merges the plugins of each profile into the default plugins of kube-scheduler and drops the
+	// disabled ones. They are kept so that the default plugins of minisched can be disabled too.
+	disabled := make([]*v1beta2config.Plugins, len(cfg.Profiles))
+	for i := range cfg.Profiles {
+		disabled[i] = cfg.Profiles[i].Plugins.DeepCopy()
+	}
+	configscheme.Scheme.Default(cfg)
+	for i := range cfg.Profiles {
+		restoreDisabledPlugins(cfg.Profiles[i].Plugins, disabled[i])
+	}
+
+	return cfg, nil
+}
+
+// restoreDisabledPlugins sets the disabled plugins of each extension point in custom to defaulted.
+func restoreDisabledPlugins(defaulted, custom *v1beta2config.Plugins) {
+	if defaulted == nil || custom == nil {
+		return
+	}
+	defaulted.QueueSort.Disabled = custom.QueueSort.Disabled
+	defaulted.PreFilter.Disabled = custom.PreFilter.Disabled
+	defaulted.Filter.Disabled = custom.Filter.Disabled
+	defaulted.PostFilter.Disabled = custom.PostFilter.Disabled
+	defaulted.PreScore.Disabled = custom.PreScore.Disabled
+	defaulted.Score.Disabled = custom.Score.Disabled
+	defaulted.Reserve.Disabled = custom.Reserve.Disabled
+	defaulted.Permit.Disabled = custom.Permit.Disabled
+	defaulted.PreBind.Disabled = custom.PreBind.Disabled
+	defaulted.Bind.Disabled = custom.Bind.Disabled
+	defaulted.PostBind.Disabled = custom.PostBind.Disabled
+}
@@ -3,37 +3,52 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/nakamasato/mini-kube-scheduler/minisched"
 
 	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
 	clientset "k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/events"
 	"k8s.io/klog"
 	v1beta2config "k8s.io/kube-scheduler/config/v1beta2"
 	"k8s.io/kubernetes/pkg/scheduler"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
 )
 
 // Service manages scheduler.
 type Service struct {
+	clientset     clientset.Interface
+	restclientCfg *restclient.Config
+	// schedOpts are passed to minisched.New every time the scheduler starts.
+	schedOpts []minisched.Option
+
+	// restartMu serializes starting and shutting down scheduler, so that only one scheduler runs
+	// even if it's restarted concurrently, e.g. by imports of snapshots.
+	restartMu sync.Mutex
+	// mu protects shutdownfn, currentSchedulerCfg and sched.
+	mu sync.RWMutex
 	// function to shutdown scheduler.
-	shutdownfn func()
-
-	clientset           clientset.Interface
-	restclientCfg       *restclient.Config
+	shutdownfn          func()
 	currentSchedulerCfg *v1beta2config.KubeSchedulerConfiguration
+	// sched is the running scheduler, or nil if it's not running.
+	sched *minisched.Scheduler
 }
 
 // NewSchedulerService starts scheduler and return *Service.
-func NewSchedulerService(client clientset.Interface, restclientCfg *restclient.Config) *Service {
-	return &Service{clientset: client, restclientCfg: restclientCfg}
+func NewSchedulerService(client clientset.Interface, restclientCfg *restclient.Config, schedOpts ...minisched.Option) *Service {
+	return &Service{clientset: client, restclientCfg: restclientCfg, schedOpts: schedOpts}
 }
 
 func (s *Service) RestartScheduler(cfg *v1beta2config.KubeSchedulerConfiguration) error {
-	s.ShutdownScheduler()
+	s.restartMu.Lock()
+	defer s.restartMu.Unlock()
+
+	s.shutdownScheduler()
 
-	if err := s.StartScheduler(cfg); err != nil {
+	if err := s.startScheduler(cfg); err != nil {
 		return xerrors.Errorf("start scheduler: %w", err)
 	}
 	return nil
@@ -41,6 +56,13 @@ func (s *Service) RestartScheduler(cfg *v1beta2config.KubeSchedulerConfiguration
 
 // StartScheduler starts scheduler.
 func (s *Service) StartScheduler(versionedcfg *v1beta2config.KubeSchedulerConfiguration) error {
+	s.restartMu.Lock()
+	defer s.restartMu.Unlock()
+
+	return s.startScheduler(versionedcfg)
+}
+
+func (s *Service) startScheduler(versionedcfg *v1beta2config.KubeSchedulerConfiguration) error {
 	clientSet := s.clientset
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -51,11 +73,12 @@ func (s *Service) StartScheduler(versionedcfg *v1beta2config.KubeSchedulerConfig
 
 	evtBroadcaster.StartRecordingToSink(ctx.Done())
 
-	s.currentSchedulerCfg = versionedcfg.DeepCopy()
-
+	opts := append([]minisched.Option{}, s.schedOpts...)
+	opts = append(opts, ProfileOptions(versionedcfg)...)
 	sched, err := minisched.New(
 		clientSet,
 		informerFactory,
+		opts...,
 	)
 
 	if err != nil {
@@ -68,18 +91,107 @@ func (s *Service) StartScheduler(versionedcfg *v1beta2config.KubeSchedulerConfig
 
 	go sched.Run(ctx)
 
+	s.mu.Lock()
 	s.shutdownfn = cancel
+	s.currentSchedulerCfg = versionedcfg.DeepCopy()
+	s.sched = sched
+	s.mu.Unlock()
 
 	return nil
 }
 
 func (s *Service) ShutdownScheduler() {
-	if s.shutdownfn != nil {
+	s.restartMu.Lock()
+	defer s.restartMu.Unlock()
+
+	s.shutdownScheduler()
+}
+
+func (s *Service) shutdownScheduler() {
+	s.mu.Lock()
+	shutdownfn := s.shutdownfn
+	s.shutdownfn = nil
+	s.sched = nil
+	s.mu.Unlock()
+
+	if shutdownfn != nil {
 		klog.Info("shutdown scheduler...")
-		s.shutdownfn()
+		shutdownfn()
+	}
+}
+
+// FitsExistingNode runs the filter plugins of the running scheduler for the pod against the nodes in the cluster.
+// See minisched.Scheduler.FitsExistingNode.
+func (s *Service) FitsExistingNode(ctx context.Context, pod *v1.Pod) *framework.Status {
+	sched, err := s.runningScheduler()
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+	return sched.FitsExistingNode(ctx, pod)
+}
+
+// FitsNewNode runs the filter plugins of the running scheduler for the pod on the node which isn't in the cluster.
+// See minisched.Scheduler.FitsNewNode.
+func (s *Service) FitsNewNode(ctx context.Context, pod *v1.Pod, node *v1.Node, pods []*v1.Pod) *framework.Status {
+	sched, err := s.runningScheduler()
+	if err != nil {
+		return framework.AsStatus(err)
 	}
+	return sched.FitsNewNode(ctx, pod, node, pods)
+}
+
+// ScoreAssignedPod runs the filter and the score plugins of the running scheduler for the pod on a node
+// as if it were scheduled again. See minisched.Scheduler.ScoreAssignedPod.
+func (s *Service) ScoreAssignedPod(ctx context.Context, pod *v1.Pod) (framework.NodeScoreList, *framework.Status) {
+	sched, err := s.runningScheduler()
+	if err != nil {
+		return nil, framework.AsStatus(err)
+	}
+	return sched.ScoreAssignedPod(ctx, pod)
+}
+
+// Simulate runs the plugins of the running scheduler for the pod as a dry run. See minisched.Scheduler.Simulate.
+func (s *Service) Simulate(ctx context.Context, pod *v1.Pod) (*minisched.SimulationResult, error) {
+	sched, err := s.runningScheduler()
+	if err != nil {
+		return nil, err
+	}
+	return sched.Simulate(ctx, pod)
+}
+
+// EstimateCapacity estimates how many copies of the pod fit the cluster with the running scheduler.
+// See minisched.Scheduler.EstimateCapacity.
+func (s *Service) EstimateCapacity(ctx context.Context, pod *v1.Pod, max int) (*minisched.CapacityEstimate, error) {
+	sched, err := s.runningScheduler()
+	if err != nil {
+		return nil, err
+	}
+	return sched.EstimateCapacity(ctx, pod, max)
+}
+
+func (s *Service) runningScheduler() (*minisched.Scheduler, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.sched == nil {
+		return nil, xerrors.New("scheduler is not running")
+	}
+	return s.sched, nil
 }
 
 func (s *Service) GetSchedulerConfig() *v1beta2config.KubeSchedulerConfiguration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.currentSchedulerCfg
 }
+
+// ProfileOptions returns the options to configure minisched with the first profile in cfg.
+// minisched doesn't support multiple profiles, so the others are ignored.
+func ProfileOptions(cfg *v1beta2config.KubeSchedulerConfiguration) []minisched.Option {
+	if len(cfg.Profiles) == 0 {
+		return nil
+	}
+	if len(cfg.Profiles) > 1 {
+		klog.Warningf("only the first profile is used out of %d profiles", len(cfg.Profiles))
+	}
+	return []minisched.Option{minisched.WithProfile(cfg.Profiles[0].DeepCopy())}
+}
@@ -0,0 +1,36 @@
+package scheduler
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+
+	"github.com/nakamasato/mini-kube-scheduler/snapshot"
+)
+
+// ExportSnapshot exports the resources in the cluster and the current scheduler configuration.
+func (s *Service) ExportSnapshot(ctx context.Context) (*snapshot.Snapshot, error) {
+	snap, err := snapshot.Export(ctx, s.clientset)
+	if err != nil {
+		return nil, xerrors.Errorf("export resources: %w", err)
+	}
+	if cfg := s.GetSchedulerConfig(); cfg != nil {
+		snap.SchedulerConfig = cfg.DeepCopy()
+	}
+	return snap, nil
+}
+
+// ImportSnapshot imports the resources in the snapshot.
+// If the snapshot has a scheduler configuration, the scheduler is restarted with it before the resources are
+// imported, so that the imported pending pods are scheduled with the configuration, not the previous one.
+func (s *Service) ImportSnapshot(ctx context.Context, snap *snapshot.Snapshot, opts snapshot.ImportOptions) error {
+	if snap.SchedulerConfig != nil {
+		if err := s.RestartScheduler(snap.SchedulerConfig); err != nil {
+			return xerrors.Errorf("restart scheduler: %w", err)
+		}
+	}
+	if err := snapshot.Import(ctx, s.clientset, snap, opts); err != nil {
+		return xerrors.Errorf("import resources: %w", err)
+	}
+	return nil
+}
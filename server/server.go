@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/yaml"
+
+	"github.com/nakamasato/mini-kube-scheduler/scheduler"
+	"github.com/nakamasato/mini-kube-scheduler/snapshot"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Server is the HTTP server to operate the simulator.
+//
+// Endpoints:
+//
+//	GET  /api/v1/snapshot              export the cluster state and the scheduler configuration as JSON (or YAML with ?format=yaml).
+//	POST /api/v1/snapshot[?clear=true] import the cluster state in the request body (JSON or YAML).
+//	POST /api/v1/simulate              run the filter and the score plugins for the pod in the request body (JSON or YAML)
+//	                                   without scheduling it, and return the result of each plugin for each node as JSON.
+//	POST /api/v1/capacity[?max=N]      estimate how many copies of the pod in the request body (JSON or YAML) fit the cluster,
+//	                                   and return the number of them on each node and the plugins limiting them as JSON.
+type Server struct {
+	sched *scheduler.Service
+	mux   *http.ServeMux
+}
+
+// NewServer creates Server.
+func NewServer(sched *scheduler.Service) *Server {
+	s := &Server{
+		sched: sched,
+		mux:   http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/api/v1/snapshot", s.handleSnapshot)
+	s.mux.HandleFunc("/api/v1/simulate", s.handleSimulate)
+	s.mux.HandleFunc("/api/v1/capacity", s.handleCapacity)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start starts the server on the address and returns the function to shut it down.
+func (s *Server) Start(address string) (func(), error) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, xerrors.Errorf("listen on %s: %w", address, err)
+	}
+
+	hs := &http.Server{Handler: s}
+	go func() {
+		if err := hs.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("serve http: %v", err)
+		}
+	}()
+	klog.Infof("http server is running on %s", l.Addr())
+
+	shutdownFunc := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := hs.Shutdown(ctx); err != nil {
+			klog.Errorf("shutdown http server: %v", err)
+		}
+	}
+	return shutdownFunc, nil
+}
+
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.exportSnapshot(w, r)
+	case http.MethodPost:
+		s.importSnapshot(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) exportSnapshot(w http.ResponseWriter, r *http.Request) {
+	snap, err := s.sched.ExportSnapshot(r.Context())
+	if err != nil {
+		klog.Errorf("export snapshot: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var data []byte
+	contentType := "application/json"
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		data, err = json.Marshal(snap)
+	case "yaml":
+		data, err = yaml.Marshal(snap)
+		contentType = "application/yaml"
+	default:
+		http.Error(w, "unknown format: "+format, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		klog.Errorf("encode snapshot: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(data); err != nil {
+		klog.Errorf("write snapshot: %v", err)
+	}
+}
+
+func (s *Server) importSnapshot(w http.ResponseWriter, r *http.Request) {
+	opts := snapshot.ImportOptions{}
+	if c := r.URL.Query().Get("clear"); c != "" {
+		clear, err := strconv.ParseBool(c)
+		if err != nil {
+			http.Error(w, "invalid clear: "+c, http.StatusBadRequest)
+			return
+		}
+		opts.Clear = clear
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	snap := &snapshot.Snapshot{}
+	// yaml.Unmarshal can decode json as well.
+	if err := yaml.Unmarshal(data, snap); err != nil {
+		http.Error(w, "decode snapshot: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.sched.ImportSnapshot(r.Context(), snap, opts); err != nil {
+		klog.Errorf("import snapshot: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pod, err := readPod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.sched.Simulate(r.Context(), pod)
+	if err != nil {
+		klog.Errorf("simulate pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, result)
+}
+
+func (s *Server) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	max := 0
+	if m := r.URL.Query().Get("max"); m != "" {
+		var err error
+		max, err = strconv.Atoi(m)
+		if err != nil || max < 0 {
+			http.Error(w, "invalid max: "+m, http.StatusBadRequest)
+			return
+		}
+	}
+	pod, err := readPod(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	estimate, err := s.sched.EstimateCapacity(r.Context(), pod, max)
+	if err != nil {
+		klog.Errorf("estimate capacity for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, estimate)
+}
+
+// readPod decodes the pod in the request body (JSON or YAML). The namespace defaults to default.
+func readPod(r *http.Request) (*v1.Pod, error) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	pod := &v1.Pod{}
+	// yaml.Unmarshal can decode json as well.
+	if err := yaml.Unmarshal(data, pod); err != nil {
+		return nil, xerrors.Errorf("decode pod: %w", err)
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = metav1.NamespaceDefault
+	}
+	return pod, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		klog.Errorf("encode response: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		klog.Errorf("write response: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package snapshot
+
+import (
+	"context"
+
+	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// ClusterOptions is the options for FromCluster.
+type ClusterOptions struct {
+	// UnbindSelector selects the pods to be unbound (Spec.NodeName is cleared) so that minisched places them again.
+	// No pod is unbound if nil.
+	UnbindSelector labels.Selector
+}
+
+// FromCluster reads the resources from a live cluster and strips the fields which don't make sense in the simulator,
+// such as the fields managed by API server, the owner references (the owners are not copied) and the pod statuses.
+// Terminating pods and pods which have finished are skipped because they don't use any node resources.
+func FromCluster(ctx context.Context, client clientset.Interface, opts ClusterOptions) (*Snapshot, error) {
+	s, err := Export(ctx, client)
+	if err != nil {
+		return nil, xerrors.Errorf("export resources from the cluster: %w", err)
+	}
+
+	for i := range s.Namespaces {
+		stripObjectMeta(&s.Namespaces[i].ObjectMeta)
+	}
+	for i := range s.PriorityClasses {
+		stripObjectMeta(&s.PriorityClasses[i].ObjectMeta)
+	}
+	for i := range s.StorageClasses {
+		stripObjectMeta(&s.StorageClasses[i].ObjectMeta)
+	}
+	for i := range s.PVs {
+		stripObjectMeta(&s.PVs[i].ObjectMeta)
+	}
+	for i := range s.PVCs {
+		stripObjectMeta(&s.PVCs[i].ObjectMeta)
+	}
+	for i := range s.Nodes {
+		stripObjectMeta(&s.Nodes[i].ObjectMeta)
+	}
+
+	pods := make([]v1.Pod, 0, len(s.Pods))
+	for _, p := range s.Pods {
+		if p.DeletionTimestamp != nil || p.Status.Phase == v1.PodSucceeded || p.Status.Phase == v1.PodFailed {
+			continue
+		}
+		stripObjectMeta(&p.ObjectMeta)
+		p.Status = v1.PodStatus{}
+		if opts.UnbindSelector != nil && opts.UnbindSelector.Matches(labels.Set(p.Labels)) {
+			p.Spec.NodeName = ""
+		}
+		pods = append(pods, p)
+	}
+	s.Pods = pods
+
+	return s, nil
+}
+
+// stripObjectMeta removes the fields managed by API server and the owner references.
+func stripObjectMeta(m *metav1.ObjectMeta) {
+	resetObjectMeta(m)
+	m.OwnerReferences = nil
+}
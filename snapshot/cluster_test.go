@@ -0,0 +1,192 @@
+package snapshot
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/nakamasato/mini-kube-scheduler/k8sapiserver"
+)
+
+// startAPIServer starts API server with etcdURL and returns the client of it.
+func startAPIServer(t *testing.T, etcdURL string) clientset.Interface {
+	t.Helper()
+	cfg, shutdown, err := k8sapiserver.StartAPIServer(k8sapiserver.Options{EtcdURL: etcdURL})
+	if err != nil {
+		t.Fatalf("start API server: %v", err)
+	}
+	t.Cleanup(shutdown)
+	return clientset.NewForConfigOrDie(cfg)
+}
+
+// seedSource creates a namespace, a bound pair of PVC and PV, a node and pods on the node in the source cluster,
+// and returns the UID of the PVC.
+func seedSource(ctx context.Context, t *testing.T, client clientset.Interface) string {
+	t.Helper()
+	const ns = "team"
+
+	if _, err := client.CoreV1().Namespaces().Create(ctx, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+
+	pvc, err := client.CoreV1().PersistentVolumeClaims(ns).Create(ctx, &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data"},
+		Spec: v1.PersistentVolumeClaimSpec{
+			AccessModes: []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Resources:   v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")}},
+			VolumeName:  "pv-data",
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("create pvc: %v", err)
+	}
+	_, err = client.CoreV1().PersistentVolumes().Create(ctx, &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-data"},
+		Spec: v1.PersistentVolumeSpec{
+			AccessModes:            []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce},
+			Capacity:               v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			PersistentVolumeSource: v1.PersistentVolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/tmp/data"}},
+			ClaimRef: &v1.ObjectReference{
+				Kind:            "PersistentVolumeClaim",
+				Namespace:       ns,
+				Name:            pvc.Name,
+				UID:             pvc.UID,
+				ResourceVersion: pvc.ResourceVersion,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("create pv: %v", err)
+	}
+
+	node, err := client.CoreV1().Nodes().Create(ctx, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("create node: %v", err)
+	}
+	node.Status.Allocatable = v1.ResourceList{v1.ResourceCPU: resource.MustParse("4"), v1.ResourcePods: resource.MustParse("110")}
+	if _, err := client.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("update status of node: %v", err)
+	}
+
+	for _, name := range []string{"web", "batch"} {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{"app": name},
+				// the owner isn't copied, so the reference must be stripped.
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: name, UID: "5b2f7d6e-0000-0000-0000-000000000000"}},
+			},
+			Spec: v1.PodSpec{
+				NodeName:   node.Name,
+				Containers: []v1.Container{{Name: "c", Image: "k8s.gcr.io/pause:3.5"}},
+			},
+		}
+		created, err := client.CoreV1().Pods(ns).Create(ctx, pod, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("create pod %s: %v", name, err)
+		}
+		created.Status.Phase = v1.PodRunning
+		if _, err := client.CoreV1().Pods(ns).UpdateStatus(ctx, created, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("update status of pod %s: %v", name, err)
+		}
+	}
+
+	return string(pvc.UID)
+}
+
+func assertStripped(t *testing.T, kind string, m metav1.ObjectMeta) {
+	t.Helper()
+	if m.UID != "" || m.ResourceVersion != "" || !m.CreationTimestamp.IsZero() || m.ManagedFields != nil || m.OwnerReferences != nil {
+		t.Errorf("%s %s/%s has the fields managed by API server or the owner references: %+v", kind, m.Namespace, m.Name, m)
+	}
+}
+
+func TestFromClusterAndImport(t *testing.T) {
+	ctx := context.Background()
+
+	etcdURL, shutdownEtcd, err := k8sapiserver.StartEmbeddedEtcd()
+	if err != nil {
+		t.Fatalf("start embedded etcd: %v", err)
+	}
+	// registered first to run after the API servers are shut down.
+	t.Cleanup(shutdownEtcd)
+	src := startAPIServer(t, etcdURL)
+	dst := startAPIServer(t, etcdURL)
+
+	srcPVCUID := seedSource(ctx, t, src)
+
+	snap, err := FromCluster(ctx, src, ClusterOptions{UnbindSelector: labels.SelectorFromSet(labels.Set{"app": "web"})})
+	if err != nil {
+		t.Fatalf("FromCluster: %v", err)
+	}
+
+	for _, ns := range snap.Namespaces {
+		assertStripped(t, "namespace", ns.ObjectMeta)
+	}
+	for _, pv := range snap.PVs {
+		assertStripped(t, "pv", pv.ObjectMeta)
+	}
+	for _, pvc := range snap.PVCs {
+		assertStripped(t, "pvc", pvc.ObjectMeta)
+	}
+	for _, n := range snap.Nodes {
+		assertStripped(t, "node", n.ObjectMeta)
+	}
+	if len(snap.Pods) != 2 {
+		t.Fatalf("got %d pods, want 2", len(snap.Pods))
+	}
+	for _, p := range snap.Pods {
+		assertStripped(t, "pod", p.ObjectMeta)
+		if p.Status.Phase != "" {
+			t.Errorf("pod %s has the status: %+v", p.Name, p.Status)
+		}
+	}
+
+	if err := Import(ctx, dst, snap, ImportOptions{}); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	pvc, err := dst.CoreV1().PersistentVolumeClaims("team").Get(ctx, "data", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get imported pvc: %v", err)
+	}
+	if string(pvc.UID) == srcPVCUID {
+		t.Fatalf("the imported pvc has the UID of the source: %s", pvc.UID)
+	}
+	pv, err := dst.CoreV1().PersistentVolumes().Get(ctx, "pv-data", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get imported pv: %v", err)
+	}
+	if pv.Spec.ClaimRef == nil || pv.Spec.ClaimRef.UID != pvc.UID {
+		t.Errorf("claimRef of the imported pv = %+v, want the UID %s of the imported pvc", pv.Spec.ClaimRef, pvc.UID)
+	}
+
+	wantNodeNames := map[string]string{
+		// unbound by UnbindSelector.
+		"web":   "",
+		"batch": "node1",
+	}
+	for name, want := range wantNodeNames {
+		pod, err := dst.CoreV1().Pods("team").Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get imported pod %s: %v", name, err)
+		}
+		if pod.Spec.NodeName != want {
+			t.Errorf("Spec.NodeName of pod %s = %q, want %q", name, pod.Spec.NodeName, want)
+		}
+	}
+
+	// the source and the destination share etcd, but not the resources.
+	got, err := src.CoreV1().Pods("team").Get(ctx, "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get source pod: %v", err)
+	}
+	if got.Spec.NodeName != "node1" {
+		t.Errorf("the source pod is unbound: %q", got.Spec.NodeName)
+	}
+}
@@ -0,0 +1,324 @@
+package snapshot
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/xerrors"
+	v1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	v1beta2config "k8s.io/kube-scheduler/config/v1beta2"
+)
+
+// Snapshot is the state of the simulated cluster.
+type Snapshot struct {
+	Namespaces      []v1.Namespace                            `json:"namespaces,omitempty"`
+	PriorityClasses []schedulingv1.PriorityClass              `json:"priorityClasses,omitempty"`
+	StorageClasses  []storagev1.StorageClass                  `json:"storageClasses,omitempty"`
+	PVs             []v1.PersistentVolume                     `json:"pvs,omitempty"`
+	PVCs            []v1.PersistentVolumeClaim                `json:"pvcs,omitempty"`
+	Nodes           []v1.Node                                 `json:"nodes,omitempty"`
+	Pods            []v1.Pod                                  `json:"pods,omitempty"`
+	SchedulerConfig *v1beta2config.KubeSchedulerConfiguration `json:"schedulerConfig,omitempty"`
+}
+
+// ImportOptions is the options for Import.
+type ImportOptions struct {
+	// Clear deletes all the resources in the cluster before importing.
+	Clear bool
+}
+
+// Export gets all the resources in the cluster. SchedulerConfig is not set.
+//
+//nolint:funlen
+func Export(ctx context.Context, client clientset.Interface) (*Snapshot, error) {
+	s := &Snapshot{}
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("list namespaces: %w", err)
+	}
+	for _, ns := range namespaces.Items {
+		if isSystemNamespace(ns.Name) {
+			continue
+		}
+		s.Namespaces = append(s.Namespaces, ns)
+	}
+
+	pcs, err := client.SchedulingV1().PriorityClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("list priority classes: %w", err)
+	}
+	for _, pc := range pcs.Items {
+		if isSystemPriorityClass(pc.Name) {
+			continue
+		}
+		s.PriorityClasses = append(s.PriorityClasses, pc)
+	}
+
+	scs, err := client.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("list storage classes: %w", err)
+	}
+	s.StorageClasses = scs.Items
+
+	pvs, err := client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("list pvs: %w", err)
+	}
+	s.PVs = pvs.Items
+
+	pvcs, err := client.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("list pvcs: %w", err)
+	}
+	s.PVCs = pvcs.Items
+
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("list nodes: %w", err)
+	}
+	s.Nodes = nodes.Items
+
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, xerrors.Errorf("list pods: %w", err)
+	}
+	s.Pods = pods.Items
+
+	return s, nil
+}
+
+// Import creates all the resources in the snapshot. SchedulerConfig is not applied.
+// Pods which were bound in the snapshot are created with the same Spec.NodeName.
+//
+//nolint:funlen
+func Import(ctx context.Context, client clientset.Interface, s *Snapshot, opts ImportOptions) error {
+	if opts.Clear {
+		if err := Clear(ctx, client); err != nil {
+			return xerrors.Errorf("clear cluster: %w", err)
+		}
+	}
+
+	for _, ns := range s.Namespaces {
+		ns := ns
+		resetObjectMeta(&ns.ObjectMeta)
+		ns.Status = v1.NamespaceStatus{}
+		if _, err := client.CoreV1().Namespaces().Create(ctx, &ns, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return xerrors.Errorf("create namespace %s: %w", ns.Name, err)
+		}
+	}
+	for _, pc := range s.PriorityClasses {
+		pc := pc
+		resetObjectMeta(&pc.ObjectMeta)
+		if _, err := client.SchedulingV1().PriorityClasses().Create(ctx, &pc, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return xerrors.Errorf("create priority class %s: %w", pc.Name, err)
+		}
+	}
+	for _, sc := range s.StorageClasses {
+		sc := sc
+		resetObjectMeta(&sc.ObjectMeta)
+		if _, err := client.StorageV1().StorageClasses().Create(ctx, &sc, metav1.CreateOptions{}); err != nil {
+			return xerrors.Errorf("create storage class %s: %w", sc.Name, err)
+		}
+	}
+	// PVCs are created before PVs so that the claimRefs of PVs can point the new UIDs of PVCs.
+	pvcUIDs := make(map[string]types.UID, len(s.PVCs))
+	for _, pvc := range s.PVCs {
+		pvc := pvc
+		resetObjectMeta(&pvc.ObjectMeta)
+		created, err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(ctx, &pvc, metav1.CreateOptions{})
+		if err != nil {
+			return xerrors.Errorf("create pvc %s/%s: %w", pvc.Namespace, pvc.Name, err)
+		}
+		pvcUIDs[pvc.Namespace+"/"+pvc.Name] = created.UID
+		created.Status = pvc.Status
+		if _, err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).UpdateStatus(ctx, created, metav1.UpdateOptions{}); err != nil {
+			return xerrors.Errorf("update status of pvc %s/%s: %w", pvc.Namespace, pvc.Name, err)
+		}
+	}
+	for _, pv := range s.PVs {
+		pv := pv
+		resetObjectMeta(&pv.ObjectMeta)
+		if ref := pv.Spec.ClaimRef; ref != nil {
+			// the UID of the PVC is changed by import.
+			ref.UID = pvcUIDs[ref.Namespace+"/"+ref.Name]
+			ref.ResourceVersion = ""
+		}
+		created, err := client.CoreV1().PersistentVolumes().Create(ctx, &pv, metav1.CreateOptions{})
+		if err != nil {
+			return xerrors.Errorf("create pv %s: %w", pv.Name, err)
+		}
+		created.Status = pv.Status
+		if _, err := client.CoreV1().PersistentVolumes().UpdateStatus(ctx, created, metav1.UpdateOptions{}); err != nil {
+			return xerrors.Errorf("update status of pv %s: %w", pv.Name, err)
+		}
+	}
+	for _, n := range s.Nodes {
+		n := n
+		resetObjectMeta(&n.ObjectMeta)
+		created, err := client.CoreV1().Nodes().Create(ctx, &n, metav1.CreateOptions{})
+		if err != nil {
+			return xerrors.Errorf("create node %s: %w", n.Name, err)
+		}
+		// The status (e.g. allocatable resources and conditions) is ignored on creation.
+		created.Status = n.Status
+		if _, err := client.CoreV1().Nodes().UpdateStatus(ctx, created, metav1.UpdateOptions{}); err != nil {
+			return xerrors.Errorf("update status of node %s: %w", n.Name, err)
+		}
+	}
+	for _, p := range s.Pods {
+		p := p
+		resetObjectMeta(&p.ObjectMeta)
+		if _, err := client.CoreV1().Pods(p.Namespace).Create(ctx, &p, metav1.CreateOptions{}); err != nil {
+			return xerrors.Errorf("create pod %s/%s: %w", p.Namespace, p.Name, err)
+		}
+	}
+	return nil
+}
+
+// Clear deletes all the resources which are exported by Export.
+// As no controller and kubelet run in the simulator, pods are deleted immediately, and
+// finalizers are removed so that the resources don't get stuck in terminating.
+//
+//nolint:funlen
+func Clear(ctx context.Context, client clientset.Interface) error {
+	immediately := metav1.DeleteOptions{GracePeriodSeconds: new(int64)}
+
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return xerrors.Errorf("list pods: %w", err)
+	}
+	for _, p := range pods.Items {
+		if err := client.CoreV1().Pods(p.Namespace).Delete(ctx, p.Name, immediately); err != nil && !apierrors.IsNotFound(err) {
+			return xerrors.Errorf("delete pod %s/%s: %w", p.Namespace, p.Name, err)
+		}
+	}
+
+	if err := client.CoreV1().Nodes().DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{}); err != nil {
+		return xerrors.Errorf("delete nodes: %w", err)
+	}
+
+	pvcs, err := client.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return xerrors.Errorf("list pvcs: %w", err)
+	}
+	for _, pvc := range pvcs.Items {
+		if len(pvc.Finalizers) > 0 {
+			if _, err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Patch(ctx, pvc.Name, types.MergePatchType, removeFinalizersPatch, metav1.PatchOptions{}); err != nil {
+				return xerrors.Errorf("remove finalizers of pvc %s/%s: %w", pvc.Namespace, pvc.Name, err)
+			}
+		}
+		if err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Delete(ctx, pvc.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return xerrors.Errorf("delete pvc %s/%s: %w", pvc.Namespace, pvc.Name, err)
+		}
+	}
+
+	pvs, err := client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return xerrors.Errorf("list pvs: %w", err)
+	}
+	for _, pv := range pvs.Items {
+		if len(pv.Finalizers) > 0 {
+			if _, err := client.CoreV1().PersistentVolumes().Patch(ctx, pv.Name, types.MergePatchType, removeFinalizersPatch, metav1.PatchOptions{}); err != nil {
+				return xerrors.Errorf("remove finalizers of pv %s: %w", pv.Name, err)
+			}
+		}
+		if err := client.CoreV1().PersistentVolumes().Delete(ctx, pv.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return xerrors.Errorf("delete pv %s: %w", pv.Name, err)
+		}
+	}
+
+	if err := client.StorageV1().StorageClasses().DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{}); err != nil {
+		return xerrors.Errorf("delete storage classes: %w", err)
+	}
+
+	pcs, err := client.SchedulingV1().PriorityClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return xerrors.Errorf("list priority classes: %w", err)
+	}
+	for _, pc := range pcs.Items {
+		if isSystemPriorityClass(pc.Name) {
+			continue
+		}
+		if err := client.SchedulingV1().PriorityClasses().Delete(ctx, pc.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return xerrors.Errorf("delete priority class %s: %w", pc.Name, err)
+		}
+	}
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return xerrors.Errorf("list namespaces: %w", err)
+	}
+	for _, ns := range namespaces.Items {
+		if isSystemNamespace(ns.Name) {
+			continue
+		}
+		if err := deleteNamespace(ctx, client, ns.Name); err != nil {
+			return xerrors.Errorf("delete namespace %s: %w", ns.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// deleteNamespace deletes the namespace. The namespace controller isn't running,
+// so we finalize the namespace and delete it again as the namespace controller does.
+func deleteNamespace(ctx context.Context, client clientset.Interface, name string) error {
+	if err := client.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return xerrors.Errorf("delete: %w", err)
+	}
+
+	ns, err := client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return xerrors.Errorf("get: %w", err)
+	}
+	ns.Spec.Finalizers = nil
+	if _, err := client.CoreV1().Namespaces().Finalize(ctx, ns, metav1.UpdateOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return xerrors.Errorf("finalize: %w", err)
+	}
+
+	if err := client.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return xerrors.Errorf("delete finalized namespace: %w", err)
+	}
+	return nil
+}
+
+var removeFinalizersPatch = []byte(`{"metadata":{"finalizers":null}}`)
+
+// isSystemNamespace returns true if the namespace is created by API server.
+func isSystemNamespace(name string) bool {
+	switch name {
+	case metav1.NamespaceDefault, metav1.NamespaceSystem, metav1.NamespacePublic, v1.NamespaceNodeLease:
+		return true
+	}
+	return false
+}
+
+// isSystemPriorityClass returns true if the priority class is created by API server.
+func isSystemPriorityClass(name string) bool {
+	return strings.HasPrefix(name, "system-")
+}
+
+// resetObjectMeta removes the fields managed by API server so that the object can be created again.
+func resetObjectMeta(m *metav1.ObjectMeta) {
+	m.UID = ""
+	m.ResourceVersion = ""
+	m.Generation = 0
+	m.CreationTimestamp = metav1.Time{}
+	m.DeletionTimestamp = nil
+	m.DeletionGracePeriodSeconds = nil
+	m.ManagedFields = nil
+	m.SelfLink = ""
+}